@@ -5,6 +5,7 @@ import (
 	"huma-app/lib/config"
 	"huma-app/lib/handlers"
 	"huma-app/lib/middleware"
+	"huma-app/lib/scim"
 	"huma-app/lib/security"
 
 	"huma-app/store"
@@ -18,7 +19,7 @@ import (
 
 func NewApi(db *sql.DB, mux *chi.Mux) huma.API {
 	store := store.New(db)
-	security := security.NewSecurity()
+	security := security.NewSecurity(store)
 	handlers := handlers.NewApiHandlers(store, security)
 	config := huma.DefaultConfig(config.Get().Name, config.Get().Version)
 	config.DocsPath = "" //"/api/docs"
@@ -27,14 +28,43 @@ func NewApi(db *sql.DB, mux *chi.Mux) huma.API {
 			Type:         "http",
 			Scheme:       "bearer",
 			BearerFormat: "JWT",
-			In:           "cookie",
+			Description:  "Access token in the Authorization header, e.g. from /api/auth/login/token.",
+		},
+		"Cookie": {
+			Type:        "apiKey",
+			Name:        "jwt",
+			In:          "cookie",
+			Description: "Access token in the cookie set by /api/auth/login. Requests that change state also need the X-CSRF-Token header.",
+		},
+		"ApiKey": {
+			Type:        "apiKey",
+			Name:        "X-API-Key",
+			In:          "header",
+			Description: "Personal API key. Can also be sent as `Authorization: Bearer <key>`.",
 		},
 	}
+	// Operations declare their permissions on Bearer only. The access token
+	// is also accepted from the cookie, and an API key works in its place,
+	// with the same permission requirements.
+	config.OpenAPI.OnAddOperation = append(config.OpenAPI.OnAddOperation, func(oapi *huma.OpenAPI, op *huma.Operation) {
+		for _, scheme := range op.Security {
+			if permissions, ok := scheme["Bearer"]; ok {
+				op.Security = append(op.Security,
+					map[string][]string{"Cookie": permissions},
+					map[string][]string{"ApiKey": permissions},
+				)
+				return
+			}
+		}
+	})
 	config.CreateHooks = []func(huma.Config) huma.Config{
 		func(c huma.Config) huma.Config { return c },
 	}
+	scim.InstallErrors()
 	api := humachi.New(mux, config)
 	api.UseMiddleware(middleware.RealIpMiddleware)
+	api.UseMiddleware(middleware.UserAgentMiddleware)
+	api.UseMiddleware(middleware.CsrfMiddleware(api))
 	api.UseMiddleware(middleware.JwtAuthMiddleware(api, security))
 	huma.AutoRegister(api, handlers)
 
@@ -0,0 +1,181 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"huma-app/store"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionRegister       = "user.register"
+	ActionLogin          = "user.login"
+	ActionLoginFailed    = "user.login_failed"
+	ActionLogout         = "user.logout"
+	ActionVerifyEmail    = "user.verify_email"
+	ActionDeleteUser     = "user.delete"
+	ActionSetUserRole    = "user.set_role"
+	ActionImpersonate    = "user.impersonate"
+	ActionRevokeSessions = "user.revoke_sessions"
+	ActionProvisionUser  = "user.provision"
+	ActionLinkIdentity   = "user.link_identity"
+	ActionUpdateUser     = "user.update"
+	ActionActivateUser   = "user.activate"
+	ActionDeactivateUser = "user.deactivate"
+	ActionCreateRole     = "role.create"
+	ActionUpdateRole     = "role.update"
+	ActionDeleteRole     = "role.delete"
+)
+
+// genesisHash is the prev_hash of the first entry.
+const genesisHash = ""
+
+var ErrChainBroken = errors.New("audit log hash chain is broken")
+
+// Event is one entry to record. Actor defaults to the authenticated user of
+// the request; the address, user agent and impersonator are taken from the
+// request as well.
+type Event struct {
+	Actor    uuid.UUID
+	Action   string
+	Target   string
+	Metadata map[string]any
+}
+
+// Logger appends events to the audit_events table. Every entry stores the
+// hash of the previous one and a hash over itself including it, so changing
+// or removing an entry in the middle breaks the chain, see Verify.
+type Logger struct {
+	repo *store.Queries
+	// mu keeps reading the last hash and appending after it atomic.
+	mu  sync.Mutex
+	Now func() time.Time
+}
+
+func NewLogger(repo *store.Queries) *Logger {
+	return &Logger{repo: repo, Now: time.Now}
+}
+
+// Record appends the event. The request the event belongs to has already
+// happened, so failures are logged instead of returned.
+func (l *Logger) Record(ctx context.Context, event Event) {
+	if err := l.record(ctx, event); err != nil {
+		slog.Error("cannot write audit event", "action", event.Action, "err", err)
+	}
+}
+
+func (l *Logger) record(ctx context.Context, event Event) error {
+	actor := event.Actor
+	if actor == uuid.Nil {
+		actor, _ = ctx.Value("user_id").(uuid.UUID)
+	}
+	metadata := map[string]any{}
+	for k, v := range event.Metadata {
+		metadata[k] = v
+	}
+	if impersonator, ok := ctx.Value("impersonator_id").(uuid.UUID); ok {
+		metadata["impersonator_id"] = impersonator
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	ip, _ := ctx.Value("real-ip").(string)
+	userAgent, _ := ctx.Value("user-agent").(string)
+
+	entry := store.AuditEvent{
+		CreatedAt: l.Now().UTC(),
+		Action:    event.Action,
+		Target:    event.Target,
+		Ip:        ip,
+		UserAgent: userAgent,
+		Metadata:  string(encoded),
+	}
+	if actor != uuid.Nil {
+		entry.ActorID = actor.String()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	prev, err := l.repo.GetLastAuditHash(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		prev = genesisHash
+	} else if err != nil {
+		return err
+	}
+	entry.PrevHash = prev
+	entry.Hash = hash(entry)
+	return l.repo.CreateAuditEvent(ctx, store.CreateAuditEventParams{
+		CreatedAt: entry.CreatedAt,
+		ActorID:   entry.ActorID,
+		Action:    entry.Action,
+		Target:    entry.Target,
+		Ip:        entry.Ip,
+		UserAgent: entry.UserAgent,
+		Metadata:  entry.Metadata,
+		PrevHash:  entry.PrevHash,
+		Hash:      entry.Hash,
+	})
+}
+
+// hash covers every stored field of the entry but its id, and the hash of
+// the entry before it.
+func hash(entry store.AuditEvent) string {
+	fields, _ := json.Marshal([]string{
+		entry.PrevHash,
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+		entry.ActorID,
+		entry.Action,
+		entry.Target,
+		entry.Ip,
+		entry.UserAgent,
+		entry.Metadata,
+	})
+	sum := sha256.Sum256(fields)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyBatch is how many entries Verify reads at a time.
+const verifyBatch = 500
+
+// Verify walks the whole log in order and checks that every entry links to
+// the one before and matches its own hash. It returns the number of entries
+// and the hash of the last one, which can be kept elsewhere to also detect
+// entries removed from the end.
+func (l *Logger) Verify(ctx context.Context) (count int, head string, err error) {
+	prev := genesisHash
+	var lastID int64
+	for {
+		rows, err := l.repo.GetAuditEventsAfter(ctx, store.GetAuditEventsAfterParams{
+			ID:    lastID,
+			Limit: verifyBatch,
+		})
+		if err != nil {
+			return count, prev, err
+		}
+		for _, row := range rows {
+			if row.PrevHash != prev {
+				return count, prev, fmt.Errorf("%w: entry %d does not follow the entry before it", ErrChainBroken, row.ID)
+			}
+			if hash(row) != row.Hash {
+				return count, prev, fmt.Errorf("%w: entry %d was modified", ErrChainBroken, row.ID)
+			}
+			prev = row.Hash
+			lastID = row.ID
+			count++
+		}
+		if len(rows) < verifyBatch {
+			return count, prev, nil
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huma-app/lib/config"
+	"huma-app/lib/password"
+	"huma-app/store"
+	"huma-app/store/types"
+)
+
+var (
+	// ErrUnknownUser means the backend does not know the login, so the next
+	// one is asked.
+	ErrUnknownUser = errors.New("unknown user")
+	// ErrWrongPassword means the backend knows the login and rejected the
+	// password. No other backend is asked.
+	ErrWrongPassword  = errors.New("wrong password")
+	ErrUnknownBackend = errors.New("unknown authentication backend")
+)
+
+const (
+	Local    = "local"
+	Ldap     = "ldap"
+	Htpasswd = "htpasswd"
+)
+
+// IsBackend tells whether an identity provider name is a login backend other
+// than Local. The password of users with such an identity is the backend's.
+func IsBackend(provider string) bool {
+	return provider == Ldap || provider == Htpasswd
+}
+
+// Identity is a login checked by a backend. Users of other backends than
+// Local get a local shadow user, linked by Backend and Subject.
+type Identity struct {
+	Backend string
+	Subject string // stable id of the user within the backend
+	Email   string
+	// ManagesRole tells whether the backend decides the role. Role is then
+	// the mapped one, or empty for the default role.
+	ManagesRole bool
+	Role        types.Role
+}
+
+// Authenticator checks a password for a login, which is an email.
+// Authenticate returns ErrUnknownUser or ErrWrongPassword when the login
+// fails and any other error when the backend cannot tell.
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, login, password string) (*Identity, error)
+}
+
+// Chain asks its backends in order until one knows the login.
+type Chain []Authenticator
+
+// New builds the chain from the configured backends.
+func New(cfg config.Config, repo *store.Queries, hasher *password.Hasher) (Chain, error) {
+	chain := Chain{}
+	for _, name := range cfg.Auth.Backends {
+		switch name {
+		case Local:
+			chain = append(chain, NewLocalAuthenticator(repo, hasher))
+		case Ldap:
+			chain = append(chain, NewLdapAuthenticator(cfg.Ldap))
+		case Htpasswd:
+			authenticator, err := NewHtpasswdAuthenticator(cfg.Htpasswd, hasher)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, authenticator)
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, name)
+		}
+	}
+	return chain, nil
+}
+
+// Authenticate returns the identity from the first backend that knows the
+// login. A backend that fails is skipped, but its error is returned if no
+// later backend knows the login either, so an outage does not look like a
+// wrong password.
+func (c Chain) Authenticate(ctx context.Context, login, password string) (*Identity, error) {
+	var failed error
+	for _, authenticator := range c {
+		identity, err := authenticator.Authenticate(ctx, login, password)
+		switch {
+		case err == nil:
+			return identity, nil
+		case errors.Is(err, ErrUnknownUser):
+		case errors.Is(err, ErrWrongPassword):
+			return nil, err
+		default:
+			if failed == nil {
+				failed = fmt.Errorf("%s: %w", authenticator.Name(), err)
+			}
+		}
+	}
+	if failed != nil {
+		return nil, failed
+	}
+	return nil, ErrUnknownUser
+}
@@ -0,0 +1,69 @@
+package authn_test
+
+import (
+	"context"
+	"errors"
+	"huma-app/lib/authn"
+	"testing"
+)
+
+// fakeBackend answers every login the same way and counts the calls.
+type fakeBackend struct {
+	name     string
+	identity *authn.Identity
+	err      error
+	calls    int
+}
+
+func (b *fakeBackend) Name() string {
+	return b.name
+}
+
+func (b *fakeBackend) Authenticate(ctx context.Context, login, password string) (*authn.Identity, error) {
+	b.calls++
+	return b.identity, b.err
+}
+
+func TestChain(t *testing.T) {
+	outage := errors.New("connection refused")
+	found := &authn.Identity{Backend: "second", Subject: "user"}
+
+	tests := []struct {
+		name          string
+		first, second error
+		want          error
+		secondAsked   bool
+	}{
+		{"unknown asks the next backend", authn.ErrUnknownUser, nil, nil, true},
+		{"wrong password stops", authn.ErrWrongPassword, nil, authn.ErrWrongPassword, false},
+		{"failing backend is skipped", outage, nil, nil, true},
+		{"failure is returned when nobody knows the login", outage, authn.ErrUnknownUser, outage, true},
+		{"nobody knows the login", authn.ErrUnknownUser, authn.ErrUnknownUser, authn.ErrUnknownUser, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := &fakeBackend{name: "first", err: tt.first}
+			second := &fakeBackend{name: "second", err: tt.second}
+			if tt.second == nil {
+				second.identity = found
+			}
+
+			identity, err := authn.Chain{first, second}.Authenticate(context.Background(), "user@example.com", "secret")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && identity != found {
+				t.Errorf("identity %+v, want the one of the second backend", identity)
+			}
+			if asked := second.calls > 0; asked != tt.secondAsked {
+				t.Errorf("second backend asked: %v, want %v", asked, tt.secondAsked)
+			}
+		})
+	}
+}
+
+func TestEmptyChainKnowsNobody(t *testing.T) {
+	if _, err := (authn.Chain{}).Authenticate(context.Background(), "user@example.com", "secret"); !errors.Is(err, authn.ErrUnknownUser) {
+		t.Errorf("error %v, want ErrUnknownUser", err)
+	}
+}
@@ -0,0 +1,86 @@
+package authn
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"huma-app/lib/config"
+	"huma-app/lib/password"
+	"huma-app/store/types"
+	"os"
+	"strings"
+)
+
+// HtpasswdAuthenticator logs in service accounts listed in a static file of
+// email:hash lines. Blank lines and lines starting with # are skipped. The
+// file is read on every login, so edits apply without a restart.
+type HtpasswdAuthenticator struct {
+	cfg    config.Htpasswd
+	hasher *password.Hasher
+}
+
+// NewHtpasswdAuthenticator fails if the file cannot be read or has a line
+// that is not email:hash with a supported hash.
+func NewHtpasswdAuthenticator(cfg config.Htpasswd, hasher *password.Hasher) (*HtpasswdAuthenticator, error) {
+	a := &HtpasswdAuthenticator{cfg: cfg, hasher: hasher}
+	if _, err := a.read(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *HtpasswdAuthenticator) Name() string {
+	return Htpasswd
+}
+
+func (a *HtpasswdAuthenticator) read() (map[string]string, error) {
+	file, err := os.Open(a.cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hashes := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		login, hash, ok := strings.Cut(text, ":")
+		if !ok || login == "" {
+			return nil, fmt.Errorf("%s:%d: expected email:hash", a.cfg.Path, line)
+		}
+		// htpasswd also writes MD5 and SHA-1 hashes, which are too weak.
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "$argon2id$") {
+			return nil, fmt.Errorf("%s:%d: unsupported hash, use bcrypt (htpasswd -B) or argon2id", a.cfg.Path, line)
+		}
+		hashes[login] = hash
+	}
+	return hashes, scanner.Err()
+}
+
+func (a *HtpasswdAuthenticator) Authenticate(ctx context.Context, login, password string) (*Identity, error) {
+	hashes, err := a.read()
+	if err != nil {
+		return nil, err
+	}
+	hash, ok := hashes[login]
+	if !ok {
+		return nil, ErrUnknownUser
+	}
+	ok, _, err = a.hasher.Verify(password, hash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrWrongPassword
+	}
+	return &Identity{
+		Backend:     Htpasswd,
+		Subject:     login,
+		Email:       login,
+		ManagesRole: a.cfg.Role != "",
+		Role:        types.Role(a.cfg.Role),
+	}, nil
+}
@@ -0,0 +1,122 @@
+package authn
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"huma-app/lib/config"
+	"huma-app/store/types"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var ErrAmbiguousLdapUser = errors.New("ldap user filter matches several entries")
+
+// LdapAuthenticator logs users in with a simple bind to an LDAP or Active
+// Directory server. The user entry is searched by the login email, with the
+// configured account or anonymously, and the password is checked by binding
+// as that entry. The DN is the subject of the identity.
+type LdapAuthenticator struct {
+	cfg config.Ldap
+}
+
+func NewLdapAuthenticator(cfg config.Ldap) *LdapAuthenticator {
+	return &LdapAuthenticator{cfg: cfg}
+}
+
+func (a *LdapAuthenticator) Name() string {
+	return Ldap
+}
+
+func (a *LdapAuthenticator) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(a.cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: a.cfg.Timeout}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(a.cfg.Timeout)
+	if a.cfg.StartTLS {
+		u, err := url.Parse(a.cfg.URL)
+		if err == nil {
+			err = conn.StartTLS(&tls.Config{ServerName: u.Hostname()})
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (a *LdapAuthenticator) Authenticate(ctx context.Context, login, password string) (*Identity, error) {
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.cfg.BindDN != "" {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("search bind: %w", err)
+		}
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(a.cfg.Timeout.Seconds()), false,
+		strings.ReplaceAll(a.cfg.UserFilter, "%s", ldap.EscapeFilter(login)),
+		[]string{a.cfg.EmailAttribute, a.cfg.GroupAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrUnknownUser
+	case 1:
+	default:
+		return nil, ErrAmbiguousLdapUser
+	}
+	entry := result.Entries[0]
+
+	// A simple bind with an empty password is an unauthenticated bind,
+	// which servers accept for any DN.
+	if password == "" {
+		return nil, ErrWrongPassword
+	}
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrWrongPassword
+		}
+		return nil, err
+	}
+
+	identity := &Identity{
+		Backend: Ldap,
+		Subject: entry.DN,
+		Email:   entry.GetAttributeValue(a.cfg.EmailAttribute),
+	}
+	if identity.Email == "" {
+		identity.Email = login
+	}
+	if len(a.cfg.RoleMapping) > 0 {
+		identity.ManagesRole = true
+		identity.Role = a.mapRole(entry.GetAttributeValues(a.cfg.GroupAttribute))
+	}
+	return identity, nil
+}
+
+// mapRole returns the role of the first group found in the role mapping, or
+// an empty role if there is none. DNs compare case-insensitively.
+func (a *LdapAuthenticator) mapRole(groups []string) types.Role {
+	for _, group := range groups {
+		for dn, role := range a.cfg.RoleMapping {
+			if strings.EqualFold(group, dn) {
+				return types.Role(role)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,252 @@
+package authn_test
+
+import (
+	"context"
+	"errors"
+	"huma-app/lib/authn"
+	"huma-app/lib/config"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	serviceDN       = "cn=svc,dc=example"
+	servicePassword = "svc-secret"
+)
+
+type ldapEntry struct {
+	dn, password, mail string
+	groups             []string
+}
+
+// ldapServer is just enough of an LDAP server for simple binds and searches
+// by mail. Like real servers, it accepts a bind with an empty password as an
+// unauthenticated bind for any DN.
+type ldapServer struct {
+	net.Listener
+	entries []ldapEntry
+
+	mu    sync.Mutex
+	binds []string // DNs of successful binds
+}
+
+func newLdapServer(t *testing.T, entries ...ldapEntry) *ldapServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &ldapServer{Listener: listener, entries: entries}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *ldapServer) config(roles map[string]string) config.Ldap {
+	return config.Ldap{
+		URL:            "ldap://" + s.Addr().String(),
+		BindDN:         serviceDN,
+		BindPassword:   servicePassword,
+		BaseDN:         "ou=people,dc=example",
+		UserFilter:     "(&(objectClass=person)(mail=%s))",
+		EmailAttribute: "mail",
+		GroupAttribute: "memberOf",
+		Timeout:        5 * time.Second,
+		RoleMapping:    roles,
+	}
+}
+
+func (s *ldapServer) boundAs(dn string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, bound := range s.binds {
+		if bound == dn {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ldapServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			switch {
+			case password == "":
+				code = ldap.LDAPResultSuccess
+			case dn == serviceDN && password == servicePassword:
+				code = ldap.LDAPResultSuccess
+			default:
+				for _, entry := range s.entries {
+					if dn == entry.dn && password == entry.password {
+						code = ldap.LDAPResultSuccess
+					}
+				}
+			}
+			if code == ldap.LDAPResultSuccess {
+				s.mu.Lock()
+				s.binds = append(s.binds, dn)
+				s.mu.Unlock()
+			}
+			conn.Write(ldapResult(id, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationSearchRequest:
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				conn.Write(ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError).Bytes())
+				continue
+			}
+			for _, entry := range s.entries {
+				if strings.Contains(filter, "(mail="+entry.mail+")") {
+					conn.Write(ldapSearchEntry(id, entry).Bytes())
+				}
+			}
+			conn.Write(ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		}
+	}
+}
+
+func ldapMessage(id int64, op *ber.Packet) *ber.Packet {
+	message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	message.AppendChild(op)
+	return message
+}
+
+func ldapResult(id int64, tag ber.Tag, code uint16) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return ldapMessage(id, result)
+}
+
+func ldapSearchEntry(id int64, entry ldapEntry) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, ""))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	add := func(name string, values ...string) {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	add("mail", entry.mail)
+	if len(entry.groups) > 0 {
+		add("memberOf", entry.groups...)
+	}
+	result.AppendChild(attributes)
+	return ldapMessage(id, result)
+}
+
+var (
+	alice = ldapEntry{"uid=alice,ou=people,dc=example", "alice-secret", "alice@example.com", []string{"CN=Admins,ou=groups,dc=example"}}
+	bob   = ldapEntry{"uid=bob,ou=people,dc=example", "bob-secret", "bob@example.com", nil}
+)
+
+func TestLdapLogin(t *testing.T) {
+	server := newLdapServer(t, alice, bob)
+	a := authn.NewLdapAuthenticator(server.config(map[string]string{"cn=admins,ou=groups,dc=example": "admin"}))
+
+	identity, err := a.Authenticate(context.Background(), alice.mail, alice.password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := authn.Identity{Backend: authn.Ldap, Subject: alice.dn, Email: alice.mail, ManagesRole: true, Role: "admin"}
+	if *identity != want {
+		t.Errorf("identity %+v, want %+v", *identity, want)
+	}
+	if !server.boundAs(serviceDN) {
+		t.Error("search did not bind with the service account")
+	}
+
+	identity, err = a.Authenticate(context.Background(), bob.mail, bob.password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !identity.ManagesRole || identity.Role != "" {
+		t.Errorf("user without a mapped group: %+v, want the default role", *identity)
+	}
+}
+
+func TestLdapLoginWithoutRoleMapping(t *testing.T) {
+	server := newLdapServer(t, alice)
+	identity, err := authn.NewLdapAuthenticator(server.config(nil)).Authenticate(context.Background(), alice.mail, alice.password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.ManagesRole {
+		t.Errorf("identity %+v manages the role without a role mapping", *identity)
+	}
+}
+
+func TestLdapRejectsLogin(t *testing.T) {
+	duplicate := ldapEntry{"uid=carol,ou=people,dc=example", "carol-secret", bob.mail, nil}
+	server := newLdapServer(t, alice, bob, duplicate)
+	a := authn.NewLdapAuthenticator(server.config(nil))
+
+	tests := []struct {
+		name            string
+		login, password string
+		want            error
+	}{
+		{"wrong password", alice.mail, "wrong", authn.ErrWrongPassword},
+		// The server would take it as an unauthenticated bind. It has to
+		// count as a wrong password, not log in or look like an outage.
+		{"empty password", alice.mail, "", authn.ErrWrongPassword},
+		{"unknown user", "nobody@example.com", "secret", authn.ErrUnknownUser},
+		{"filter characters are escaped", "*", "secret", authn.ErrUnknownUser},
+		{"several entries", bob.mail, bob.password, authn.ErrAmbiguousLdapUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := a.Authenticate(context.Background(), tt.login, tt.password)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("identity %+v, error %v, want %v", identity, err, tt.want)
+			}
+		})
+	}
+	if server.boundAs(alice.dn) {
+		t.Error("bound as the user although every login failed")
+	}
+}
+
+func TestLdapServiceBindFails(t *testing.T) {
+	server := newLdapServer(t, alice)
+	cfg := server.config(nil)
+	cfg.BindPassword = "wrong"
+
+	_, err := authn.NewLdapAuthenticator(cfg).Authenticate(context.Background(), alice.mail, alice.password)
+	if err == nil || errors.Is(err, authn.ErrUnknownUser) || errors.Is(err, authn.ErrWrongPassword) {
+		t.Errorf("error %v, want a backend failure", err)
+	}
+}
@@ -0,0 +1,64 @@
+package authn
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"huma-app/lib/password"
+	"huma-app/store"
+	"log/slog"
+
+	"github.com/google/uuid"
+)
+
+// LocalAuthenticator checks the password hash stored with the user. Users
+// without a password, like those from SSO, are unknown to it.
+type LocalAuthenticator struct {
+	repo   *store.Queries
+	hasher *password.Hasher
+}
+
+func NewLocalAuthenticator(repo *store.Queries, hasher *password.Hasher) *LocalAuthenticator {
+	return &LocalAuthenticator{repo: repo, hasher: hasher}
+}
+
+func (a *LocalAuthenticator) Name() string {
+	return Local
+}
+
+func (a *LocalAuthenticator) Authenticate(ctx context.Context, login, password string) (*Identity, error) {
+	user, err := a.repo.GetUserByEmail(ctx, login)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && user.Password == "") {
+		return nil, ErrUnknownUser
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ok, rehash, err := a.hasher.Verify(password, user.Password)
+	if err != nil {
+		slog.Error("cannot verify password", "err", err)
+	}
+	if !ok {
+		return nil, ErrWrongPassword
+	}
+	if rehash {
+		a.upgradeHash(ctx, user.ID, password)
+	}
+	return &Identity{Backend: Local, Subject: user.ID.String(), Email: user.Email}, nil
+}
+
+// upgradeHash stores a fresh hash of the password after a login found the
+// old one outdated. Failing here only delays the upgrade to the next login.
+func (a *LocalAuthenticator) upgradeHash(ctx context.Context, userID uuid.UUID, password string) {
+	hash, err := a.hasher.Hash(password)
+	if err == nil {
+		err = a.repo.UpdateUserPassword(ctx, store.UpdateUserPasswordParams{
+			Password: hash,
+			ID:       userID,
+		})
+	}
+	if err != nil {
+		slog.Error("cannot upgrade password hash", "err", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
@@ -21,7 +22,21 @@ type Smtp struct {
 }
 
 type FrontendUrls struct {
-	Verify string `yaml:"verify"`
+	Verify   string `yaml:"verify"`
+	Password string `yaml:"password"`
+	App      string `yaml:"app" env-default:"/app"`
+	Unlock   string `yaml:"unlock"`
+	Magic    string `yaml:"magic"`
+	// Page that asks for the second factor after a login through an identity
+	// provider, with the challenge for two-factor-verify.
+	TwoFactor string `yaml:"two_factor" env-default:"/2fa?challenge=%s"`
+	// Links from the email change flow: confirm goes to the new address,
+	// cancel to the old one.
+	ConfirmEmail string `yaml:"confirm_email"`
+	CancelEmail  string `yaml:"cancel_email"`
+	Invitation   string `yaml:"invitation"`
+	// Link in security notices that signs the account out everywhere.
+	NotMe string `yaml:"not_me"`
 }
 
 type Frontend struct {
@@ -32,23 +47,141 @@ type Frontend struct {
 type Server struct {
 	Port int    `yaml:"port" env-required:"false" env-default:"8888"`
 	Host string `yaml:"host" env-required:"false" env-default:"localhost"`
+	// Origins of frontends served from another host, e.g. a dev server.
+	CorsOrigins []string `yaml:"cors_origins"`
 }
 
 type Api struct {
 	Name    string `yaml:"name" env-required:"false" env-default:"My API"`
 	Version string `yaml:"version" env-required:"false" env-default:"1.0.0"`
 }
+type JwtKey struct {
+	Kid       string `yaml:"kid"`
+	Algorithm string `yaml:"alg"`    // HS256, RS256 or EdDSA
+	Secret    string `yaml:"secret"` // shared secret for HS256
+	Path      string `yaml:"path"`   // PEM private key for RS256 and EdDSA
+}
+
 type Secret struct {
-	Jwt string `yaml:"jwt" env-required:"false" env-default:"x4FdvXiOwcP65Jc1VJyMbpun"`
+	Jwt       string   `yaml:"jwt"`
+	Keys      []JwtKey `yaml:"keys"`
+	ActiveKey string   `yaml:"active_key"`
+}
+
+type Token struct {
+	AccessTTL  time.Duration `yaml:"access_ttl" env-default:"15m"`
+	RefreshTTL time.Duration `yaml:"refresh_ttl" env-default:"720h"`
+}
+
+type Auth struct {
+	RequireVerifiedEmail bool          `yaml:"require_verified_email" env-default:"false"`
+	LockoutThreshold     int64         `yaml:"lockout_threshold" env-default:"5"`     // failed logins before lockout
+	LockoutDuration      time.Duration `yaml:"lockout_duration" env-default:"15m"`    // how long the account stays locked
+	LoginDelay           time.Duration `yaml:"login_delay" env-default:"1s"`          // doubled on every failure before lockout
+	MagicLink            bool          `yaml:"magic_link" env-default:"false"`        // passwordless login by email link
+	InviteOnly           bool          `yaml:"invite_only" env-default:"false"`       // new accounts only through invitations
+	TokenPrecedence      string        `yaml:"token_precedence" env-default:"cookie"` // cookie or header, wins when a request has both
+	// Password backends asked in order: local, ldap and htpasswd. The first
+	// one that knows the email decides.
+	Backends []string `yaml:"backends" env-default:"local"`
+}
+
+type PasswordPolicy struct {
+	MinLength    int    `yaml:"min_length" env-default:"8"`
+	MinClasses   int    `yaml:"min_classes" env-default:"2"` // of lowercase, uppercase, digits and symbols
+	MinScore     int    `yaml:"min_score" env-default:"2"`   // strength from 0 to 4
+	BreachedPath string `yaml:"breached_path"`               // directory with SHA-1 range files, empty to skip the check
+}
+
+type PasswordHash struct {
+	Algorithm        string `yaml:"algorithm" env-default:"argon2id"` // argon2id or bcrypt, used for new hashes
+	BcryptCost       int    `yaml:"bcrypt_cost" env-default:"10"`
+	Argon2Memory     uint32 `yaml:"argon2_memory" env-default:"65536"` // KiB
+	Argon2Time       uint32 `yaml:"argon2_time" env-default:"3"`
+	Argon2Threads    uint8  `yaml:"argon2_threads" env-default:"2"`
+	Argon2KeyLength  uint32 `yaml:"argon2_key_length" env-default:"32"`
+	Argon2SaltLength uint32 `yaml:"argon2_salt_length" env-default:"16"`
+}
+
+type OidcProvider struct {
+	Name         string   `yaml:"name"` // used in /api/auth/oidc/{name}/... urls
+	Title        string   `yaml:"title"`
+	DiscoveryURL string   `yaml:"discovery_url"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"` // must point to /api/auth/oidc/{name}/callback
+	Scopes       []string `yaml:"scopes"`
+}
+
+type Oidc struct {
+	Providers []OidcProvider `yaml:"providers"`
+}
+
+type SamlProvider struct {
+	Name  string `yaml:"name"` // used in /api/auth/saml/{name}/... urls
+	Title string `yaml:"title"`
+	// Public url of the app. The metadata and ACS urls of the service
+	// provider are RootURL + /api/auth/saml/{name}/metadata and .../acs.
+	RootURL  string `yaml:"root_url"`
+	EntityID string `yaml:"entity_id"` // defaults to the metadata url
+	// IdP metadata, from a url or a file.
+	IdpMetadataURL  string `yaml:"idp_metadata_url"`
+	IdpMetadataPath string `yaml:"idp_metadata_path"`
+	CertificatePath string `yaml:"certificate_path"` // PEM certificate of the service provider
+	KeyPath         string `yaml:"key_path"`         // PEM private key of the service provider
+	EmailAttribute  string `yaml:"email_attribute"`  // attribute with the email, defaults to the NameID
+	// Attribute whose values are mapped to roles. When set, the role of the
+	// accounts created by the provider is updated on every login: the first
+	// value found in RoleMapping wins and users without one get the user role.
+	RoleAttribute string            `yaml:"role_attribute"`
+	RoleMapping   map[string]string `yaml:"role_mapping"`
+}
+
+type Saml struct {
+	Providers []SamlProvider `yaml:"providers"`
+}
+
+// Ldap logs users in with a simple bind to an LDAP or Active Directory server.
+type Ldap struct {
+	URL      string `yaml:"url"` // ldap://host:389 or ldaps://host:636
+	StartTLS bool   `yaml:"start_tls"`
+	// Account used to search for users, empty to search anonymously.
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string `yaml:"bind_password"`
+	BaseDN       string `yaml:"base_dn"`
+	// Filter finding the user, %s is replaced with the login email.
+	UserFilter     string        `yaml:"user_filter" env-default:"(mail=%s)"`
+	EmailAttribute string        `yaml:"email_attribute" env-default:"mail"`
+	GroupAttribute string        `yaml:"group_attribute" env-default:"memberOf"` // group DNs of the user entry
+	Timeout        time.Duration `yaml:"timeout" env-default:"5s"`
+	// Group DNs mapped to roles. When set, the role of the accounts created
+	// by LDAP logins is updated on every login: the first group found in
+	// RoleMapping wins and users without one get the user role.
+	RoleMapping map[string]string `yaml:"role_mapping"`
+}
+
+// Htpasswd logs service accounts in from a file of email:hash lines, with
+// bcrypt hashes as written by htpasswd -B or argon2id hashes.
+type Htpasswd struct {
+	Path string `yaml:"path"`
+	Role string `yaml:"role"` // role the accounts it created get on every login, empty to leave it to admins
 }
 
 type Config struct {
-	Frontend `yaml:"frontend"`
-	Secret   `yaml:"secret"`
-	Server   `yaml:"server"`
-	Storage  `yaml:"storage"`
-	Api      `yaml:"api"`
-	Smtp     `yaml:"smtp" env-required:"false"`
+	Frontend       `yaml:"frontend"`
+	Auth           `yaml:"auth"`
+	PasswordPolicy `yaml:"password_policy"`
+	PasswordHash   `yaml:"password_hash"`
+	Secret         `yaml:"secret"`
+	Token          `yaml:"token"`
+	Server         `yaml:"server"`
+	Storage        `yaml:"storage"`
+	Api            `yaml:"api"`
+	Smtp           `yaml:"smtp" env-required:"false"`
+	Oidc           `yaml:"oidc"`
+	Saml           `yaml:"saml"`
+	Ldap           `yaml:"ldap"`
+	Htpasswd       `yaml:"htpasswd"`
 }
 
 var (
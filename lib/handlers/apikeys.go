@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"huma-app/lib/security"
+	"huma-app/store"
+	"huma-app/store/types"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+type ApiKeyOutputBody struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix" doc:"First characters of the key, to tell keys apart"`
+	Role       types.Role `json:"role"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Key        string     `json:"key,omitempty" doc:"The key itself. Returned only once, on creation"`
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+type CreateApiKeyInputBody struct {
+	Name      string     `json:"name" required:"true" minLength:"1" maxLength:"100"`
+	Role      types.Role `json:"role,omitempty" doc:"Role the key acts as. Either your own role or user. Defaults to user"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type CreateApiKeyInput struct {
+	AuthHeader
+	Body CreateApiKeyInputBody
+}
+
+type ApiKeyOutput struct {
+	Body ApiKeyOutputBody
+}
+
+func (rs *ApiHandlers) RegisterCreateApiKey(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "create-api-key",
+		Summary:     "Create API key",
+		Description: "Creates a personal API key for machine clients. The key can be sent in the `X-API-Key` header or as `Authorization: Bearer <key>`.",
+		Method:      http.MethodPost,
+		Path:        "/api/api-keys",
+		Tags:        []string{"API keys"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusUnauthorized,
+			http.StatusForbidden,
+		},
+	}, func(ctx context.Context, input *CreateApiKeyInput) (*ApiKeyOutput, error) {
+
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+
+		role := input.Body.Role
+		if role == "" {
+			role = types.RoleUser
+		}
+		if role != types.RoleUser && role != input.Role {
+			return nil, huma.Error403Forbidden("Key role must be your own role or user")
+		}
+
+		var expiresAt sql.NullTime
+		if input.Body.ExpiresAt != nil {
+			if input.Body.ExpiresAt.Before(time.Now()) {
+				return nil, huma.Error400BadRequest("Expiration time is in the past")
+			}
+			expiresAt = sql.NullTime{Time: input.Body.ExpiresAt.UTC(), Valid: true}
+		}
+
+		key, hash, err := security.GenerateApiKey()
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot generate key")
+		}
+
+		row, err := rs.repo.CreateApiKey(ctx, store.CreateApiKeyParams{
+			ID:        uuid.New(),
+			UserID:    input.UserId,
+			Name:      input.Body.Name,
+			Prefix:    key[:len(security.ApiKeyPrefix)+6],
+			KeyHash:   hash,
+			Role:      role,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			return nil, huma.Error400BadRequest(err.Error())
+		}
+
+		return &ApiKeyOutput{Body: ApiKeyOutputBody{
+			ID:        row.ID,
+			Name:      row.Name,
+			Prefix:    row.Prefix,
+			Role:      row.Role,
+			CreatedAt: row.CreatedAt,
+			ExpiresAt: nullTime(row.ExpiresAt),
+			Key:       key,
+		}}, nil
+	})
+}
+
+type GetApiKeysOutput struct {
+	Body []ApiKeyOutputBody
+}
+
+func (rs *ApiHandlers) RegisterGetApiKeys(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-api-keys",
+		Summary:     "Get API keys",
+		Method:      http.MethodGet,
+		Path:        "/api/api-keys",
+		Tags:        []string{"API keys"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+	}, func(ctx context.Context, input *AuthHeader) (*GetApiKeysOutput, error) {
+		rows, err := rs.repo.GetUserApiKeys(ctx, input.UserId)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot get keys")
+		}
+		keys := make([]ApiKeyOutputBody, len(rows))
+		for i, row := range rows {
+			keys[i] = ApiKeyOutputBody{
+				ID:         row.ID,
+				Name:       row.Name,
+				Prefix:     row.Prefix,
+				Role:       row.Role,
+				CreatedAt:  row.CreatedAt,
+				ExpiresAt:  nullTime(row.ExpiresAt),
+				LastUsedAt: nullTime(row.LastUsedAt),
+			}
+		}
+		return &GetApiKeysOutput{Body: keys}, nil
+	})
+}
+
+type DeleteApiKeyInput struct {
+	AuthHeader
+	ID uuid.UUID `path:"id"`
+}
+
+func (rs *ApiHandlers) RegisterDeleteApiKey(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-api-key",
+		Summary:     "Revoke API key",
+		Method:      http.MethodDelete,
+		Path:        "/api/api-keys/{id}",
+		Tags:        []string{"API keys"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Errors: []int{
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *DeleteApiKeyInput) (*struct{}, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+
+		n, err := rs.repo.DeleteApiKey(ctx, store.DeleteApiKeyParams{
+			ID:     input.ID,
+			UserID: input.UserId,
+		})
+		if err != nil {
+			return nil, huma.Error400BadRequest(err.Error())
+		}
+		if n == 0 {
+			return nil, huma.Error404NotFound("Key not found")
+		}
+		return nil, nil
+	})
+}
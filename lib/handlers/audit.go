@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"huma-app/lib/audit"
+	"huma-app/lib/security"
+	"huma-app/store"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+// auditLogin records a completed sign-in. The method names how the user
+// proved who they are, e.g. password or magic_link.
+func (rs *ApiHandlers) auditLogin(ctx context.Context, userID uuid.UUID, method string) {
+	rs.audit.Record(ctx, audit.Event{
+		Actor:    userID,
+		Action:   audit.ActionLogin,
+		Target:   userID.String(),
+		Metadata: map[string]any{"method": method},
+	})
+}
+
+// auditLoginFailure records a rejected password login. Unknown addresses
+// have no user, the attempted address is kept as the target instead.
+func (rs *ApiHandlers) auditLoginFailure(ctx context.Context, userID uuid.UUID, email, reason string) {
+	target := email
+	if userID != uuid.Nil {
+		target = userID.String()
+	}
+	rs.audit.Record(ctx, audit.Event{
+		Actor:    userID,
+		Action:   audit.ActionLoginFailed,
+		Target:   target,
+		Metadata: map[string]any{"email": email, "reason": reason},
+	})
+}
+
+type AuditEventOutputBody struct {
+	ID        int64          `json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	ActorID   string         `json:"actor_id" doc:"Empty for anonymous requests"`
+	Action    string         `json:"action"`
+	Target    string         `json:"target"`
+	Ip        string         `json:"ip"`
+	UserAgent string         `json:"user_agent"`
+	Metadata  map[string]any `json:"metadata"`
+	PrevHash  string         `json:"prev_hash"`
+	Hash      string         `json:"hash"`
+}
+
+type GetAuditEventsInput struct {
+	Actor  string    `query:"actor" doc:"Only events by this user id"`
+	Action string    `query:"action" doc:"Only events with this action, e.g. user.login_failed"`
+	Target string    `query:"target" doc:"Only events about this target"`
+	Since  time.Time `query:"since" doc:"Only events at or after this time"`
+	Until  time.Time `query:"until" doc:"Only events before this time"`
+	Before int64     `query:"before" minimum:"0" doc:"Cursor: only events older than this id, use next_before of the previous page"`
+	Limit  int64     `query:"limit" minimum:"1" maximum:"200" default:"50"`
+}
+
+type GetAuditEventsOutput struct {
+	Body struct {
+		Events     []AuditEventOutputBody `json:"events"`
+		NextBefore int64                  `json:"next_before,omitempty" doc:"Cursor of the next page, missing on the last page"`
+	}
+}
+
+func (rs *ApiHandlers) RegisterGetAuditEvents(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-audit-events",
+		Summary:     "Get audit log",
+		Description: "Lists audit events newest first. Pages are chained with the before cursor.",
+		Method:      http.MethodGet,
+		Path:        "/api/audit",
+		Tags:        []string{"Audit"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermAuditRead}},
+		},
+	}, func(ctx context.Context, input *GetAuditEventsInput) (*GetAuditEventsOutput, error) {
+		until := input.Until
+		if until.IsZero() {
+			until = time.Now().Add(time.Minute)
+		}
+		rows, err := rs.repo.GetAuditEvents(ctx, store.GetAuditEventsParams{
+			ActorID:  input.Actor,
+			Action:   input.Action,
+			Target:   input.Target,
+			BeforeID: input.Before,
+			Since:    input.Since.UTC(),
+			Until:    until.UTC(),
+			// One more row than asked tells whether there is a next page.
+			MaxRows: input.Limit + 1,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot get audit events")
+		}
+
+		out := &GetAuditEventsOutput{}
+		if int64(len(rows)) > input.Limit {
+			rows = rows[:input.Limit]
+			out.Body.NextBefore = rows[len(rows)-1].ID
+		}
+		out.Body.Events = make([]AuditEventOutputBody, len(rows))
+		for i, row := range rows {
+			metadata := map[string]any{}
+			json.Unmarshal([]byte(row.Metadata), &metadata)
+			out.Body.Events[i] = AuditEventOutputBody{
+				ID:        row.ID,
+				CreatedAt: row.CreatedAt,
+				ActorID:   row.ActorID,
+				Action:    row.Action,
+				Target:    row.Target,
+				Ip:        row.Ip,
+				UserAgent: row.UserAgent,
+				Metadata:  metadata,
+				PrevHash:  row.PrevHash,
+				Hash:      row.Hash,
+			}
+		}
+		return out, nil
+	})
+}
@@ -2,51 +2,47 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"huma-app/lib/audit"
+	"huma-app/lib/authn"
 	"huma-app/lib/config"
 	"huma-app/lib/mail"
 	"huma-app/lib/middleware"
 	"huma-app/lib/security"
 	"huma-app/store"
 	"huma-app/store/types"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type StatusOutput struct {
 	Status int
 }
 
+// setCookies renders cookies for a []string Set-Cookie output field. A
+// []http.Cookie field would make huma send every field of the cookie as a
+// header of its own.
+func setCookies(cookies ...http.Cookie) []string {
+	headers := make([]string, len(cookies))
+	for i, cookie := range cookies {
+		headers[i] = cookie.String()
+	}
+	return headers
+}
+
 type RegisterInputBody struct {
 	Email    string `format:"email" json:"email" required:"true"`
-	Password string `json:"password"`
+	Password string `json:"password" required:"true"`
 }
 type RegisterInput struct {
 	Body RegisterInputBody
 }
 
-func GetHashPassword(password string) (string, error) {
-	bytePassword := []byte(password)
-	hash, err := bcrypt.GenerateFromPassword(bytePassword, bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hash), nil
-}
-
-func (m *RegisterInputBody) Resolve(ctx huma.Context) []error {
-	// Get request info you don't normally have access to.
-	m.Password, _ = GetHashPassword(m.Password)
-
-	return nil
-}
-
-var _ huma.Resolver = (*RegisterInputBody)(nil)
-
 func (rs *ApiHandlers) RegisterRegister(api huma.API) {
 	huma.Register(api, huma.Operation{
 		OperationID: "register",
@@ -54,33 +50,61 @@ func (rs *ApiHandlers) RegisterRegister(api huma.API) {
 		Method:      http.MethodPost,
 		Path:        "/api/auth/register",
 		Tags:        []string{"Auth"},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusForbidden,
+			http.StatusUnprocessableEntity,
+		},
 	}, func(ctx context.Context, input *RegisterInput) (*StatusOutput, error) {
+		if config.Get().Auth.InviteOnly {
+			return nil, huma.Error403Forbidden("Registration is by invitation only")
+		}
 		_, err := rs.repo.GetUserByEmail(ctx, input.Body.Email)
 		if err == nil {
 			return nil, huma.Error400BadRequest("This email address is already in use")
 		}
+		if err := rs.checkPassword("body.password", input.Body.Password, input.Body.Email); err != nil {
+			return nil, err
+		}
+		hash, err := rs.hasher.Hash(input.Body.Password)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot create user")
+		}
 		user, err := rs.repo.CreateUser(ctx, store.CreateUserParams{
 			ID:       uuid.New(),
 			Email:    input.Body.Email,
-			Password: input.Body.Password,
+			Password: hash,
 		})
 		if err != nil {
 			return nil, huma.Error400BadRequest(err.Error())
 		}
-		token, _ := rs.security.GenerateToken(security.EmailToken, time.Hour*1, user.ID, user.Role)
-		link := fmt.Sprintf(config.Get().Frontend.Urls.Verify, token)
-		err = mail.SendVerifyMail(user.Email, mail.VerifyEmailParams{
-			AppName: config.Get().Api.Name,
-			Link:    link,
+		rs.audit.Record(ctx, audit.Event{
+			Actor:    user.ID,
+			Action:   audit.ActionRegister,
+			Target:   user.ID.String(),
+			Metadata: map[string]any{"email": user.Email},
 		})
+		err = rs.sendVerifyMail(ctx, user.ID, user.Role, user.Email)
 		if err != nil {
-			//
+			slog.Error("cannot send verify mail", "err", err)
 		}
 
 		return &StatusOutput{Status: http.StatusOK}, nil
 	})
 }
 
+func (rs *ApiHandlers) sendVerifyMail(ctx context.Context, userID uuid.UUID, role types.Role, email string) error {
+	token, err := rs.security.GenerateToken(ctx, security.EmailToken, time.Hour*1, userID, role)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf(config.Get().Frontend.Urls.Verify, token)
+	return mail.SendVerifyMail(email, mail.VerifyEmailParams{
+		AppName: config.Get().Api.Name,
+		Link:    link,
+	})
+}
+
 type LoginInputBody struct {
 	Email    string `format:"email" required:"true"`
 	Password string
@@ -90,9 +114,15 @@ type LoginInput struct {
 	Body LoginInputBody
 }
 
+type LoginOutputBody struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	Challenge         string `json:"challenge" doc:"Token to pass to /api/auth/2fa/verify"`
+}
+
 type LoginOutput struct {
-	SetCookie http.Cookie `header:"Set-Cookie"`
+	SetCookie []string `header:"Set-Cookie"`
 	Status    int
+	Body      *LoginOutputBody
 }
 
 func (rs *ApiHandlers) RegisterLogin(api huma.API) {
@@ -100,56 +130,215 @@ func (rs *ApiHandlers) RegisterLogin(api huma.API) {
 	huma.Register(api, huma.Operation{
 		OperationID: "login",
 		Summary:     "Login",
+		Description: "Logins with the right password the account may not use are answered with 403 and one of the types " + loginErrorUnverified + ", " + loginErrorInactive + " or " + loginErrorNotLinked + ".",
 		Method:      http.MethodPost,
 		Path:        "/api/auth/login",
 		Tags:        []string{"Auth"},
 		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.Login)},
 		Errors: []int{
 			http.StatusUnauthorized,
+			http.StatusForbidden,
+			http.StatusLocked,
+			http.StatusTooManyRequests,
+			http.StatusServiceUnavailable,
 		},
 	}, func(ctx context.Context, input *LoginInput) (*LoginOutput, error) {
+		user, err := rs.checkLogin(ctx, input.Body)
+		if err != nil {
+			return nil, err
+		}
+		return rs.finishLogin(ctx, "password", user.ID, user.Role, user.TotpEnabled == 1)
+	})
+}
 
-		user, err := rs.repo.GetUserByEmail(ctx, input.Body.Email)
+// checkLogin checks the email and password of a login against the
+// configured backends, with the lockout and the verified address requirement.
+// Users of other backends than the local one get a shadow user on their first
+// login. Failures are counted for known users and audited.
+func (rs *ApiHandlers) checkLogin(ctx context.Context, input LoginInputBody) (*store.GetUserByEmailRow, error) {
+	user, err := rs.repo.GetUserByEmail(ctx, input.Email)
+	known := err == nil
+	if known {
+		if err := checkLockout(user); err != nil {
+			rs.auditLoginFailure(ctx, user.ID, user.Email, "locked")
+			return nil, err
+		}
+	}
 
-		if err != nil {
-			return nil, huma.Error401Unauthorized("Wrong password or email")
+	identity, err := rs.authn.Authenticate(ctx, input.Email, input.Password)
+	switch {
+	case errors.Is(err, authn.ErrUnknownUser) && !known:
+		rs.auditLoginFailure(ctx, uuid.Nil, input.Email, "unknown_email")
+		return nil, huma.Error401Unauthorized("Wrong password or email")
+	case errors.Is(err, authn.ErrUnknownUser) || errors.Is(err, authn.ErrWrongPassword):
+		if known {
+			rs.recordLoginFailure(ctx, user)
 		}
+		rs.auditLoginFailure(ctx, user.ID, input.Email, "wrong_password")
+		return nil, huma.Error401Unauthorized("Wrong password or email")
+	case err != nil:
+		slog.Error("cannot authenticate", "err", err)
+		return nil, huma.Error503ServiceUnavailable("Cannot check the password, try again later")
+	}
 
-		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Body.Password))
+	if identity.Backend != authn.Local {
+		shadow, err := rs.externalUser(ctx, externalIdentity{
+			Provider:      identity.Backend,
+			Subject:       identity.Subject,
+			Email:         identity.Email,
+			EmailVerified: true,
+			Login:         input.Email,
+			Provisions:    true,
+			ManagesRole:   identity.ManagesRole,
+			Role:          identity.Role,
+		})
+		if errors.Is(err, errLinkByAdmin) {
+			rs.auditLoginFailure(ctx, user.ID, input.Email, "not_linked")
+			return nil, loginRefused(loginErrorNotLinked, err.Error())
+		}
+		if err == nil {
+			user, err = rs.repo.GetUserByEmail(ctx, shadow.Email)
+		}
 		if err != nil {
-			return nil, huma.Error401Unauthorized("Wrong password or email")
+			slog.Error("cannot provision user", "backend", identity.Backend, "err", err)
+			return nil, huma.Error500InternalServerError("Cannot log in")
 		}
-		cookie, _ := rs.security.GenerateTokenToCookies(security.AccessToken, time.Hour*24, user.ID, user.Role)
+	}
+	if user.FailedLogins > 0 {
+		rs.repo.ResetFailedLogins(ctx, user.ID)
+	}
 
+	if err := rs.denyInactive(ctx, user.ID, user.Email, user.Active); err != nil {
+		return nil, err
+	}
+
+	if config.Get().Auth.RequireVerifiedEmail && user.Verified == 0 {
+		rs.auditLoginFailure(ctx, user.ID, user.Email, "unverified")
+		return nil, loginRefused(loginErrorUnverified, "Email address is not verified")
+	}
+	return &user, nil
+}
+
+// denyInactive refuses a login of a user deactivated by an admin or by SCIM
+// deprovisioning. Every way to log in checks it before a challenge or session
+// is issued.
+func (rs *ApiHandlers) denyInactive(ctx context.Context, userID uuid.UUID, email string, active int64) error {
+	if active == 0 {
+		rs.auditLoginFailure(ctx, userID, email, "inactive")
+		return loginRefused(loginErrorInactive, "Account is deactivated")
+	}
+	return nil
+}
+
+// finishLogin completes a login once the first factor is checked: users with
+// two-factor authentication get a challenge, everyone else the session
+// cookies. The method names the first factor in the audit log.
+func (rs *ApiHandlers) finishLogin(ctx context.Context, method string, userID uuid.UUID, role types.Role, twoFactor bool) (*LoginOutput, error) {
+	if twoFactor {
+		challenge, err := rs.security.GenerateToken(ctx, security.TwoFactorToken, time.Minute*5, userID, role)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot issue token")
+		}
 		return &LoginOutput{
-			SetCookie: *cookie,
-			Status:    http.StatusNoContent,
+			Status: http.StatusOK,
+			Body: &LoginOutputBody{
+				TwoFactorRequired: true,
+				Challenge:         challenge,
+			},
 		}, nil
+	}
 
-	})
+	cookies, err := rs.security.GenerateSessionCookies(ctx, userID, role, "")
+	if err != nil {
+		return nil, sessionError(err)
+	}
+	rs.loggedIn(ctx, userID, method)
+
+	return &LoginOutput{
+		SetCookie: setCookies(cookies...),
+		Status:    http.StatusNoContent,
+	}, nil
+}
+
+// loggedIn records a completed login and warns the user when it came from
+// a device they have not used before.
+func (rs *ApiHandlers) loggedIn(ctx context.Context, userID uuid.UUID, method string) {
+	rs.auditLogin(ctx, userID, method)
+	rs.noticeNewDevice(ctx, userID)
+}
+
+// Types of the 403 answers to logins the account may not use, so clients
+// can tell them apart without matching the detail.
+const (
+	loginErrorUnverified = "urn:login:email-unverified"
+	loginErrorInactive   = "urn:login:account-deactivated"
+	loginErrorNotLinked  = "urn:login:account-not-linked"
+)
+
+func loginRefused(errorType, detail string) error {
+	return &huma.ErrorModel{
+		Type:   errorType,
+		Title:  http.StatusText(http.StatusForbidden),
+		Status: http.StatusForbidden,
+		Detail: detail,
+	}
+}
+
+// sessionError answers a failed attempt to start a session.
+func sessionError(err error) error {
+	if errors.Is(err, security.ErrUserInactive) {
+		return loginRefused(loginErrorInactive, "Account is deactivated")
+	}
+	return huma.Error500InternalServerError("Cannot issue token")
 }
 
 type AuthHeader struct {
 	Session http.Cookie `cookie:"jwt"`
 	UserId  uuid.UUID   `hidden:"true"`
 	Role    types.Role  `hidden:"true"`
+	TokenID string      `hidden:"true"`
+	Family  string      `hidden:"true"`
+	// Impersonator is the admin acting as the user, uuid.Nil otherwise.
+	Impersonator uuid.UUID `hidden:"true"`
+	// ActiveOrg is the organization the session works in, uuid.Nil if none.
+	ActiveOrg uuid.UUID `hidden:"true"`
 }
 
 func (m *AuthHeader) Resolve(ctx huma.Context) []error {
 	m.UserId, _ = ctx.Context().Value("user_id").(uuid.UUID)
+	m.Role, _ = ctx.Context().Value("user_role").(types.Role)
+	m.TokenID, _ = ctx.Context().Value("token_id").(string)
+	m.Family, _ = ctx.Context().Value("token_family").(string)
+	m.Impersonator, _ = ctx.Context().Value("impersonator_id").(uuid.UUID)
+	m.ActiveOrg, _ = ctx.Context().Value("active_org").(uuid.UUID)
 	return nil
 }
 
 var _ huma.Resolver = (*AuthHeader)(nil)
 
+// denyImpersonation keeps an admin acting as the user away from account
+// changes only the user may make.
+func (m *AuthHeader) denyImpersonation() error {
+	if m.Impersonator != uuid.Nil {
+		return huma.Error403Forbidden("Not allowed while impersonating")
+	}
+	return nil
+}
+
 type ProfileOutputBody struct {
 	ID    uuid.UUID  `hidden:"true" json:"id"`
 	Email string     `format:"email" json:"email" required:"true"`
 	Role  types.Role `json:"role"`
 }
 
+type MeOutputBody struct {
+	store.GetUserByIdRow
+	ImpersonatedBy *uuid.UUID `json:"impersonated_by,omitempty" doc:"Admin acting as the user"`
+	ActiveOrg      *uuid.UUID `json:"active_org,omitempty" doc:"Organization the session works in"`
+}
+
 type ProfileOutput struct {
-	Body store.GetUserByIdRow
+	Body MeOutputBody
 }
 
 func (rs *ApiHandlers) RegisterMe(api huma.API) {
@@ -169,15 +358,27 @@ func (rs *ApiHandlers) RegisterMe(api huma.API) {
 
 		user, err := rs.repo.GetUserById(ctx, input.UserId)
 		if err != nil {
-			fmt.Println(err.Error())
+			slog.Error("cannot get user", "err", err)
 			return nil, huma.Error404NotFound("User not found")
 		}
-		return &ProfileOutput{Body: user}, nil
+		body := MeOutputBody{GetUserByIdRow: user}
+		if input.Impersonator != uuid.Nil {
+			body.ImpersonatedBy = &input.Impersonator
+		}
+		if input.ActiveOrg != uuid.Nil {
+			body.ActiveOrg = &input.ActiveOrg
+		}
+		return &ProfileOutput{Body: body}, nil
 	})
 }
 
+type LogoutInput struct {
+	AuthHeader
+	Refresh http.Cookie `cookie:"refresh"`
+}
+
 type LogoutOutput struct {
-	SetCookie http.Cookie `header:"Set-Cookie"`
+	SetCookie []string `header:"Set-Cookie"`
 	Status    int
 }
 
@@ -185,23 +386,91 @@ func (rs *ApiHandlers) RegisterLogout(api huma.API) {
 	huma.Register(api, huma.Operation{
 		OperationID: "logout",
 		Summary:     "Logout",
-		Description: "This endpoint is used to log out a currently authenticated user. It invalidates the user's session or authentication token, ensuring that the token can no longer be used for accessing protected resources. This is a critical security feature to prevent unauthorized access after a user logs out.",
+		Description: "This endpoint is used to log out a currently authenticated user. It invalidates the user's session or authentication token, ensuring that the token can no longer be used for accessing protected resources. This is a critical security feature to prevent unauthorized access after a user logs out. While impersonating, the session of the admin is ended too.",
 		Method:      http.MethodGet,
 		Path:        "/api/auth/logout",
 		Tags:        []string{"Auth"},
 		Security: []map[string][]string{
 			{"Bearer": {}},
 		},
-	}, func(ctx context.Context, input *AuthHeader) (*LogoutOutput, error) {
+	}, func(ctx context.Context, input *LogoutInput) (*LogoutOutput, error) {
+
+		var err error
+		if input.Family != "" {
+			err = rs.security.RevokeTokenFamily(ctx, input.Family)
+		} else {
+			err = rs.security.RevokeToken(ctx, input.TokenID)
+		}
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot revoke token")
+		}
+		// While impersonating, the refresh cookie still belongs to the admin,
+		// whose session has to end as well.
+		if input.Impersonator != uuid.Nil {
+			claims, err := rs.security.VerifyToken(ctx, input.Refresh.Value, security.RefreshToken)
+			if err == nil && claims.UserID == input.Impersonator && claims.FamilyID != "" {
+				if err := rs.security.RevokeTokenFamily(ctx, claims.FamilyID); err != nil {
+					return nil, huma.Error500InternalServerError("Cannot revoke token")
+				}
+			}
+		}
+		rs.audit.Record(ctx, audit.Event{
+			Action: audit.ActionLogout,
+			Target: input.UserId.String(),
+		})
 
 		return &LogoutOutput{
-			SetCookie: *rs.security.DeleteCookie(),
-			Status:    http.StatusOK,
+			SetCookie: setCookies(
+				*rs.security.DeleteCookie(),
+				*rs.security.DeleteRefreshCookie(),
+			),
+			Status: http.StatusOK,
 		}, nil
 
 	})
 }
 
+type RefreshInput struct {
+	Refresh http.Cookie `cookie:"refresh"`
+}
+
+func (rs *ApiHandlers) RegisterRefresh(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "refresh",
+		Summary:     "Refresh",
+		Description: "Exchanges the refresh cookie for a new access cookie and a new refresh cookie. Every refresh token can be used once; reusing one revokes all tokens of that login.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/refresh",
+		Tags:        []string{"Auth"},
+		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.Refresh)},
+		Errors: []int{
+			http.StatusUnauthorized,
+			http.StatusTooManyRequests,
+		},
+	}, func(ctx context.Context, input *RefreshInput) (*LoginOutput, error) {
+
+		claims, err := rs.security.RotateRefreshToken(ctx, input.Refresh.Value)
+		if err != nil {
+			return nil, huma.Error401Unauthorized("Invalid or expired refresh token")
+		}
+
+		user, err := rs.repo.GetUserById(ctx, claims.UserID)
+		if err != nil {
+			return nil, huma.Error401Unauthorized("Invalid or expired refresh token")
+		}
+
+		cookies, err := rs.security.GenerateSessionCookies(ctx, user.ID, user.Role, claims.FamilyID, rs.keepActiveOrg(ctx, claims)...)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot issue token")
+		}
+
+		return &LoginOutput{
+			SetCookie: setCookies(cookies...),
+			Status:    http.StatusNoContent,
+		}, nil
+	})
+}
+
 type VerifyEmailInput struct {
 	Token string `query:"token"`
 }
@@ -220,7 +489,7 @@ func (rs *ApiHandlers) RegisterVerify(api huma.API) {
 		},
 	}, func(ctx context.Context, input *VerifyEmailInput) (*StatusOutput, error) {
 
-		token, err := rs.security.VerifyToken(input.Token, security.EmailToken)
+		token, err := rs.security.VerifyToken(ctx, input.Token, security.EmailToken)
 		if err != nil {
 			return &StatusOutput{
 				Status: http.StatusUnauthorized,
@@ -235,9 +504,51 @@ func (rs *ApiHandlers) RegisterVerify(api huma.API) {
 		}
 
 		rs.repo.VerifyUser(ctx, user.ID)
+		rs.security.RevokeToken(ctx, token.ID)
+		rs.audit.Record(ctx, audit.Event{
+			Actor:    user.ID,
+			Action:   audit.ActionVerifyEmail,
+			Target:   user.ID.String(),
+			Metadata: map[string]any{"email": user.Email},
+		})
 		return &StatusOutput{
 			Status: http.StatusOK,
 		}, nil
 
 	})
 }
+
+type ResendVerificationInputBody struct {
+	Email string `format:"email" json:"email" required:"true"`
+}
+
+type ResendVerificationInput struct {
+	Body ResendVerificationInputBody
+}
+
+func (rs *ApiHandlers) RegisterResendVerification(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "resend-verification",
+		Summary:     "Resend verification email",
+		Description: "Sends a new email verification link if the address belongs to an account that is not verified yet. The response is the same in every case.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/resend-verification",
+		Tags:        []string{"Auth"},
+		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.Resend)},
+	}, func(ctx context.Context, input *ResendVerificationInput) (*StatusOutput, error) {
+
+		user, err := rs.repo.GetUserByEmail(ctx, input.Body.Email)
+		if err != nil || user.Verified == 1 {
+			return &StatusOutput{Status: http.StatusOK}, nil
+		}
+
+		go func() {
+			err := rs.sendVerifyMail(context.WithoutCancel(ctx), user.ID, user.Role, user.Email)
+			if err != nil {
+				slog.Error("cannot send verify mail", "err", err)
+			}
+		}()
+
+		return &StatusOutput{Status: http.StatusOK}, nil
+	})
+}
@@ -0,0 +1,96 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testPassword = "Blue-Otter-Radio7"
+
+// createUser registers email with testPassword. Unless verified is set, the
+// address stays unverified.
+func createUser(t *testing.T, email string, verified bool) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/register",
+		strings.NewReader(`{"email":"`+email+`","password":"`+testPassword+`"}`))
+	r.Header.Set("Content-Type", "application/json")
+	if res := serve(r); res.StatusCode != http.StatusOK {
+		t.Fatalf("register %s: status %d", email, res.StatusCode)
+	}
+	if verified {
+		if _, err := db.Exec(`UPDATE users SET verified = 1 WHERE email = ?`, email); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func login(email, password string) *http.Response {
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/login",
+		strings.NewReader(`{"email":"`+email+`","password":"`+password+`"}`))
+	r.Header.Set("Content-Type", "application/json")
+	return serve(r)
+}
+
+func TestLoginRefusalsHaveTypes(t *testing.T) {
+	createUser(t, "login-unverified@example.com", false)
+	createUser(t, "login-inactive@example.com", true)
+	if _, err := db.Exec(`UPDATE users SET active = 0 WHERE email = 'login-inactive@example.com'`); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		email, want string
+	}{
+		{"login-unverified@example.com", "urn:login:email-unverified"},
+		{"login-inactive@example.com", "urn:login:account-deactivated"},
+	}
+	for _, tt := range tests {
+		res := login(tt.email, testPassword)
+		var body struct {
+			Type string `json:"type"`
+		}
+		json.NewDecoder(res.Body).Decode(&body)
+		if res.StatusCode != http.StatusForbidden || body.Type != tt.want {
+			t.Errorf("%s: status %d, type %q, want 403 %q", tt.email, res.StatusCode, body.Type, tt.want)
+		}
+	}
+}
+
+func refresh(token *http.Cookie) *http.Response {
+	return serve(httptest.NewRequest(http.MethodPost, "/api/auth/refresh", nil), token)
+}
+
+func me(session *http.Cookie) *http.Response {
+	return serve(httptest.NewRequest(http.MethodGet, "/api/auth/me", nil), session)
+}
+
+func TestRefreshTokenReuseRevokesLogin(t *testing.T) {
+	createUser(t, "refresh-reuse@example.com", true)
+	res := login("refresh-reuse@example.com", testPassword)
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("login: status %d", res.StatusCode)
+	}
+	first := responseCookie(res, "refresh")
+
+	res = refresh(first)
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("refresh: status %d", res.StatusCode)
+	}
+	session, second := responseCookie(res, "jwt"), responseCookie(res, "refresh")
+	if res := me(session); res.StatusCode != http.StatusOK {
+		t.Fatalf("me: status %d", res.StatusCode)
+	}
+
+	if res := refresh(first); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("reused refresh token: status %d", res.StatusCode)
+	}
+	if res := refresh(second); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("newer refresh token of the login: status %d", res.StatusCode)
+	}
+	if res := me(session); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("access token of the login: status %d", res.StatusCode)
+	}
+}
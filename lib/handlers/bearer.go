@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"huma-app/lib/middleware"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// Logins for clients that are not browsers: the tokens come back in the
+// body and the access token is sent in the Authorization header, which also
+// spares these clients the CSRF token.
+
+type TokenOutputBody struct {
+	AccessToken  string `json:"access_token" doc:"Send as Authorization: Bearer <token>"`
+	TokenType    string `json:"token_type" enum:"Bearer"`
+	ExpiresIn    int    `json:"expires_in" doc:"Seconds until the access token expires"`
+	RefreshToken string `json:"refresh_token" doc:"Pass to /api/auth/token/refresh. Can be used once"`
+}
+
+type TokenOutput struct {
+	Body TokenOutputBody
+}
+
+func (rs *ApiHandlers) tokenOutput(access, refresh string) *TokenOutput {
+	return &TokenOutput{Body: TokenOutputBody{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(rs.security.AccessTTL.Seconds()),
+		RefreshToken: refresh,
+	}}
+}
+
+type TokenLoginInput struct {
+	Body struct {
+		LoginInputBody
+		Code string `json:"code,omitempty" doc:"Code from the authenticator app, required with two-factor authentication"`
+	}
+}
+
+func (rs *ApiHandlers) RegisterTokenLogin(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "token-login",
+		Summary:     "Login for API clients",
+		Description: "Same as login, but returns the tokens in the body instead of cookies. Users with two-factor authentication pass the code along.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/login/token",
+		Tags:        []string{"Auth"},
+		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.Login)},
+		Errors: []int{
+			http.StatusUnauthorized,
+			http.StatusForbidden,
+			http.StatusLocked,
+			http.StatusTooManyRequests,
+			http.StatusServiceUnavailable,
+		},
+	}, func(ctx context.Context, input *TokenLoginInput) (*TokenOutput, error) {
+		user, err := rs.checkLogin(ctx, input.Body.LoginInputBody)
+		if err != nil {
+			return nil, err
+		}
+		method := "password"
+		if user.TotpEnabled == 1 {
+			totp, err := rs.repo.GetUserTotp(ctx, user.ID)
+			if err != nil {
+				return nil, huma.Error500InternalServerError("Cannot check code")
+			}
+			if input.Body.Code == "" {
+				return nil, huma.Error401Unauthorized("Two-factor code required")
+			}
+			if !rs.checkTotp(ctx, user.ID, input.Body.Code, totp.TotpSecret) {
+				rs.auditLoginFailure(ctx, user.ID, user.Email, "wrong_code")
+				return nil, huma.Error401Unauthorized("Invalid code")
+			}
+			method = "2fa"
+		}
+
+		access, refresh, err := rs.security.GenerateSessionTokens(ctx, user.ID, user.Role, "")
+		if err != nil {
+			return nil, sessionError(err)
+		}
+		rs.loggedIn(ctx, user.ID, method)
+		return rs.tokenOutput(access, refresh), nil
+	})
+}
+
+type TokenRefreshInput struct {
+	Body struct {
+		RefreshToken string `json:"refresh_token" required:"true"`
+	}
+}
+
+func (rs *ApiHandlers) RegisterTokenRefresh(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "token-refresh",
+		Summary:     "Refresh for API clients",
+		Description: "Exchanges a refresh token from the body for new tokens, like refresh does with cookies.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/token/refresh",
+		Tags:        []string{"Auth"},
+		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.Refresh)},
+		Errors: []int{
+			http.StatusUnauthorized,
+			http.StatusTooManyRequests,
+		},
+	}, func(ctx context.Context, input *TokenRefreshInput) (*TokenOutput, error) {
+		claims, err := rs.security.RotateRefreshToken(ctx, input.Body.RefreshToken)
+		if err != nil {
+			return nil, huma.Error401Unauthorized("Invalid or expired refresh token")
+		}
+		user, err := rs.repo.GetUserById(ctx, claims.UserID)
+		if err != nil {
+			return nil, huma.Error401Unauthorized("Invalid or expired refresh token")
+		}
+		access, refresh, err := rs.security.GenerateSessionTokens(ctx, user.ID, user.Role, claims.FamilyID, rs.keepActiveOrg(ctx, claims)...)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot issue token")
+		}
+		return rs.tokenOutput(access, refresh), nil
+	})
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"huma-app/lib/middleware"
+	"huma-app/lib/security"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+type CsrfTokenInput struct {
+	Cookie http.Cookie `cookie:"csrf_token"`
+}
+
+type CsrfTokenOutputBody struct {
+	Token string `json:"token" doc:"Send it in the X-CSRF-Token header"`
+}
+
+type CsrfTokenOutput struct {
+	SetCookie http.Cookie `header:"Set-Cookie"`
+	Body      CsrfTokenOutputBody
+}
+
+func (rs *ApiHandlers) RegisterCsrfToken(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "csrf-token",
+		Summary:     "Get CSRF token",
+		Description: "Returns the token that has to be sent in the `X-CSRF-Token` header with every state-changing request authenticated by the session cookie. The token stays the same while the cookie lives, so several tabs can share it.",
+		Method:      http.MethodGet,
+		Path:        "/api/auth/csrf",
+		Tags:        []string{"Auth"},
+	}, func(ctx context.Context, input *CsrfTokenInput) (*CsrfTokenOutput, error) {
+
+		token := input.Cookie.Value
+		if token == "" {
+			var err error
+			token, err = security.RandomString(32)
+			if err != nil {
+				return nil, huma.Error500InternalServerError("Cannot generate token")
+			}
+		}
+
+		return &CsrfTokenOutput{
+			SetCookie: http.Cookie{
+				Name:     middleware.CsrfCookieName,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+				Secure:   true,
+			},
+			Body: CsrfTokenOutputBody{Token: token},
+		}, nil
+	})
+}
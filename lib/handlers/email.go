@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"huma-app/lib/config"
+	"huma-app/lib/mail"
+	"huma-app/lib/middleware"
+	"huma-app/lib/security"
+	"huma-app/store"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+const emailChangeTTL = time.Hour * 24
+
+type ChangeEmailInputBody struct {
+	Password string `json:"password" required:"true"`
+	NewEmail string `json:"new_email" format:"email" required:"true"`
+}
+
+type ChangeEmailInput struct {
+	AuthHeader
+	Body ChangeEmailInputBody
+}
+
+func (rs *ApiHandlers) RegisterChangeEmail(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "change-email",
+		Summary:     "Change email",
+		Description: "Starts an email change. The new address gets a confirmation link and the old one a notice with a link to cancel. The email changes only once the new address is confirmed; a newer request replaces a pending one.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/change-email",
+		Tags:        []string{"Auth"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusUnauthorized,
+			http.StatusForbidden,
+		},
+	}, func(ctx context.Context, input *ChangeEmailInput) (*StatusOutput, error) {
+
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+
+		user, err := rs.repo.GetUserWithPasswordById(ctx, input.UserId)
+		if err != nil {
+			return nil, huma.Error404NotFound("User not found")
+		}
+
+		ok, _, err := rs.hasher.Verify(input.Body.Password, user.Password)
+		if err != nil || !ok {
+			return nil, huma.Error403Forbidden("Wrong password")
+		}
+
+		if strings.EqualFold(input.Body.NewEmail, user.Email) {
+			return nil, huma.Error400BadRequest("This is your current email address")
+		}
+		if _, err := rs.repo.GetUserByEmail(ctx, input.Body.NewEmail); err == nil {
+			return nil, huma.Error400BadRequest("This email address is already in use")
+		}
+
+		// Links of an earlier request must not apply the old pending address.
+		rs.security.RevokeUserTokensOfType(ctx, user.ID, security.EmailChangeToken)
+		rs.security.RevokeUserTokensOfType(ctx, user.ID, security.EmailCancelToken)
+
+		err = rs.repo.SetUserPendingEmail(ctx, store.SetUserPendingEmailParams{
+			PendingEmail: input.Body.NewEmail,
+			ID:           user.ID,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot change email")
+		}
+
+		confirm, err := rs.security.GenerateToken(ctx, security.EmailChangeToken, emailChangeTTL, user.ID, user.Role)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot issue token")
+		}
+		cancel, err := rs.security.GenerateToken(ctx, security.EmailCancelToken, emailChangeTTL, user.ID, user.Role)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot issue token")
+		}
+
+		go func() {
+			err := mail.SendEmailChangeMail(input.Body.NewEmail, mail.EmailChangeParams{
+				AppName: config.Get().Api.Name,
+				Link:    fmt.Sprintf(config.Get().Frontend.Urls.ConfirmEmail, confirm),
+			})
+			if err != nil {
+				slog.Error("cannot send email change mail", "err", err)
+			}
+			err = mail.SendEmailChangeNoticeMail(user.Email, mail.EmailChangeNoticeParams{
+				AppName:  config.Get().Api.Name,
+				NewEmail: input.Body.NewEmail,
+				Link:     fmt.Sprintf(config.Get().Frontend.Urls.CancelEmail, cancel),
+			})
+			if err != nil {
+				slog.Error("cannot send email change notice", "err", err)
+			}
+		}()
+
+		return &StatusOutput{Status: http.StatusOK}, nil
+	})
+}
+
+type EmailChangeTokenInputBody struct {
+	Token string `json:"token" required:"true"`
+}
+
+type EmailChangeTokenInput struct {
+	Body EmailChangeTokenInputBody
+}
+
+func (rs *ApiHandlers) RegisterConfirmEmailChange(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "confirm-email-change",
+		Summary:     "Confirm email change",
+		Description: "Applies the pending email change using the token sent to the new address. All sessions and outstanding tokens of the user are invalidated, so the user has to log in again.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/change-email/confirm",
+		Tags:        []string{"Auth"},
+		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.Verify)},
+		Errors: []int{
+			http.StatusUnauthorized,
+			http.StatusConflict,
+		},
+	}, func(ctx context.Context, input *EmailChangeTokenInput) (*LogoutOutput, error) {
+
+		token, err := rs.security.VerifyToken(ctx, input.Body.Token, security.EmailChangeToken)
+		if err != nil {
+			return nil, huma.Error401Unauthorized("Invalid or expired token")
+		}
+
+		user, err := rs.repo.GetUserPendingEmail(ctx, token.UserID)
+		if err != nil || user.PendingEmail == "" {
+			return nil, huma.Error401Unauthorized("Invalid or expired token")
+		}
+
+		// The address could have been registered since the request.
+		if _, err := rs.repo.GetUserByEmail(ctx, user.PendingEmail); err == nil {
+			rs.cancelEmailChange(ctx, user.ID)
+			return nil, huma.Error409Conflict("This email address is already in use")
+		}
+
+		n, err := rs.repo.ApplyPendingEmail(ctx, user.ID)
+		if err != nil || n == 0 {
+			return nil, huma.Error409Conflict("Cannot change email")
+		}
+		rs.security.RevokeUserTokens(ctx, user.ID)
+		rs.noticeEmailChanged(ctx, user.ID, user.Role, user.Email, user.PendingEmail)
+
+		return &LogoutOutput{
+			SetCookie: setCookies(
+				*rs.security.DeleteCookie(),
+				*rs.security.DeleteRefreshCookie(),
+			),
+			Status: http.StatusOK,
+		}, nil
+	})
+}
+
+func (rs *ApiHandlers) RegisterCancelEmailChange(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "cancel-email-change",
+		Summary:     "Cancel email change",
+		Description: "Cancels the pending email change using the token sent to the old address. Since someone else may have requested the change, all sessions of the user are signed out as well.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/change-email/cancel",
+		Tags:        []string{"Auth"},
+		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.Verify)},
+		Errors: []int{
+			http.StatusUnauthorized,
+		},
+	}, func(ctx context.Context, input *EmailChangeTokenInput) (*StatusOutput, error) {
+
+		token, err := rs.security.VerifyToken(ctx, input.Body.Token, security.EmailCancelToken)
+		if err != nil {
+			return nil, huma.Error401Unauthorized("Invalid or expired token")
+		}
+
+		if err := rs.cancelEmailChange(ctx, token.UserID); err != nil {
+			return nil, huma.Error500InternalServerError("Cannot cancel email change")
+		}
+		rs.security.RevokeUserTokens(ctx, token.UserID)
+
+		return &StatusOutput{Status: http.StatusOK}, nil
+	})
+}
+
+func (rs *ApiHandlers) cancelEmailChange(ctx context.Context, userID uuid.UUID) error {
+	err := rs.repo.SetUserPendingEmail(ctx, store.SetUserPendingEmailParams{
+		PendingEmail: "",
+		ID:           userID,
+	})
+	if err != nil {
+		return err
+	}
+	rs.security.RevokeUserTokensOfType(ctx, userID, security.EmailChangeToken)
+	return rs.security.RevokeUserTokensOfType(ctx, userID, security.EmailCancelToken)
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"huma-app/lib/audit"
+	"huma-app/lib/config"
+	"huma-app/store"
+	"huma-app/store/types"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	errNoEmail          = errors.New("Identity provider did not return an email")
+	errEmailNotVerified = errors.New("Email is not verified by the identity provider")
+	errInviteOnly       = errors.New("Registration is by invitation only")
+	errLinkByAdmin      = errors.New("An account with this email already exists, ask an admin to link it")
+)
+
+// externalIdentity is a user asserted by an identity provider or checked by a
+// login backend.
+type externalIdentity struct {
+	Provider string
+	Subject  string
+	Email    string
+	// EmailVerified tells whether the source vouches for the email. Only then
+	// is the identity linked to an existing user, and a new user verified.
+	EmailVerified bool
+	// Login is the email entered at a login backend, empty for identity
+	// providers, see canLink.
+	Login string
+	// Provisions lets the source create users even when registration is
+	// invite-only, as it decides who may log in.
+	Provisions bool
+	// ManagesRole tells whether the source decides the role of the users it
+	// created. Role is then the mapped one, or empty for the user role.
+	ManagesRole bool
+	Role        types.Role
+}
+
+// externalUser resolves the local user of an external identity. Known
+// identities map to their user; otherwise the identity is linked to the user
+// with the same email if canLink allows it, or a user without a password is
+// created. When the source manages roles, the role of the users it created is
+// brought in line with the mapped one and sessions with the previous role are
+// revoked. Accounts it did not create keep their role.
+func (rs *ApiHandlers) externalUser(ctx context.Context, identity externalIdentity) (*store.GetUserByIdentityRow, error) {
+	user, err := rs.repo.GetUserByIdentity(ctx, store.GetUserByIdentityParams{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+	})
+	switch {
+	case err == nil:
+		// A known identity.
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	default:
+		if user, err = rs.linkExternalUser(ctx, identity); err != nil {
+			return nil, err
+		}
+	}
+
+	if !identity.ManagesRole || user.Provisioned == 0 {
+		return &user, nil
+	}
+	role := types.RoleUser
+	if identity.Role != "" {
+		if _, err := rs.repo.GetRole(ctx, identity.Role); err != nil {
+			slog.Error("role mapping names an unknown role", "provider", identity.Provider, "role", identity.Role)
+		} else {
+			role = identity.Role
+		}
+	}
+	if role != user.Role {
+		if err := rs.repo.SetUserRole(ctx, store.SetUserRoleParams{Role: role, ID: user.ID}); err != nil {
+			return nil, err
+		}
+		rs.audit.Record(ctx, audit.Event{
+			Actor:    user.ID,
+			Action:   audit.ActionSetUserRole,
+			Target:   user.ID.String(),
+			Metadata: map[string]any{"from": user.Role, "to": role, "provider": identity.Provider},
+		})
+		if err := rs.security.RevokeUserTokens(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		user.Role = role
+	}
+	return &user, nil
+}
+
+// linkExternalUser links a new identity to the user with its email, or to a
+// new user if there is none.
+func (rs *ApiHandlers) linkExternalUser(ctx context.Context, identity externalIdentity) (store.GetUserByIdentityRow, error) {
+	var user store.GetUserByIdentityRow
+	if identity.Email == "" {
+		return user, errNoEmail
+	}
+	existing, err := rs.repo.GetUserByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		if err := rs.canLink(ctx, identity, existing); err != nil {
+			slog.Warn("identity not linked", "provider", identity.Provider, "subject", identity.Subject, "user_id", existing.ID, "reason", err)
+			return user, err
+		}
+		user = store.GetUserByIdentityRow{ID: existing.ID, Email: existing.Email, Role: existing.Role, Active: existing.Active, TotpEnabled: existing.TotpEnabled}
+	case errors.Is(err, sql.ErrNoRows):
+		if config.Get().Auth.InviteOnly && !identity.Provisions {
+			return user, errInviteOnly
+		}
+		created, err := rs.repo.CreateUser(ctx, store.CreateUserParams{
+			ID:    uuid.New(),
+			Email: identity.Email,
+		})
+		if err != nil {
+			return user, err
+		}
+		if identity.EmailVerified {
+			if err := rs.repo.VerifyUser(ctx, created.ID); err != nil {
+				return user, err
+			}
+		}
+		rs.audit.Record(ctx, audit.Event{
+			Actor:    created.ID,
+			Action:   audit.ActionProvisionUser,
+			Target:   created.ID.String(),
+			Metadata: map[string]any{"email": created.Email, "provider": identity.Provider},
+		})
+		user = store.GetUserByIdentityRow{ID: created.ID, Email: created.Email, Role: created.Role, Active: 1, Provisioned: 1}
+	default:
+		return user, err
+	}
+
+	err = rs.repo.CreateUserIdentity(ctx, store.CreateUserIdentityParams{
+		UserID:      user.ID,
+		Provider:    identity.Provider,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		Provisioned: user.Provisioned,
+	})
+	return user, err
+}
+
+// canLink decides whether a new identity may take over the existing user with
+// its email. Identity providers have to vouch for the email. A login backend
+// only has its own word for it, LDAP takes it from a directory attribute, so
+// it is linked to the account of the login it checked and only to one with
+// neither a password nor another identity. Anything else is for an admin to
+// link, see link-user-identity.
+func (rs *ApiHandlers) canLink(ctx context.Context, identity externalIdentity, existing store.GetUserByEmailRow) error {
+	if !identity.EmailVerified {
+		return errEmailNotVerified
+	}
+	if identity.Login == "" {
+		return nil
+	}
+	if !strings.EqualFold(identity.Email, identity.Login) || existing.Password != "" {
+		return errLinkByAdmin
+	}
+	providers, err := rs.repo.GetUserIdentityProviders(ctx, existing.ID)
+	if err != nil {
+		return err
+	}
+	if len(providers) > 0 {
+		return errLinkByAdmin
+	}
+	return nil
+}
+
+// finishRedirectLogin completes a login that came back from an identity
+// provider through finishLogin, so two-factor authentication applies as for a
+// password. Instead of a challenge in the body, users with two-factor
+// authentication are redirected to the frontend with it; everyone else gets
+// the session cookies and the app. clearState drops the cookie of the login
+// state.
+func (rs *ApiHandlers) finishRedirectLogin(ctx context.Context, method string, user *store.GetUserByIdentityRow, status int, clearState http.Cookie) (*RedirectOutput, error) {
+	if err := rs.denyInactive(ctx, user.ID, user.Email, user.Active); err != nil {
+		return nil, err
+	}
+	login, err := rs.finishLogin(ctx, method, user.ID, user.Role, user.TotpEnabled == 1)
+	if err != nil {
+		return nil, err
+	}
+	location := config.Get().Frontend.Urls.App
+	if login.Body != nil && login.Body.TwoFactorRequired {
+		location = fmt.Sprintf(config.Get().Frontend.Urls.TwoFactor, login.Body.Challenge)
+	}
+	return &RedirectOutput{
+		Status:    status,
+		Location:  location,
+		SetCookie: append(login.SetCookie, clearState.String()),
+	}, nil
+}
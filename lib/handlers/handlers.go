@@ -1,29 +1,64 @@
 package handlers
 
 import (
+	"huma-app/lib/audit"
+	"huma-app/lib/authn"
+	"huma-app/lib/config"
 	"huma-app/lib/middleware"
+	"huma-app/lib/password"
 	"huma-app/lib/security"
+	"huma-app/lib/sso"
 	"huma-app/store"
+	"log"
 	"time"
 
 	"golang.org/x/time/rate"
 )
 
 type RateLimiter struct {
-	Login  *middleware.IPRateLimiter
-	Verify *middleware.IPRateLimiter
+	Login     *middleware.IPRateLimiter
+	Refresh   *middleware.IPRateLimiter
+	Verify    *middleware.IPRateLimiter
+	Forgot    *middleware.IPRateLimiter
+	Reset     *middleware.IPRateLimiter
+	TwoFactor *middleware.IPRateLimiter
+	Resend    *middleware.IPRateLimiter
+	MagicLink *middleware.IPRateLimiter
+	Invite    *middleware.IPRateLimiter
 }
 
 type ApiHandlers struct {
 	repo     *store.Queries
 	security *security.Security
 	limiter  *RateLimiter
+	oidc     sso.OidcProviders
+	saml     sso.SamlProviders
+	hasher   *password.Hasher
+	policy   *password.Policy
+	audit    *audit.Logger
+	authn    authn.Chain
 }
 
 func NewApiHandlers(repo *store.Queries, security *security.Security) *ApiHandlers {
 
+	hasher, err := password.NewHasher(config.Get().PasswordHash)
+	if err != nil {
+		log.Fatalf("error configuring password hashing: %s", err)
+	}
+	chain, err := authn.New(config.Get(), repo, hasher)
+	if err != nil {
+		log.Fatalf("error configuring login backends: %s", err)
+	}
+
 	return &ApiHandlers{repo, security, &RateLimiter{
-		Login:  middleware.NewIPRateLimiter(rate.Every(time.Minute), 2),
-		Verify: middleware.NewIPRateLimiter(rate.Every(time.Minute), 1),
-	}}
+		Login:     middleware.NewIPRateLimiter(rate.Every(time.Minute), 2),
+		Refresh:   middleware.NewIPRateLimiter(rate.Every(10*time.Second), 10),
+		Verify:    middleware.NewIPRateLimiter(rate.Every(time.Minute), 1),
+		Forgot:    middleware.NewIPRateLimiter(rate.Every(time.Minute), 1),
+		Reset:     middleware.NewIPRateLimiter(rate.Every(time.Minute), 2),
+		TwoFactor: middleware.NewIPRateLimiter(rate.Every(time.Minute), 5),
+		Resend:    middleware.NewIPRateLimiter(rate.Every(time.Minute), 1),
+		MagicLink: middleware.NewIPRateLimiter(rate.Every(time.Minute), 1),
+		Invite:    middleware.NewIPRateLimiter(rate.Every(time.Minute), 5),
+	}, sso.NewOidcProviders(config.Get().Oidc.Providers, nil), sso.NewSamlProviders(config.Get().Saml.Providers, nil), hasher, password.NewPolicy(config.Get().PasswordPolicy, hasher), audit.NewLogger(repo), chain}
 }
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"huma-app/lib/audit"
+	"huma-app/lib/security"
+	"log/slog"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+type ImpersonateUserInput struct {
+	AuthHeader
+	ID uuid.UUID `path:"id"`
+}
+
+func (rs *ApiHandlers) RegisterImpersonateUser(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "impersonate-user",
+		Summary:     "Impersonate user",
+		Description: "Replaces the access cookie with one for the given user, carrying the admin as impersonator. The refresh cookie of the admin is kept, so ending the impersonation or refreshing returns to the admin session. Account changes like password, email or two-factor settings are blocked while impersonating.",
+		Method:      http.MethodPost,
+		Path:        "/api/users/{id}/impersonate",
+		Tags:        []string{"Users"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermUsersImpersonate}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *ImpersonateUserInput) (*LoginOutput, error) {
+
+		if input.ID == input.UserId {
+			return nil, huma.Error400BadRequest("Cannot impersonate yourself")
+		}
+		user, err := rs.repo.GetUserById(ctx, input.ID)
+		if err != nil {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		// Users who may impersonate others cannot be impersonated themselves,
+		// that would let one admin act as another.
+		if privileged, err := rs.security.HasPermissions(ctx, user.Role, []string{security.PermUsersImpersonate}); err != nil || privileged {
+			return nil, huma.Error403Forbidden("Admins cannot be impersonated")
+		}
+
+		cookie, err := rs.security.GenerateImpersonationCookie(ctx, input.UserId, user.ID, user.Role)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot issue token")
+		}
+		slog.Warn("impersonation started", "admin_id", input.UserId, "user_id", user.ID)
+		rs.audit.Record(ctx, audit.Event{
+			Action: audit.ActionImpersonate,
+			Target: user.ID.String(),
+		})
+
+		return &LoginOutput{
+			SetCookie: setCookies(*cookie),
+			Status:    http.StatusNoContent,
+		}, nil
+	})
+}
+
+type EndImpersonationInput struct {
+	AuthHeader
+	Refresh http.Cookie `cookie:"refresh"`
+}
+
+func (rs *ApiHandlers) RegisterEndImpersonation(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "end-impersonation",
+		Summary:     "End impersonation",
+		Description: "Revokes the impersonation token and restores the admin session from the refresh cookie. Without a valid refresh cookie the admin is logged out.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/impersonation/end",
+		Tags:        []string{"Auth"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+		},
+	}, func(ctx context.Context, input *EndImpersonationInput) (*LoginOutput, error) {
+
+		if input.Impersonator == uuid.Nil {
+			return nil, huma.Error400BadRequest("Not impersonating")
+		}
+		if err := rs.security.RevokeTokenFamily(ctx, input.Family); err != nil {
+			return nil, huma.Error500InternalServerError("Cannot revoke token")
+		}
+		slog.Warn("impersonation ended", "admin_id", input.Impersonator, "user_id", input.UserId)
+
+		claims, err := rs.security.RotateRefreshToken(ctx, input.Refresh.Value)
+		if err != nil || claims.UserID != input.Impersonator {
+			return &LoginOutput{
+				SetCookie: setCookies(*rs.security.DeleteCookie()),
+				Status:    http.StatusOK,
+			}, nil
+		}
+
+		cookies, err := rs.security.GenerateSessionCookies(ctx, claims.UserID, claims.UserRole, claims.FamilyID, rs.keepActiveOrg(ctx, claims)...)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot issue token")
+		}
+		return &LoginOutput{
+			SetCookie: setCookies(cookies...),
+			Status:    http.StatusNoContent,
+		}, nil
+	})
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"huma-app/lib/config"
+	"huma-app/lib/mail"
+	"huma-app/lib/middleware"
+	"huma-app/lib/security"
+	"huma-app/store"
+	"huma-app/store/types"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+// invitationTTL is how long an invitation link works. Resending an
+// invitation issues a new link with a new deadline.
+const invitationTTL = 7 * 24 * time.Hour
+
+type InvitationOutputBody struct {
+	ID        uuid.UUID  `json:"id"`
+	Email     string     `json:"email"`
+	Role      types.Role `json:"role"`
+	InvitedBy uuid.UUID  `json:"invited_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	Expired   bool       `json:"expired"`
+}
+
+func invitationOutput(invitation store.Invitation) InvitationOutputBody {
+	return InvitationOutputBody{
+		ID:        invitation.ID,
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+		InvitedBy: invitation.InvitedBy,
+		CreatedAt: invitation.CreatedAt,
+		ExpiresAt: invitation.ExpiresAt,
+		Expired:   time.Now().After(invitation.ExpiresAt),
+	}
+}
+
+type InvitationOutput struct {
+	Body InvitationOutputBody
+}
+
+func (rs *ApiHandlers) sendInvitationMail(email, token string, expiresAt time.Time) error {
+	return mail.SendInvitationMail(email, mail.InvitationParams{
+		AppName: config.Get().Api.Name,
+		Link:    fmt.Sprintf(config.Get().Frontend.Urls.Invitation, token),
+		Until:   expiresAt.Local().Format("02.01.2006 15:04"),
+	})
+}
+
+type CreateInvitationInput struct {
+	AuthHeader
+	Body struct {
+		Email string     `json:"email" format:"email" required:"true"`
+		Role  types.Role `json:"role,omitempty" doc:"Role of the new account. Defaults to user"`
+	}
+}
+
+func (rs *ApiHandlers) RegisterCreateInvitation(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID:   "create-invitation",
+		Summary:       "Invite user",
+		Description:   "Emails an invitation to create an account with the given role. Inviting the same address again replaces the invitation and invalidates the previous link. A role can only be given by someone who has all of its permissions.",
+		Method:        http.MethodPost,
+		Path:          "/api/invitations",
+		Tags:          []string{"Invitations"},
+		DefaultStatus: http.StatusCreated,
+		Security: []map[string][]string{
+			{"Bearer": {security.PermUsersInvite}},
+		},
+		Errors: []int{
+			http.StatusForbidden,
+			http.StatusConflict,
+			http.StatusUnprocessableEntity,
+		},
+	}, func(ctx context.Context, input *CreateInvitationInput) (*InvitationOutput, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		role := input.Body.Role
+		if role == "" {
+			role = types.RoleUser
+		}
+		if _, err := rs.repo.GetRole(ctx, role); err != nil {
+			return nil, huma.Error422UnprocessableEntity("Unknown role", &huma.ErrorDetail{
+				Location: "body.role",
+				Message:  "Unknown role",
+				Value:    role,
+			})
+		}
+		permissions, err := rs.repo.GetRolePermissions(ctx, role)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot get permissions")
+		}
+		if covered, err := rs.security.HasPermissions(ctx, input.Role, permissions); err != nil || !covered {
+			return nil, huma.Error403Forbidden("Cannot give a role with permissions you do not have")
+		}
+		if _, err := rs.repo.GetUserByEmail(ctx, input.Body.Email); err == nil {
+			return nil, huma.Error409Conflict("This email address is already in use")
+		}
+
+		token, hash, err := security.GenerateInvitationToken()
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot create invitation")
+		}
+		invitation, err := rs.repo.CreateInvitation(ctx, store.CreateInvitationParams{
+			ID:        uuid.New(),
+			Email:     input.Body.Email,
+			Role:      role,
+			TokenHash: hash,
+			InvitedBy: input.UserId,
+			ExpiresAt: time.Now().Add(invitationTTL).UTC(),
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot create invitation")
+		}
+		if err := rs.sendInvitationMail(invitation.Email, token, invitation.ExpiresAt); err != nil {
+			rs.repo.DeleteInvitation(ctx, invitation.ID)
+			return nil, huma.Error500InternalServerError("Cannot send invitation")
+		}
+		return &InvitationOutput{Body: invitationOutput(invitation)}, nil
+	})
+}
+
+type GetInvitationsOutput struct {
+	Body []InvitationOutputBody
+}
+
+func (rs *ApiHandlers) RegisterGetInvitations(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-invitations",
+		Summary:     "Get invitations",
+		Description: "Lists invitations that were not accepted yet, including expired ones, newest first.",
+		Method:      http.MethodGet,
+		Path:        "/api/invitations",
+		Tags:        []string{"Invitations"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermUsersInvite}},
+		},
+	}, func(ctx context.Context, input *struct{}) (*GetInvitationsOutput, error) {
+		rows, err := rs.repo.GetInvitations(ctx)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot get invitations")
+		}
+		invitations := make([]InvitationOutputBody, len(rows))
+		for i, row := range rows {
+			invitations[i] = invitationOutput(row)
+		}
+		return &GetInvitationsOutput{Body: invitations}, nil
+	})
+}
+
+type InvitationInput struct {
+	AuthHeader
+	ID uuid.UUID `path:"id"`
+}
+
+func (rs *ApiHandlers) RegisterResendInvitation(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "resend-invitation",
+		Summary:     "Resend invitation",
+		Description: "Emails a new link for the invitation and extends its deadline. The previous link stops working.",
+		Method:      http.MethodPost,
+		Path:        "/api/invitations/{id}/resend",
+		Tags:        []string{"Invitations"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermUsersInvite}},
+		},
+		Errors: []int{
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *InvitationInput) (*InvitationOutput, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		token, hash, err := security.GenerateInvitationToken()
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot renew invitation")
+		}
+		invitation, err := rs.repo.RenewInvitation(ctx, store.RenewInvitationParams{
+			TokenHash: hash,
+			ExpiresAt: time.Now().Add(invitationTTL).UTC(),
+			ID:        input.ID,
+		})
+		if err != nil {
+			return nil, huma.Error404NotFound("Invitation not found")
+		}
+		if err := rs.sendInvitationMail(invitation.Email, token, invitation.ExpiresAt); err != nil {
+			return nil, huma.Error500InternalServerError("Cannot send invitation")
+		}
+		return &InvitationOutput{Body: invitationOutput(invitation)}, nil
+	})
+}
+
+func (rs *ApiHandlers) RegisterRevokeInvitation(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "revoke-invitation",
+		Summary:     "Revoke invitation",
+		Method:      http.MethodDelete,
+		Path:        "/api/invitations/{id}",
+		Tags:        []string{"Invitations"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermUsersInvite}},
+		},
+		Errors: []int{
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *InvitationInput) (*struct{}, error) {
+		n, err := rs.repo.DeleteInvitation(ctx, input.ID)
+		if err != nil || n == 0 {
+			return nil, huma.Error404NotFound("Invitation not found")
+		}
+		return nil, nil
+	})
+}
+
+// openInvitation returns the invitation the token belongs to, if it has not
+// expired.
+func (rs *ApiHandlers) openInvitation(ctx context.Context, token string) (*store.Invitation, error) {
+	invitation, err := rs.repo.GetInvitationByTokenHash(ctx, security.HashInvitationToken(token))
+	if err != nil || time.Now().After(invitation.ExpiresAt) {
+		return nil, huma.Error400BadRequest("Invitation is invalid or expired")
+	}
+	return &invitation, nil
+}
+
+type LookupInvitationInput struct {
+	Token string `query:"token" required:"true"`
+}
+
+type LookupInvitationOutput struct {
+	Body struct {
+		Email     string     `json:"email"`
+		Role      types.Role `json:"role"`
+		ExpiresAt time.Time  `json:"expires_at"`
+	}
+}
+
+func (rs *ApiHandlers) RegisterLookupInvitation(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "lookup-invitation",
+		Summary:     "Look up invitation",
+		Description: "Returns the address an invitation link is for, so the accept form can show it.",
+		Method:      http.MethodGet,
+		Path:        "/api/invitations/lookup",
+		Tags:        []string{"Invitations"},
+		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.Invite)},
+		Errors: []int{
+			http.StatusBadRequest,
+		},
+	}, func(ctx context.Context, input *LookupInvitationInput) (*LookupInvitationOutput, error) {
+		invitation, err := rs.openInvitation(ctx, input.Token)
+		if err != nil {
+			return nil, err
+		}
+		out := &LookupInvitationOutput{}
+		out.Body.Email = invitation.Email
+		out.Body.Role = invitation.Role
+		out.Body.ExpiresAt = invitation.ExpiresAt
+		return out, nil
+	})
+}
+
+type AcceptInvitationInput struct {
+	Body struct {
+		Token    string `json:"token" required:"true"`
+		Password string `json:"password" required:"true"`
+	}
+}
+
+func (rs *ApiHandlers) RegisterAcceptUserInvitation(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "accept-user-invitation",
+		Summary:     "Accept invitation",
+		Description: "Creates the invited account with the given password and signs it in. The address counts as verified, the invitation mail proved it.",
+		Method:      http.MethodPost,
+		Path:        "/api/invitations/accept",
+		Tags:        []string{"Invitations"},
+		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.Invite)},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusConflict,
+			http.StatusUnprocessableEntity,
+		},
+	}, func(ctx context.Context, input *AcceptInvitationInput) (*LoginOutput, error) {
+		invitation, err := rs.openInvitation(ctx, input.Body.Token)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := rs.repo.GetUserByEmail(ctx, invitation.Email); err == nil {
+			return nil, huma.Error409Conflict("This email address is already in use")
+		}
+		if err := rs.checkPassword("body.password", input.Body.Password, invitation.Email); err != nil {
+			return nil, err
+		}
+		hash, err := rs.hasher.Hash(input.Body.Password)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot create user")
+		}
+		// Deleting first makes the link single-use even if two requests race.
+		if n, err := rs.repo.DeleteInvitation(ctx, invitation.ID); err != nil || n == 0 {
+			return nil, huma.Error400BadRequest("Invitation is invalid or expired")
+		}
+		user, err := rs.repo.CreateUser(ctx, store.CreateUserParams{
+			ID:       uuid.New(),
+			Email:    invitation.Email,
+			Password: hash,
+		})
+		if err != nil {
+			return nil, huma.Error400BadRequest(err.Error())
+		}
+		if err := rs.repo.SetUserRole(ctx, store.SetUserRoleParams{Role: invitation.Role, ID: user.ID}); err != nil {
+			return nil, huma.Error500InternalServerError("Cannot set role")
+		}
+		if err := rs.repo.VerifyUser(ctx, user.ID); err != nil {
+			return nil, huma.Error500InternalServerError("Cannot verify user")
+		}
+		return rs.finishLogin(ctx, "invitation", user.ID, invitation.Role, false)
+	})
+}
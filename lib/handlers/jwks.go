@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"context"
+	"huma-app/lib/security"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+type JWKSOutput struct {
+	CacheControl string `header:"Cache-Control"`
+	Body         security.JWKS
+}
+
+func (rs *ApiHandlers) RegisterJWKS(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "jwks",
+		Summary:     "JSON Web Key Set",
+		Description: "Public keys for verifying tokens issued by this service. Keys with symmetric algorithms are never published.",
+		Method:      http.MethodGet,
+		Path:        "/.well-known/jwks.json",
+		Tags:        []string{"Auth"},
+	}, func(ctx context.Context, input *struct{}) (*JWKSOutput, error) {
+		return &JWKSOutput{
+			CacheControl: "public, max-age=300",
+			Body:         rs.security.JWKS(),
+		}, nil
+	})
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"huma-app/lib/config"
+	"huma-app/lib/mail"
+	"huma-app/lib/middleware"
+	"huma-app/lib/security"
+	"huma-app/store"
+	"huma-app/store/types"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+// checkLockout refuses a login attempt while the account is locked or still
+// waiting out the delay after the previous failure.
+func checkLockout(user store.GetUserByEmailRow) error {
+	if !user.LockedUntil.Valid {
+		return nil
+	}
+	wait := time.Until(user.LockedUntil.Time)
+	if wait <= 0 {
+		return nil
+	}
+	retry := http.Header{"Retry-After": {strconv.Itoa(int(math.Ceil(wait.Seconds())))}}
+	if user.FailedLogins >= config.Get().Auth.LockoutThreshold {
+		return huma.ErrorWithHeaders(huma.NewError(http.StatusLocked, "Account is temporarily locked"), retry)
+	}
+	return huma.ErrorWithHeaders(huma.Error429TooManyRequests("Too many failed attempts, try again later"), retry)
+}
+
+// recordLoginFailure counts a failed login. Every failure after the first one
+// delays the next attempt twice as long as the previous; reaching the
+// threshold locks the account and mails the owner an unlock link. The count
+// is only reset by a successful login, an unlock or a password reset, so
+// each failure after a lockout ran out locks the account again, with a new
+// mail.
+func (rs *ApiHandlers) recordLoginFailure(ctx context.Context, user store.GetUserByEmailRow) {
+	failures, err := rs.repo.IncrementFailedLogins(ctx, user.ID)
+	if err != nil {
+		slog.Error("cannot record failed login", "err", err)
+		return
+	}
+
+	cfg := config.Get().Auth
+	var delay time.Duration
+	switch {
+	case failures >= cfg.LockoutThreshold:
+		delay = cfg.LockoutDuration
+	case failures >= 2:
+		delay = cfg.LoginDelay << (failures - 2)
+	default:
+		return
+	}
+
+	until := time.Now().Add(delay).UTC()
+	err = rs.repo.SetUserLockedUntil(ctx, store.SetUserLockedUntilParams{
+		LockedUntil: sql.NullTime{Time: until, Valid: true},
+		ID:          user.ID,
+	})
+	if err != nil {
+		slog.Error("cannot lock user", "err", err)
+		return
+	}
+
+	if failures >= cfg.LockoutThreshold {
+		go func() {
+			err := rs.sendUnlockMail(context.WithoutCancel(ctx), user.ID, user.Role, user.Email, until)
+			if err != nil {
+				slog.Error("cannot send unlock mail", "err", err)
+			}
+		}()
+	}
+}
+
+func (rs *ApiHandlers) sendUnlockMail(ctx context.Context, userID uuid.UUID, role types.Role, email string, until time.Time) error {
+	token, err := rs.security.GenerateToken(ctx, security.UnlockToken, time.Until(until), userID, role)
+	if err != nil {
+		return err
+	}
+	return mail.SendUnlockMail(email, mail.UnlockEmailParams{
+		AppName: config.Get().Api.Name,
+		Link:    fmt.Sprintf(config.Get().Frontend.Urls.Unlock, token),
+		Until:   until.Local().Format("02.01.2006 15:04"),
+	})
+}
+
+type UnlockAccountInput struct {
+	Token string `query:"token"`
+}
+
+func (rs *ApiHandlers) RegisterUnlockAccount(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "unlock-account",
+		Summary:     "Unlock account",
+		Description: "Unlocks an account locked after too many failed logins, using the link from the lockout email.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/unlock",
+		Tags:        []string{"Auth"},
+		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.Verify)},
+		Errors: []int{
+			http.StatusUnauthorized,
+		},
+	}, func(ctx context.Context, input *UnlockAccountInput) (*StatusOutput, error) {
+
+		token, err := rs.security.VerifyToken(ctx, input.Token, security.UnlockToken)
+		if err != nil {
+			return nil, huma.Error401Unauthorized("Invalid or expired token")
+		}
+
+		if err := rs.repo.ResetFailedLogins(ctx, token.UserID); err != nil {
+			return nil, huma.Error500InternalServerError("Cannot unlock account")
+		}
+		rs.security.RevokeToken(ctx, token.ID)
+
+		return &StatusOutput{Status: http.StatusOK}, nil
+	})
+}
+
+type UnlockUserInput struct {
+	AuthHeader
+	ID uuid.UUID `path:"id"`
+}
+
+func (rs *ApiHandlers) RegisterUnlockUser(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "unlock-user",
+		Summary:     "Unlock user",
+		Description: "Clears failed login attempts of the user and lifts the lockout.",
+		Method:      http.MethodPost,
+		Path:        "/api/users/{id}/unlock",
+		Tags:        []string{"Users"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermUsersWrite}},
+		},
+	}, func(ctx context.Context, input *UnlockUserInput) (*struct{}, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		if _, err := rs.repo.GetUserById(ctx, input.ID); err != nil {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		if err := rs.repo.ResetFailedLogins(ctx, input.ID); err != nil {
+			return nil, huma.Error400BadRequest(err.Error())
+		}
+		return nil, nil
+	})
+}
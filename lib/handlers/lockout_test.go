@@ -0,0 +1,54 @@
+package handlers_test
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+)
+
+func failedLogins(t *testing.T, email string) (int, sql.NullTime) {
+	t.Helper()
+	var failures int
+	var lockedUntil sql.NullTime
+	err := db.QueryRow(`SELECT failed_logins, locked_until FROM users WHERE email = ?`, email).Scan(&failures, &lockedUntil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return failures, lockedUntil
+}
+
+func TestFailedLoginsDelayAndLock(t *testing.T) {
+	const email = "lockout@example.com"
+	createUser(t, email, true)
+
+	if res := login(email, "wrong"); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status %d", res.StatusCode)
+	}
+	if failures, lockedUntil := failedLogins(t, email); failures != 1 || lockedUntil.Valid {
+		t.Errorf("after one failure: %d failures, locked until %v", failures, lockedUntil)
+	}
+
+	if res := login(email, "wrong"); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("second wrong password: status %d", res.StatusCode)
+	}
+	if failures, lockedUntil := failedLogins(t, email); failures != 2 || !lockedUntil.Valid {
+		t.Errorf("after two failures: %d failures, locked until %v", failures, lockedUntil)
+	}
+	if res := login(email, testPassword); res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") == "" {
+		t.Errorf("during the delay: status %d, Retry-After %q", res.StatusCode, res.Header.Get("Retry-After"))
+	}
+
+	// Skip the delays up to the failure that reaches the threshold of 5.
+	if _, err := db.Exec(`UPDATE users SET failed_logins = 4, locked_until = NULL WHERE email = ?`, email); err != nil {
+		t.Fatal(err)
+	}
+	if res := login(email, "wrong"); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("fifth wrong password: status %d", res.StatusCode)
+	}
+	if failures, _ := failedLogins(t, email); failures != 5 {
+		t.Errorf("after five failures: %d failures", failures)
+	}
+	if res := login(email, testPassword); res.StatusCode != http.StatusLocked {
+		t.Errorf("right password while locked: status %d", res.StatusCode)
+	}
+}
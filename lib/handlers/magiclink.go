@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"huma-app/lib/config"
+	"huma-app/lib/mail"
+	"huma-app/lib/middleware"
+	"huma-app/lib/security"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+const magicLinkTTL = time.Minute * 15
+
+type MagicLinkInputBody struct {
+	Email string `format:"email" json:"email" required:"true"`
+}
+
+type MagicLinkInput struct {
+	Body MagicLinkInputBody
+}
+
+func (rs *ApiHandlers) RegisterMagicLink(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "magic-link",
+		Summary:     "Send login link",
+		Description: "Emails a single-use login link to the given address. Works for accounts without a password too. The response is the same whether the address is registered or not.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/magic-link",
+		Tags:        []string{"Auth"},
+		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.MagicLink)},
+		Errors: []int{
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *MagicLinkInput) (*StatusOutput, error) {
+
+		if !config.Get().Auth.MagicLink {
+			return nil, huma.Error404NotFound("Login by link is disabled")
+		}
+
+		user, err := rs.repo.GetUserByEmail(ctx, input.Body.Email)
+		if err != nil {
+			return &StatusOutput{Status: http.StatusOK}, nil
+		}
+
+		// Mail is sent in the background so response time does not reveal
+		// whether the address is registered.
+		go func() {
+			ctx := context.WithoutCancel(ctx)
+			token, err := rs.security.GenerateToken(ctx, security.MagicToken, magicLinkTTL, user.ID, user.Role)
+			if err == nil {
+				err = mail.SendMagicLinkMail(user.Email, mail.MagicLinkEmailParams{
+					AppName: config.Get().Api.Name,
+					Link:    fmt.Sprintf(config.Get().Frontend.Urls.Magic, token),
+				})
+			}
+			if err != nil {
+				slog.Error("cannot send magic link mail", "err", err)
+			}
+		}()
+
+		return &StatusOutput{Status: http.StatusOK}, nil
+	})
+}
+
+type MagicLinkLoginInputBody struct {
+	Token string `json:"token" required:"true"`
+}
+
+type MagicLinkLoginInput struct {
+	Body MagicLinkLoginInputBody
+}
+
+func (rs *ApiHandlers) RegisterMagicLinkLogin(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "magic-link-login",
+		Summary:     "Login by link",
+		Description: "Logs in with the token from the login link email, the same way as login does. The token can only be used once. Following the link also proves the email address, so it gets verified.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/magic-link/login",
+		Tags:        []string{"Auth"},
+		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.Verify)},
+		Errors: []int{
+			http.StatusUnauthorized,
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *MagicLinkLoginInput) (*LoginOutput, error) {
+
+		if !config.Get().Auth.MagicLink {
+			return nil, huma.Error404NotFound("Login by link is disabled")
+		}
+
+		token, err := rs.security.VerifyToken(ctx, input.Body.Token, security.MagicToken)
+		if err != nil {
+			return nil, huma.Error401Unauthorized("Invalid or expired token")
+		}
+		rs.security.RevokeToken(ctx, token.ID)
+
+		user, err := rs.repo.GetUserTotp(ctx, token.UserID)
+		if err != nil {
+			return nil, huma.Error401Unauthorized("Invalid or expired token")
+		}
+		if err := rs.denyInactive(ctx, user.ID, user.Email, user.Active); err != nil {
+			return nil, err
+		}
+		if err := rs.repo.VerifyUser(ctx, user.ID); err != nil {
+			return nil, huma.Error500InternalServerError("Cannot verify email")
+		}
+
+		return rs.finishLogin(ctx, "magic_link", user.ID, user.Role, user.TotpEnabled == 1)
+	})
+}
@@ -0,0 +1,160 @@
+package handlers_test
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"huma-app/lib/api"
+	"huma-app/store"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// The handlers are tested through the full API, configured once for the
+// package with in-process identity providers.
+var (
+	app  http.Handler
+	db   *sql.DB
+	oidc *mockOidc
+	idp  *mockSaml
+)
+
+const testConfig = `
+server:
+  host: localhost
+  port: 8888
+frontend:
+  path: %[1]s/index.html
+api:
+  name: Test
+  version: 1.0.0
+storage:
+  path: %[1]s/test.db
+auth:
+  require_verified_email: true
+secret:
+  active_key: test
+  keys:
+    - kid: test
+      alg: HS256
+      secret: %[2]s
+oidc:
+  providers:
+    - name: mock
+      discovery_url: %[3]s/.well-known/openid-configuration
+      client_id: app
+      client_secret: app-secret
+      redirect_url: http://app.test/api/auth/oidc/mock/callback
+saml:
+  providers:
+    - name: mock
+      root_url: http://app.test
+      idp_metadata_path: %[1]s/idp.xml
+      certificate_path: %[1]s/sp.crt
+      key_path: %[1]s/sp.key
+      email_attribute: mail
+      role_attribute: eduPersonAffiliation
+      role_mapping:
+        staff-admins: admin
+`
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "handlers")
+	if err != nil {
+		log.Fatal(err)
+	}
+	oidc = newMockOidc()
+	if idp, err = newMockSaml(dir); err != nil {
+		log.Fatal(err)
+	}
+
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	cfg := fmt.Sprintf(testConfig, dir, hex.EncodeToString(secret), oidc.URL)
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(cfg), 0600); err != nil {
+		log.Fatal(err)
+	}
+	os.Setenv("CONFIG_PATH", filepath.Join(dir, "config.yaml"))
+
+	db = store.InitDB()
+	if err := migrate(db); err != nil {
+		log.Fatal(err)
+	}
+	mux := chi.NewMux()
+	api.NewApi(db, mux)
+	app = mux
+
+	code := m.Run()
+	db.Close()
+	oidc.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// migrate applies the up part of every goose migration.
+func migrate(db *sql.DB) error {
+	files, err := filepath.Glob("../../store/migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		up, _, _ := strings.Cut(string(data), "-- +goose Down")
+		if _, err := db.Exec(up); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// clients numbers the addresses requests come from.
+var clients atomic.Uint32
+
+// serve runs a request against the API with the given cookies. Unless the
+// test sets X-Real-IP, every request comes from an address of its own, so the
+// rate limits stay out of the way.
+func serve(r *http.Request, cookies ...*http.Cookie) *http.Response {
+	if r.Header.Get("X-Real-IP") == "" {
+		n := clients.Add(1)
+		r.Header.Set("X-Real-IP", fmt.Sprintf("10.%d.%d.%d", n>>16&0xff, n>>8&0xff, n&0xff))
+	}
+	for _, cookie := range cookies {
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+	}
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, r)
+	return w.Result()
+}
+
+func responseCookie(res *http.Response, name string) *http.Cookie {
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// noRedirects is a client for the identity providers that hands redirects
+// back instead of following them.
+var noRedirects = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"huma-app/lib/audit"
+	"huma-app/lib/config"
+	"huma-app/lib/mail"
+	"huma-app/lib/middleware"
+	"huma-app/lib/security"
+	"huma-app/store"
+	"huma-app/store/types"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+// notMeTTL is how long the link in a security notice works.
+const notMeTTL = 7 * 24 * time.Hour
+
+// sendSecurityNotice mails the user about a change to their account. The
+// notice tells where the change came from and has a link that signs the
+// account out everywhere. Changes revoke the tokens of the user, so this has
+// to run after that, or the link is revoked with them.
+func (rs *ApiHandlers) sendSecurityNotice(ctx context.Context, userID uuid.UUID, role types.Role, send func(params mail.SecurityNoticeParams) error) {
+	token, err := rs.security.GenerateToken(ctx, security.NotMeToken, notMeTTL, userID, role)
+	if err != nil {
+		slog.Error("cannot issue token for security notice", "err", err)
+		return
+	}
+	ip, _ := ctx.Value("real-ip").(string)
+	userAgent, _ := ctx.Value("user-agent").(string)
+	params := mail.SecurityNoticeParams{
+		AppName: config.Get().Api.Name,
+		When:    time.Now().Local().Format("02.01.2006 15:04"),
+		Ip:      ip,
+		Device:  security.DescribeDevice(userAgent),
+		Link:    fmt.Sprintf(config.Get().Frontend.Urls.NotMe, token),
+	}
+	go func() {
+		if err := send(params); err != nil {
+			slog.Error("cannot send security notice", "err", err)
+		}
+	}()
+}
+
+func (rs *ApiHandlers) noticePasswordChanged(ctx context.Context, userID uuid.UUID, role types.Role, email string) {
+	rs.sendSecurityNotice(ctx, userID, role, func(params mail.SecurityNoticeParams) error {
+		return mail.SendPasswordChangedMail(email, params)
+	})
+}
+
+// noticeEmailChanged goes to the previous address, the new one is the one
+// that may have been taken over.
+func (rs *ApiHandlers) noticeEmailChanged(ctx context.Context, userID uuid.UUID, role types.Role, oldEmail, newEmail string) {
+	rs.sendSecurityNotice(ctx, userID, role, func(params mail.SecurityNoticeParams) error {
+		return mail.SendEmailChangedMail(oldEmail, mail.EmailChangedParams{
+			SecurityNoticeParams: params,
+			NewEmail:             newEmail,
+		})
+	})
+}
+
+func (rs *ApiHandlers) noticeTwoFactorChanged(ctx context.Context, userID uuid.UUID, enabled bool) {
+	user, err := rs.repo.GetUserById(ctx, userID)
+	if err != nil {
+		slog.Error("cannot get user for security notice", "err", err)
+		return
+	}
+	rs.sendSecurityNotice(ctx, user.ID, user.Role, func(params mail.SecurityNoticeParams) error {
+		return mail.SendTwoFactorChangedMail(user.Email, mail.TwoFactorChangedParams{
+			SecurityNoticeParams: params,
+			Enabled:              enabled,
+		})
+	})
+}
+
+// noticeNewDevice remembers the user agent and address of a login and mails
+// the user when the pair was not seen before. The first login of an account
+// only remembers it. Unlike the other notices this one can be turned off.
+func (rs *ApiHandlers) noticeNewDevice(ctx context.Context, userID uuid.UUID) {
+	ip, _ := ctx.Value("real-ip").(string)
+	userAgent, _ := ctx.Value("user-agent").(string)
+	device := store.TouchKnownDeviceParams{UserID: userID, UserAgent: userAgent, Ip: ip}
+	n, err := rs.repo.TouchKnownDevice(ctx, device)
+	if err != nil || n > 0 {
+		return
+	}
+	known, err := rs.repo.CountKnownDevices(ctx, userID)
+	if err != nil {
+		return
+	}
+	if err := rs.repo.CreateKnownDevice(ctx, store.CreateKnownDeviceParams(device)); err != nil {
+		slog.Error("cannot remember device", "err", err)
+		return
+	}
+	if known == 0 {
+		return
+	}
+	user, err := rs.repo.GetUserById(ctx, userID)
+	if err != nil || user.LoginNotices == 0 {
+		return
+	}
+	rs.sendSecurityNotice(ctx, user.ID, user.Role, func(params mail.SecurityNoticeParams) error {
+		return mail.SendNewLoginMail(user.Email, params)
+	})
+}
+
+type NotMeInput struct {
+	Body struct {
+		Token string `json:"token" required:"true"`
+	}
+}
+
+func (rs *ApiHandlers) RegisterNotMe(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "not-me",
+		Summary:     "Report unknown activity",
+		Description: "Signs the account out of every session using the link from a security notice. The user should change the password afterwards.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/not-me",
+		Tags:        []string{"Auth"},
+		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.Verify)},
+		Errors: []int{
+			http.StatusUnauthorized,
+		},
+	}, func(ctx context.Context, input *NotMeInput) (*LogoutOutput, error) {
+
+		token, err := rs.security.VerifyToken(ctx, input.Body.Token, security.NotMeToken)
+		if err != nil {
+			return nil, huma.Error401Unauthorized("Invalid or expired token")
+		}
+		if err := rs.security.RevokeUserTokens(ctx, token.UserID); err != nil {
+			return nil, huma.Error500InternalServerError("Cannot revoke sessions")
+		}
+		rs.audit.Record(ctx, audit.Event{
+			Actor:  token.UserID,
+			Action: audit.ActionRevokeSessions,
+			Target: token.UserID.String(),
+		})
+
+		return &LogoutOutput{
+			SetCookie: setCookies(
+				*rs.security.DeleteCookie(),
+				*rs.security.DeleteRefreshCookie(),
+			),
+			Status: http.StatusOK,
+		}, nil
+	})
+}
+
+type SecurityNoticesInput struct {
+	AuthHeader
+	Body struct {
+		LoginNotices bool `json:"login_notices" doc:"Mail a notice on login from a new device or address"`
+	}
+}
+
+func (rs *ApiHandlers) RegisterUpdateSecurityNotices(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "update-security-notices",
+		Summary:     "Set security notices",
+		Description: "Turns optional security notices on or off. Notices about password, email and two-factor changes are always sent.",
+		Method:      http.MethodPut,
+		Path:        "/api/auth/notices",
+		Tags:        []string{"Auth"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Errors: []int{
+			http.StatusUnauthorized,
+			http.StatusForbidden,
+		},
+	}, func(ctx context.Context, input *SecurityNoticesInput) (*StatusOutput, error) {
+
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		var enabled int64
+		if input.Body.LoginNotices {
+			enabled = 1
+		}
+		err := rs.repo.SetUserLoginNotices(ctx, store.SetUserLoginNoticesParams{
+			LoginNotices: enabled,
+			ID:           input.UserId,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot update notices")
+		}
+		return &StatusOutput{Status: http.StatusOK}, nil
+	})
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"huma-app/lib/config"
+	"huma-app/lib/security"
+	"huma-app/lib/sso"
+	"huma-app/store"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+const oidcStateCookieName = "oidc_state"
+
+// oidcState travels in a signed cookie between the login redirect and the
+// callback.
+type oidcState struct {
+	jwt.RegisteredClaims
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+type OidcProviderOutputBody struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+}
+
+type OidcProvidersOutput struct {
+	Body []OidcProviderOutputBody
+}
+
+func (rs *ApiHandlers) RegisterOidcProviders(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "oidc-providers",
+		Summary:     "Get SSO providers",
+		Method:      http.MethodGet,
+		Path:        "/api/auth/oidc",
+		Tags:        []string{"Auth"},
+	}, func(ctx context.Context, input *struct{}) (*OidcProvidersOutput, error) {
+		providers := []OidcProviderOutputBody{}
+		for _, cfg := range config.Get().Oidc.Providers {
+			p := rs.oidc[cfg.Name]
+			providers = append(providers, OidcProviderOutputBody{Name: p.Name(), Title: p.Title()})
+		}
+		return &OidcProvidersOutput{Body: providers}, nil
+	})
+}
+
+type OidcLoginInput struct {
+	Provider string `path:"provider"`
+}
+
+type RedirectOutput struct {
+	Status    int
+	Location  string   `header:"Location"`
+	SetCookie []string `header:"Set-Cookie"`
+}
+
+func (rs *ApiHandlers) RegisterOidcLogin(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "oidc-login",
+		Summary:     "SSO login",
+		Description: "Redirects to the identity provider using the authorization code flow with PKCE.",
+		Method:      http.MethodGet,
+		Path:        "/api/auth/oidc/{provider}/login",
+		Tags:        []string{"Auth"},
+		Errors: []int{
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *OidcLoginInput) (*RedirectOutput, error) {
+
+		provider, ok := rs.oidc[input.Provider]
+		if !ok {
+			return nil, huma.Error404NotFound("Unknown provider")
+		}
+
+		state, err := security.RandomString(24)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot start login")
+		}
+		nonce, err := security.RandomString(24)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot start login")
+		}
+		verifier := oauth2.GenerateVerifier()
+
+		url, err := provider.AuthCodeURL(state, nonce, verifier)
+		if err != nil {
+			return nil, huma.Error502BadGateway("Identity provider is not available")
+		}
+
+		signed, err := rs.security.SignClaims(oidcState{
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 10)),
+			},
+			Provider: provider.Name(),
+			State:    state,
+			Nonce:    nonce,
+			Verifier: verifier,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot start login")
+		}
+
+		return &RedirectOutput{
+			Status:   http.StatusFound,
+			Location: url,
+			SetCookie: setCookies(http.Cookie{
+				Name:     oidcStateCookieName,
+				Value:    signed,
+				Path:     "/api/auth/oidc",
+				MaxAge:   int((time.Minute * 10).Seconds()),
+				HttpOnly: true,
+				Secure:   true,
+				// Lax, since the cookie has to come back with the redirect
+				// from the identity provider.
+				SameSite: http.SameSiteLaxMode,
+			}),
+		}, nil
+	})
+}
+
+type OidcCallbackInput struct {
+	Provider string      `path:"provider"`
+	Code     string      `query:"code"`
+	State    string      `query:"state"`
+	Error    string      `query:"error"`
+	Cookie   http.Cookie `cookie:"oidc_state"`
+}
+
+func (rs *ApiHandlers) RegisterOidcCallback(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "oidc-callback",
+		Summary:     "SSO callback",
+		Description: "Completes the login started by oidc-login. The user is found by the linked identity or by verified email, or created, and gets the usual session cookies. Users with two-factor authentication are redirected to the two_factor frontend URL with a challenge for two-factor-verify instead.",
+		Method:      http.MethodGet,
+		Path:        "/api/auth/oidc/{provider}/callback",
+		Tags:        []string{"Auth"},
+		Errors: []int{
+			http.StatusUnauthorized,
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *OidcCallbackInput) (*RedirectOutput, error) {
+
+		provider, ok := rs.oidc[input.Provider]
+		if !ok {
+			return nil, huma.Error404NotFound("Unknown provider")
+		}
+		if input.Error != "" {
+			return nil, huma.Error401Unauthorized("Identity provider returned an error: " + input.Error)
+		}
+
+		var state oidcState
+		err := rs.security.ParseClaims(input.Cookie.Value, &state)
+		if err != nil || state.Provider != provider.Name() || state.State == "" || state.State != input.State {
+			return nil, huma.Error401Unauthorized("Invalid login state")
+		}
+
+		identity, err := provider.Exchange(ctx, input.Code, state.Verifier, state.Nonce)
+		if err != nil {
+			return nil, huma.Error401Unauthorized("Cannot verify identity")
+		}
+
+		user, err := rs.oidcUser(ctx, provider.Name(), identity)
+		if err != nil {
+			return nil, huma.Error401Unauthorized(err.Error())
+		}
+
+		return rs.finishRedirectLogin(ctx, "oidc:"+provider.Name(), user, http.StatusFound, http.Cookie{
+			Name:   oidcStateCookieName,
+			Value:  "",
+			Path:   "/api/auth/oidc",
+			MaxAge: -1,
+		})
+	})
+}
+
+// oidcUser resolves the local user for an external identity, see
+// externalUser. The identity is linked to the user with the same email only
+// if the provider verified it, and new users are created unless accounts are
+// invite-only.
+func (rs *ApiHandlers) oidcUser(ctx context.Context, provider string, identity *sso.OidcIdentity) (*store.GetUserByIdentityRow, error) {
+	return rs.externalUser(ctx, externalIdentity{
+		Provider:      provider,
+		Subject:       identity.Subject,
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+	})
+}
@@ -0,0 +1,300 @@
+package handlers_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockOidc is an OpenID Connect issuer that logs in as User and checks PKCE
+// like a real one.
+type mockOidc struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	User   oidcUser
+	grants map[string]oidcGrant
+}
+
+type oidcUser struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+type oidcGrant struct {
+	user      oidcUser
+	challenge string
+	nonce     string
+}
+
+func newMockOidc() *mockOidc {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	m := &mockOidc{key: key, grants: map[string]oidcGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/authorize", m.authorize)
+	mux.HandleFunc("/token", m.token)
+	mux.HandleFunc("/jwks", m.jwks)
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockOidc) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                                m.URL,
+		"authorization_endpoint":                m.URL + "/authorize",
+		"token_endpoint":                        m.URL + "/token",
+		"jwks_uri":                              m.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *mockOidc) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "pkce required", http.StatusBadRequest)
+		return
+	}
+	code := randomString()
+	m.mu.Lock()
+	m.grants[code] = oidcGrant{user: m.User, challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	m.mu.Unlock()
+
+	redirect, _ := url.Parse(q.Get("redirect_uri"))
+	redirect.RawQuery = url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (m *mockOidc) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	m.mu.Lock()
+	grant, ok := m.grants[r.Form.Get("code")]
+	delete(m.grants, r.Form.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            m.URL,
+		"sub":            grant.user.Subject,
+		"aud":            "app",
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          grant.nonce,
+		"email":          grant.user.Email,
+		"email_verified": grant.user.EmailVerified,
+	})
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+func (m *mockOidc) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "test",
+		"alg": "RS256",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+	}}})
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// oidcStart runs oidc-login and the issuer's authorization as user. It
+// returns the state cookie and the callback url the issuer redirected to.
+func oidcStart(t *testing.T, user oidcUser) (*http.Cookie, *url.URL) {
+	t.Helper()
+	res := serve(httptest.NewRequest(http.MethodGet, "/api/auth/oidc/mock/login", nil))
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("oidc-login: status %d", res.StatusCode)
+	}
+	state := responseCookie(res, "oidc_state")
+	if state == nil {
+		t.Fatal("oidc-login: no state cookie")
+	}
+
+	oidc.mu.Lock()
+	oidc.User = user
+	oidc.mu.Unlock()
+	res, err := noRedirects.Get(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d", res.StatusCode)
+	}
+	callback, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state, callback
+}
+
+func oidcCallback(callback *url.URL, state *http.Cookie) *http.Response {
+	return serve(httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil), state)
+}
+
+func TestOidcLogin(t *testing.T) {
+	state, callback := oidcStart(t, oidcUser{Subject: "oidc-login", Email: "oidc-login@example.com", EmailVerified: true})
+
+	res := oidcCallback(callback, state)
+	if res.StatusCode != http.StatusFound || res.Header.Get("Location") != "/app" {
+		t.Fatalf("callback: status %d, location %q", res.StatusCode, res.Header.Get("Location"))
+	}
+	if cookie := responseCookie(res, "jwt"); cookie == nil || cookie.Value == "" {
+		t.Error("callback: no session cookie")
+	}
+	if cookie := responseCookie(res, "oidc_state"); cookie == nil || cookie.MaxAge >= 0 {
+		t.Error("callback: state cookie not cleared")
+	}
+
+	var linked int
+	err := db.QueryRow(`SELECT count(*) FROM user_identities i JOIN users u ON u.id = i.user_id
+		WHERE i.provider = 'mock' AND i.subject = 'oidc-login' AND u.email = 'oidc-login@example.com'`).Scan(&linked)
+	if err != nil || linked != 1 {
+		t.Errorf("identity not linked: %d, %v", linked, err)
+	}
+}
+
+func TestOidcCallbackChecksState(t *testing.T) {
+	state, callback := oidcStart(t, oidcUser{Subject: "oidc-state", Email: "oidc-state@example.com", EmailVerified: true})
+
+	forged := *callback
+	query := forged.Query()
+	query.Set("state", "forged")
+	forged.RawQuery = query.Encode()
+	if res := oidcCallback(&forged, state); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("forged state: status %d", res.StatusCode)
+	}
+
+	if res := oidcCallback(callback, nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("no state cookie: status %d", res.StatusCode)
+	}
+
+	tampered := *state
+	tampered.Value += "x"
+	if res := oidcCallback(callback, &tampered); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("tampered state cookie: status %d", res.StatusCode)
+	}
+}
+
+func TestOidcCallbackRejectsCodeOfAnotherLogin(t *testing.T) {
+	user := oidcUser{Subject: "oidc-pkce", Email: "oidc-pkce@example.com", EmailVerified: true}
+	_, first := oidcStart(t, user)
+	state, second := oidcStart(t, user)
+
+	// The code of the first login with the state of the second one: the
+	// state matches, but the verifier and the nonce in the cookie belong to
+	// the second login, so the issuer refuses the code and the id token
+	// would not match either. TestOidcLogin covers the verifier on its own,
+	// as the issuer only hands out tokens for a matching one.
+	swapped := *second
+	query := swapped.Query()
+	query.Set("code", first.Query().Get("code"))
+	swapped.RawQuery = query.Encode()
+	if res := oidcCallback(&swapped, state); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("code of another login: status %d", res.StatusCode)
+	}
+}
+
+func TestOidcDoesNotLinkUnverifiedEmail(t *testing.T) {
+	state, callback := oidcStart(t, oidcUser{Subject: "oidc-first", Email: "oidc-taken@example.com", EmailVerified: true})
+	if res := oidcCallback(callback, state); res.StatusCode != http.StatusFound {
+		t.Fatalf("first login: status %d", res.StatusCode)
+	}
+
+	state, callback = oidcStart(t, oidcUser{Subject: "oidc-other", Email: "oidc-taken@example.com", EmailVerified: false})
+	if res := oidcCallback(callback, state); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unverified email of an existing user: status %d", res.StatusCode)
+	}
+}
+
+func TestOidcRefusesDeactivatedUser(t *testing.T) {
+	user := oidcUser{Subject: "oidc-inactive", Email: "oidc-inactive@example.com", EmailVerified: true}
+	state, callback := oidcStart(t, user)
+	if res := oidcCallback(callback, state); res.StatusCode != http.StatusFound {
+		t.Fatalf("first login: status %d", res.StatusCode)
+	}
+	if _, err := db.Exec(`UPDATE users SET active = 0 WHERE email = ?`, user.Email); err != nil {
+		t.Fatal(err)
+	}
+
+	state, callback = oidcStart(t, user)
+	res := oidcCallback(callback, state)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("deactivated user: status %d", res.StatusCode)
+	}
+	if responseCookie(res, "jwt") != nil {
+		t.Error("deactivated user got a session cookie")
+	}
+	if n := loginFailures(t, user.Email, "inactive"); n != 1 {
+		t.Errorf("audited refusals: %d", n)
+	}
+}
+
+func TestOidcAsksForSecondFactor(t *testing.T) {
+	user := oidcUser{Subject: "oidc-totp", Email: "oidc-totp@example.com", EmailVerified: true}
+	state, callback := oidcStart(t, user)
+	if res := oidcCallback(callback, state); res.StatusCode != http.StatusFound {
+		t.Fatalf("first login: status %d", res.StatusCode)
+	}
+	secret := enableTotp(t, user.Email)
+
+	state, callback = oidcStart(t, user)
+	res := oidcCallback(callback, state)
+	location, _ := url.Parse(res.Header.Get("Location"))
+	if res.StatusCode != http.StatusFound || location == nil || location.Path != "/2fa" {
+		t.Fatalf("callback: status %d, location %q", res.StatusCode, res.Header.Get("Location"))
+	}
+	if responseCookie(res, "jwt") != nil {
+		t.Error("callback: session cookie before the second factor")
+	}
+	if cookie := responseCookie(res, "oidc_state"); cookie == nil || cookie.MaxAge >= 0 {
+		t.Error("callback: state cookie not cleared")
+	}
+
+	res = twoFactorVerify(location.Query().Get("challenge"), totpCode(t, secret))
+	if res.StatusCode != http.StatusNoContent || responseCookie(res, "jwt") == nil {
+		t.Errorf("2fa verify: status %d", res.StatusCode)
+	}
+}
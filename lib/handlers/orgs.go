@@ -0,0 +1,649 @@
+package handlers
+
+import (
+	"context"
+	"huma-app/lib/security"
+	"huma-app/store"
+	"huma-app/store/types"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+// orgInvitationTTL is how long an invitation to an organization stays open.
+const orgInvitationTTL = 7 * 24 * time.Hour
+
+// OrgHeader is the input of org-scoped operations. The middleware has
+// already checked the membership of the caller in the {orgId} organization.
+type OrgHeader struct {
+	AuthHeader
+	OrgID   uuid.UUID     `path:"orgId"`
+	OrgRole types.OrgRole `hidden:"true"`
+}
+
+func (m *OrgHeader) Resolve(ctx huma.Context) []error {
+	m.AuthHeader.Resolve(ctx)
+	m.OrgRole, _ = ctx.Context().Value("org_role").(types.OrgRole)
+	return nil
+}
+
+var _ huma.Resolver = (*OrgHeader)(nil)
+
+// orgScoped lets only members with at least the given role call the
+// operation.
+func orgScoped(role types.OrgRole) map[string]any {
+	return map[string]any{security.OrgRoleMetadata: role}
+}
+
+// keepActiveOrg carries the active organization of a refreshed token over to
+// the new tokens, unless the user has left the organization since.
+func (rs *ApiHandlers) keepActiveOrg(ctx context.Context, claims *security.AppToken) []security.TokenOption {
+	if claims.OrgID == nil {
+		return nil
+	}
+	if _, err := rs.security.OrgRole(ctx, *claims.OrgID, claims.UserID); err != nil {
+		return nil
+	}
+	return []security.TokenOption{security.WithOrg(*claims.OrgID)}
+}
+
+type OrgOutputBody struct {
+	ID        uuid.UUID     `json:"id"`
+	Name      string        `json:"name"`
+	Role      types.OrgRole `json:"role" doc:"Your role in the organization"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+type OrgOutput struct {
+	Body OrgOutputBody
+}
+
+type GetOrgsOutput struct {
+	Body []OrgOutputBody
+}
+
+type CreateOrgInput struct {
+	AuthHeader
+	Body struct {
+		Name string `json:"name" required:"true" minLength:"1" maxLength:"100"`
+	}
+}
+
+func (rs *ApiHandlers) RegisterCreateOrg(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID:   "create-org",
+		Summary:       "Create organization",
+		Description:   "Creates an organization with the caller as its owner.",
+		Method:        http.MethodPost,
+		Path:          "/api/orgs",
+		Tags:          []string{"Organizations"},
+		DefaultStatus: http.StatusCreated,
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+	}, func(ctx context.Context, input *CreateOrgInput) (*OrgOutput, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		org, err := rs.repo.CreateOrganization(ctx, store.CreateOrganizationParams{
+			ID:   uuid.New(),
+			Name: input.Body.Name,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot create organization")
+		}
+		err = rs.repo.AddOrgMember(ctx, store.AddOrgMemberParams{
+			OrgID:  org.ID,
+			UserID: input.UserId,
+			Role:   types.OrgRoleOwner,
+		})
+		if err != nil {
+			rs.repo.DeleteOrganization(ctx, org.ID)
+			return nil, huma.Error500InternalServerError("Cannot create organization")
+		}
+		return &OrgOutput{Body: OrgOutputBody{
+			ID:        org.ID,
+			Name:      org.Name,
+			Role:      types.OrgRoleOwner,
+			CreatedAt: org.CreatedAt,
+		}}, nil
+	})
+}
+
+func (rs *ApiHandlers) RegisterGetOrgs(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-orgs",
+		Summary:     "Get organizations",
+		Description: "Lists the organizations the caller is a member of.",
+		Method:      http.MethodGet,
+		Path:        "/api/orgs",
+		Tags:        []string{"Organizations"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+	}, func(ctx context.Context, input *AuthHeader) (*GetOrgsOutput, error) {
+		rows, err := rs.repo.GetUserOrganizations(ctx, input.UserId)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot get organizations")
+		}
+		orgs := make([]OrgOutputBody, len(rows))
+		for i, row := range rows {
+			orgs[i] = OrgOutputBody{
+				ID:        row.ID,
+				Name:      row.Name,
+				Role:      row.Role,
+				CreatedAt: row.CreatedAt,
+			}
+		}
+		return &GetOrgsOutput{Body: orgs}, nil
+	})
+}
+
+func (rs *ApiHandlers) RegisterGetOrg(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-org",
+		Summary:     "Get organization",
+		Method:      http.MethodGet,
+		Path:        "/api/orgs/{orgId}",
+		Tags:        []string{"Organizations"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Metadata: orgScoped(types.OrgRoleMember),
+		Errors: []int{
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *OrgHeader) (*OrgOutput, error) {
+		org, err := rs.repo.GetOrganization(ctx, input.OrgID)
+		if err != nil {
+			return nil, huma.Error404NotFound("Organization not found")
+		}
+		return &OrgOutput{Body: OrgOutputBody{
+			ID:        org.ID,
+			Name:      org.Name,
+			Role:      input.OrgRole,
+			CreatedAt: org.CreatedAt,
+		}}, nil
+	})
+}
+
+type RenameOrgInput struct {
+	OrgHeader
+	Body struct {
+		Name string `json:"name" required:"true" minLength:"1" maxLength:"100"`
+	}
+}
+
+func (rs *ApiHandlers) RegisterRenameOrg(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "rename-org",
+		Summary:     "Rename organization",
+		Method:      http.MethodPut,
+		Path:        "/api/orgs/{orgId}",
+		Tags:        []string{"Organizations"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Metadata: orgScoped(types.OrgRoleAdmin),
+		Errors: []int{
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *RenameOrgInput) (*struct{}, error) {
+		err := rs.repo.RenameOrganization(ctx, store.RenameOrganizationParams{
+			Name: input.Body.Name,
+			ID:   input.OrgID,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot rename organization")
+		}
+		return nil, nil
+	})
+}
+
+func (rs *ApiHandlers) RegisterDeleteOrg(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-org",
+		Summary:     "Delete organization",
+		Description: "Deletes the organization together with its memberships and invitations.",
+		Method:      http.MethodDelete,
+		Path:        "/api/orgs/{orgId}",
+		Tags:        []string{"Organizations"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Metadata: orgScoped(types.OrgRoleOwner),
+		Errors: []int{
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *OrgHeader) (*struct{}, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		if err := rs.repo.DeleteOrganization(ctx, input.OrgID); err != nil {
+			return nil, huma.Error500InternalServerError("Cannot delete organization")
+		}
+		return nil, nil
+	})
+}
+
+type ActivateOrgInput struct {
+	AuthHeader
+	Refresh http.Cookie `cookie:"refresh"`
+	Body    struct {
+		OrgID uuid.UUID `json:"org_id" required:"true"`
+	}
+}
+
+// RegisterActivateOrg lives under /api/auth, the only path the refresh cookie
+// is sent to.
+func (rs *ApiHandlers) RegisterActivateOrg(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "activate-org",
+		Summary:     "Switch organization",
+		Description: "Makes the organization the active one of the session. The session cookies are reissued with the organization in the access token.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/active-org",
+		Tags:        []string{"Auth"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Errors: []int{
+			http.StatusUnauthorized,
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *ActivateOrgInput) (*LoginOutput, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		if _, err := rs.security.OrgRole(ctx, input.Body.OrgID, input.UserId); err != nil {
+			return nil, huma.Error404NotFound("Organization not found")
+		}
+		// The refresh token of the session is consumed, otherwise it would
+		// still refresh into the previous organization.
+		claims, err := rs.security.RotateRefreshToken(ctx, input.Refresh.Value)
+		if err != nil || claims.FamilyID != input.Family {
+			return nil, huma.Error401Unauthorized("Invalid or expired refresh token")
+		}
+		rs.security.RevokeToken(ctx, input.TokenID)
+
+		cookies, err := rs.security.GenerateSessionCookies(ctx, input.UserId, input.Role, input.Family, security.WithOrg(input.Body.OrgID))
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot issue token")
+		}
+		return &LoginOutput{
+			SetCookie: setCookies(cookies...),
+			Status:    http.StatusNoContent,
+		}, nil
+	})
+}
+
+type GetOrgMembersOutput struct {
+	Body []store.GetOrgMembersRow
+}
+
+func (rs *ApiHandlers) RegisterGetOrgMembers(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-org-members",
+		Summary:     "Get organization members",
+		Method:      http.MethodGet,
+		Path:        "/api/orgs/{orgId}/members",
+		Tags:        []string{"Organizations"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Metadata: orgScoped(types.OrgRoleMember),
+		Errors: []int{
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *OrgHeader) (*GetOrgMembersOutput, error) {
+		rows, err := rs.repo.GetOrgMembers(ctx, input.OrgID)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot get members")
+		}
+		return &GetOrgMembersOutput{Body: rows}, nil
+	})
+}
+
+// canManageMember reports whether the caller may change or remove a member
+// with the given role. Owners are managed by owners only.
+func (m *OrgHeader) canManageMember(role types.OrgRole) bool {
+	if role == types.OrgRoleOwner {
+		return m.OrgRole == types.OrgRoleOwner
+	}
+	return m.OrgRole.AtLeast(types.OrgRoleAdmin)
+}
+
+// keepOwner refuses to take the owner role away from the last owner, so no
+// organization is left without one.
+func (rs *ApiHandlers) keepOwner(ctx context.Context, orgID uuid.UUID, role types.OrgRole) error {
+	if role != types.OrgRoleOwner {
+		return nil
+	}
+	if count, err := rs.repo.CountOrgOwners(ctx, orgID); err != nil || count <= 1 {
+		return huma.Error409Conflict("The organization needs another owner first")
+	}
+	return nil
+}
+
+type SetOrgMemberRoleInput struct {
+	OrgHeader
+	MemberID uuid.UUID `path:"userId"`
+	Body     struct {
+		Role types.OrgRole `json:"role" required:"true" enum:"owner,admin,member"`
+	}
+}
+
+func (rs *ApiHandlers) RegisterSetOrgMemberRole(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "set-org-member-role",
+		Summary:     "Set member role",
+		Description: "Changes the role of a member. Only owners can make or unmake owners, and the last owner keeps the role.",
+		Method:      http.MethodPut,
+		Path:        "/api/orgs/{orgId}/members/{userId}",
+		Tags:        []string{"Organizations"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Metadata: orgScoped(types.OrgRoleAdmin),
+		Errors: []int{
+			http.StatusForbidden,
+			http.StatusNotFound,
+			http.StatusConflict,
+		},
+	}, func(ctx context.Context, input *SetOrgMemberRoleInput) (*struct{}, error) {
+		current, err := rs.security.OrgRole(ctx, input.OrgID, input.MemberID)
+		if err != nil {
+			return nil, huma.Error404NotFound("Member not found")
+		}
+		if !input.canManageMember(current) || !input.canManageMember(input.Body.Role) {
+			return nil, huma.Error403Forbidden("Only owners can manage owners")
+		}
+		if input.Body.Role != types.OrgRoleOwner {
+			if err := rs.keepOwner(ctx, input.OrgID, current); err != nil {
+				return nil, err
+			}
+		}
+		_, err = rs.repo.SetOrgMemberRole(ctx, store.SetOrgMemberRoleParams{
+			Role:   input.Body.Role,
+			OrgID:  input.OrgID,
+			UserID: input.MemberID,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot set role")
+		}
+		return nil, nil
+	})
+}
+
+type RemoveOrgMemberInput struct {
+	OrgHeader
+	MemberID uuid.UUID `path:"userId"`
+}
+
+func (rs *ApiHandlers) RegisterRemoveOrgMember(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "remove-org-member",
+		Summary:     "Remove member",
+		Description: "Removes a member from the organization. Members can remove themselves to leave it.",
+		Method:      http.MethodDelete,
+		Path:        "/api/orgs/{orgId}/members/{userId}",
+		Tags:        []string{"Organizations"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Metadata: orgScoped(types.OrgRoleMember),
+		Errors: []int{
+			http.StatusForbidden,
+			http.StatusNotFound,
+			http.StatusConflict,
+		},
+	}, func(ctx context.Context, input *RemoveOrgMemberInput) (*struct{}, error) {
+		current, err := rs.security.OrgRole(ctx, input.OrgID, input.MemberID)
+		if err != nil {
+			return nil, huma.Error404NotFound("Member not found")
+		}
+		if input.MemberID != input.UserId && !input.canManageMember(current) {
+			return nil, huma.Error403Forbidden("Forbidden")
+		}
+		if err := rs.keepOwner(ctx, input.OrgID, current); err != nil {
+			return nil, err
+		}
+		_, err = rs.repo.RemoveOrgMember(ctx, store.RemoveOrgMemberParams{
+			OrgID:  input.OrgID,
+			UserID: input.MemberID,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot remove member")
+		}
+		return nil, nil
+	})
+}
+
+type CreateOrgInvitationInput struct {
+	OrgHeader
+	Body struct {
+		Email string        `json:"email" format:"email" required:"true"`
+		Role  types.OrgRole `json:"role,omitempty" enum:"owner,admin,member" doc:"Defaults to member"`
+	}
+}
+
+type OrgInvitationOutput struct {
+	Body store.OrgInvitation
+}
+
+func (rs *ApiHandlers) RegisterCreateOrgInvitation(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID:   "create-org-invitation",
+		Summary:       "Invite to organization",
+		Description:   "Invites an email address to the organization. Once signed in with that verified address, the invitee can accept. Addresses compare case-insensitively. Inviting the same address again replaces the invitation.",
+		Method:        http.MethodPost,
+		Path:          "/api/orgs/{orgId}/invitations",
+		Tags:          []string{"Organizations"},
+		DefaultStatus: http.StatusCreated,
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Metadata: orgScoped(types.OrgRoleAdmin),
+		Errors: []int{
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *CreateOrgInvitationInput) (*OrgInvitationOutput, error) {
+		role := input.Body.Role
+		if role == "" {
+			role = types.OrgRoleMember
+		}
+		if !input.canManageMember(role) {
+			return nil, huma.Error403Forbidden("Only owners can invite owners")
+		}
+		invitation, err := rs.repo.CreateOrgInvitation(ctx, store.CreateOrgInvitationParams{
+			ID:        uuid.New(),
+			OrgID:     input.OrgID,
+			Email:     strings.ToLower(input.Body.Email),
+			Role:      role,
+			ExpiresAt: time.Now().Add(orgInvitationTTL).UTC(),
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot create invitation")
+		}
+		return &OrgInvitationOutput{Body: invitation}, nil
+	})
+}
+
+type GetOrgInvitationsOutput struct {
+	Body []store.OrgInvitation
+}
+
+func (rs *ApiHandlers) RegisterGetOrgInvitations(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-org-invitations",
+		Summary:     "Get organization invitations",
+		Description: "Lists open invitations of the organization.",
+		Method:      http.MethodGet,
+		Path:        "/api/orgs/{orgId}/invitations",
+		Tags:        []string{"Organizations"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Metadata: orgScoped(types.OrgRoleAdmin),
+		Errors: []int{
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *OrgHeader) (*GetOrgInvitationsOutput, error) {
+		rows, err := rs.repo.GetOrgInvitations(ctx, input.OrgID)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot get invitations")
+		}
+		return &GetOrgInvitationsOutput{Body: rows}, nil
+	})
+}
+
+type DeleteOrgInvitationInput struct {
+	OrgHeader
+	ID uuid.UUID `path:"id"`
+}
+
+func (rs *ApiHandlers) RegisterDeleteOrgInvitation(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-org-invitation",
+		Summary:     "Revoke organization invitation",
+		Method:      http.MethodDelete,
+		Path:        "/api/orgs/{orgId}/invitations/{id}",
+		Tags:        []string{"Organizations"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Metadata: orgScoped(types.OrgRoleAdmin),
+		Errors: []int{
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *DeleteOrgInvitationInput) (*struct{}, error) {
+		n, err := rs.repo.DeleteOrgInvitation(ctx, store.DeleteOrgInvitationParams{
+			ID:    input.ID,
+			OrgID: input.OrgID,
+		})
+		if err != nil || n == 0 {
+			return nil, huma.Error404NotFound("Invitation not found")
+		}
+		return nil, nil
+	})
+}
+
+type GetMyInvitationsOutput struct {
+	Body []store.GetInvitationsByEmailRow
+}
+
+func (rs *ApiHandlers) RegisterGetMyInvitations(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-my-invitations",
+		Summary:     "Get my invitations",
+		Description: "Lists open invitations to organizations for the email address of the caller.",
+		Method:      http.MethodGet,
+		Path:        "/api/orgs/invitations",
+		Tags:        []string{"Organizations"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+	}, func(ctx context.Context, input *AuthHeader) (*GetMyInvitationsOutput, error) {
+		user, err := rs.repo.GetUserById(ctx, input.UserId)
+		if err != nil {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		rows, err := rs.repo.GetInvitationsByEmail(ctx, strings.ToLower(user.Email))
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot get invitations")
+		}
+		return &GetMyInvitationsOutput{Body: rows}, nil
+	})
+}
+
+type InvitationIdInput struct {
+	AuthHeader
+	ID uuid.UUID `path:"id"`
+}
+
+func (rs *ApiHandlers) RegisterAcceptInvitation(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "accept-invitation",
+		Summary:     "Accept invitation",
+		Description: "Joins the organization with the invited role. The email address of the caller must be verified.",
+		Method:      http.MethodPost,
+		Path:        "/api/orgs/invitations/{id}/accept",
+		Tags:        []string{"Organizations"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Errors: []int{
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *InvitationIdInput) (*struct{}, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		user, err := rs.repo.GetUserById(ctx, input.UserId)
+		if err != nil {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		if user.Verified != 1 {
+			return nil, huma.Error403Forbidden("Email is not verified")
+		}
+		invitation, err := rs.repo.GetInvitationByEmail(ctx, store.GetInvitationByEmailParams{
+			ID:    input.ID,
+			Email: strings.ToLower(user.Email),
+		})
+		if err != nil {
+			return nil, huma.Error404NotFound("Invitation not found")
+		}
+		err = rs.repo.AddOrgMember(ctx, store.AddOrgMemberParams{
+			OrgID:  invitation.OrgID,
+			UserID: user.ID,
+			Role:   invitation.Role,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot join organization")
+		}
+		rs.repo.DeleteInvitationByEmail(ctx, store.DeleteInvitationByEmailParams{
+			ID:    invitation.ID,
+			Email: strings.ToLower(user.Email),
+		})
+		return nil, nil
+	})
+}
+
+func (rs *ApiHandlers) RegisterDeclineInvitation(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "decline-invitation",
+		Summary:     "Decline invitation",
+		Method:      http.MethodDelete,
+		Path:        "/api/orgs/invitations/{id}",
+		Tags:        []string{"Organizations"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Errors: []int{
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *InvitationIdInput) (*struct{}, error) {
+		user, err := rs.repo.GetUserById(ctx, input.UserId)
+		if err != nil {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		n, err := rs.repo.DeleteInvitationByEmail(ctx, store.DeleteInvitationByEmailParams{
+			ID:    input.ID,
+			Email: strings.ToLower(user.Email),
+		})
+		if err != nil || n == 0 {
+			return nil, huma.Error404NotFound("Invitation not found")
+		}
+		return nil, nil
+	})
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"huma-app/lib/authn"
+	"huma-app/lib/config"
+	"huma-app/lib/mail"
+	"huma-app/lib/middleware"
+	"huma-app/lib/security"
+	"huma-app/store"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+type ForgotPasswordInputBody struct {
+	Email string `format:"email" json:"email" required:"true"`
+}
+
+type ForgotPasswordInput struct {
+	Body ForgotPasswordInputBody
+}
+
+func (rs *ApiHandlers) RegisterForgotPassword(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "forgot-password",
+		Summary:     "Forgot password",
+		Description: "Sends a password reset link to the given email address. The response is the same whether the address is registered or not. Accounts whose password belongs to a login backend get no link.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/forgot-password",
+		Tags:        []string{"Auth"},
+		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.Forgot)},
+	}, func(ctx context.Context, input *ForgotPasswordInput) (*StatusOutput, error) {
+
+		user, err := rs.repo.GetUserByEmail(ctx, input.Body.Email)
+		if err != nil {
+			return &StatusOutput{Status: http.StatusOK}, nil
+		}
+		if backend, err := rs.backendPassword(ctx, user.ID); err != nil || backend {
+			return &StatusOutput{Status: http.StatusOK}, nil
+		}
+
+		token, err := rs.security.GeneratePasswordToken(ctx, time.Hour*1, user.ID, user.Role, user.Password)
+		if err != nil {
+			return &StatusOutput{Status: http.StatusOK}, nil
+		}
+		link := fmt.Sprintf(config.Get().Frontend.Urls.Password, token)
+
+		// Mail is sent in the background so response time does not reveal
+		// whether the address is registered.
+		go func() {
+			err := mail.SendPasswordMail(user.Email, mail.PasswordEmailParams{
+				AppName: config.Get().Api.Name,
+				Link:    link,
+			})
+			if err != nil {
+				slog.Error("cannot send password mail", "err", err)
+			}
+		}()
+
+		return &StatusOutput{Status: http.StatusOK}, nil
+	})
+}
+
+type ResetPasswordInputBody struct {
+	Token    string `json:"token" required:"true"`
+	Password string `json:"password" required:"true"`
+}
+
+type ResetPasswordInput struct {
+	Body ResetPasswordInputBody
+}
+
+func (rs *ApiHandlers) RegisterResetPassword(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "reset-password",
+		Summary:     "Reset password",
+		Description: "Sets a new password using the token from the password reset email. The token can only be used once. A lockout after failed logins is lifted.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/reset-password",
+		Tags:        []string{"Auth"},
+		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.Reset)},
+		Errors: []int{
+			http.StatusUnauthorized,
+			http.StatusForbidden,
+			http.StatusUnprocessableEntity,
+		},
+	}, func(ctx context.Context, input *ResetPasswordInput) (*StatusOutput, error) {
+
+		token, err := rs.security.VerifyToken(ctx, input.Body.Token, security.PasswordToken)
+		if err != nil {
+			return nil, huma.Error401Unauthorized("Invalid or expired token")
+		}
+
+		user, err := rs.repo.GetUserWithPasswordById(ctx, token.UserID)
+		if err != nil {
+			return nil, huma.Error401Unauthorized("Invalid or expired token")
+		}
+
+		if err := rs.security.VerifyPasswordToken(token, user.Password); err != nil {
+			return nil, huma.Error401Unauthorized("Invalid or expired token")
+		}
+		if err := rs.denyBackendPassword(ctx, user.ID); err != nil {
+			return nil, err
+		}
+
+		if err := rs.checkPassword("body.password", input.Body.Password, user.Email); err != nil {
+			return nil, err
+		}
+
+		hash, err := rs.hasher.Hash(input.Body.Password)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot update password")
+		}
+
+		err = rs.repo.UpdateUserPassword(ctx, store.UpdateUserPasswordParams{
+			Password: hash,
+			ID:       user.ID,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot update password")
+		}
+		rs.security.RevokeUserTokens(ctx, user.ID)
+		rs.noticePasswordChanged(ctx, user.ID, user.Role, user.Email)
+		// The reset link proves the owner, like the unlock link does.
+		if err := rs.repo.ResetFailedLogins(ctx, user.ID); err != nil {
+			slog.Error("cannot reset failed logins", "err", err)
+		}
+
+		return &StatusOutput{Status: http.StatusOK}, nil
+	})
+}
+
+type ChangePasswordInputBody struct {
+	CurrentPassword string `json:"current_password,omitempty" doc:"Not required if the account has no password yet, e.g. after SSO sign up"`
+	NewPassword     string `json:"new_password" required:"true"`
+}
+
+type ChangePasswordInput struct {
+	AuthHeader
+	Body ChangePasswordInputBody
+}
+
+func (rs *ApiHandlers) RegisterChangePassword(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "change-password",
+		Summary:     "Change password",
+		Description: "Changes the password of the current user. All other sessions are signed out and the current one gets new cookies. Accounts whose password belongs to a login backend like LDAP cannot set one here.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/change-password",
+		Tags:        []string{"Auth"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Errors: []int{
+			http.StatusUnauthorized,
+			http.StatusForbidden,
+			http.StatusUnprocessableEntity,
+		},
+	}, func(ctx context.Context, input *ChangePasswordInput) (*LoginOutput, error) {
+
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+
+		user, err := rs.repo.GetUserWithPasswordById(ctx, input.UserId)
+		if err != nil {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		if err := rs.denyBackendPassword(ctx, user.ID); err != nil {
+			return nil, err
+		}
+
+		if user.Password != "" {
+			ok, _, err := rs.hasher.Verify(input.Body.CurrentPassword, user.Password)
+			if err != nil || !ok {
+				return nil, huma.Error403Forbidden("Wrong current password")
+			}
+		}
+
+		if err := rs.checkPassword("body.new_password", input.Body.NewPassword, user.Email); err != nil {
+			return nil, err
+		}
+
+		hash, err := rs.hasher.Hash(input.Body.NewPassword)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot update password")
+		}
+
+		err = rs.repo.UpdateUserPassword(ctx, store.UpdateUserPasswordParams{
+			Password: hash,
+			ID:       user.ID,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot update password")
+		}
+		rs.security.RevokeUserTokens(ctx, user.ID)
+		rs.noticePasswordChanged(ctx, user.ID, user.Role, user.Email)
+
+		cookies, err := rs.security.GenerateSessionCookies(ctx, user.ID, user.Role, "")
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot issue token")
+		}
+
+		return &LoginOutput{
+			SetCookie: setCookies(cookies...),
+			Status:    http.StatusNoContent,
+		}, nil
+	})
+}
+
+// backendPassword tells whether the user logs in through a login backend
+// like LDAP. A local password would answer first and keep working after the
+// account is disabled there, so such users cannot set one.
+func (rs *ApiHandlers) backendPassword(ctx context.Context, userID uuid.UUID) (bool, error) {
+	providers, err := rs.repo.GetUserIdentityProviders(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(providers, authn.IsBackend), nil
+}
+
+func (rs *ApiHandlers) denyBackendPassword(ctx context.Context, userID uuid.UUID) error {
+	backend, err := rs.backendPassword(ctx, userID)
+	if err != nil {
+		return huma.Error500InternalServerError("Cannot update password")
+	}
+	if backend {
+		return huma.Error403Forbidden("Password is managed by the login backend")
+	}
+	return nil
+}
+
+// checkPassword applies the password policy and reports every violation as a
+// validation error of the given body field.
+func (rs *ApiHandlers) checkPassword(location, password, email string) error {
+	violations := rs.policy.Check(password, email)
+	if len(violations) == 0 {
+		return nil
+	}
+	details := make([]error, len(violations))
+	for i, v := range violations {
+		details[i] = &huma.ErrorDetail{
+			Location: location,
+			Message:  v.Error(),
+		}
+	}
+	return huma.Error422UnprocessableEntity("Password does not meet the requirements", details...)
+}
@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"huma-app/lib/audit"
+	"huma-app/lib/security"
+	"huma-app/store"
+	"huma-app/store/types"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+type RoleOutputBody struct {
+	Name        types.Role `json:"name"`
+	Description string     `json:"description"`
+	Builtin     bool       `json:"builtin" doc:"Built-in roles cannot be deleted"`
+	Permissions []string   `json:"permissions"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type RoleOutput struct {
+	Body RoleOutputBody
+}
+
+type GetRolesOutput struct {
+	Body []RoleOutputBody
+}
+
+func (rs *ApiHandlers) roleOutput(ctx context.Context, role store.Role) (RoleOutputBody, error) {
+	permissions, err := rs.repo.GetRolePermissions(ctx, role.Name)
+	if err != nil {
+		return RoleOutputBody{}, err
+	}
+	if permissions == nil {
+		permissions = []string{}
+	}
+	return RoleOutputBody{
+		Name:        role.Name,
+		Description: role.Description,
+		Builtin:     role.Builtin == 1,
+		Permissions: permissions,
+		CreatedAt:   role.CreatedAt,
+	}, nil
+}
+
+// setRolePermissions replaces the permissions of the role. Unknown
+// permissions are rejected before anything is changed.
+func (rs *ApiHandlers) setRolePermissions(ctx context.Context, role types.Role, permissions []string) error {
+	known, err := rs.repo.GetPermissions(ctx)
+	if err != nil {
+		return huma.Error500InternalServerError("Cannot get permissions")
+	}
+	var details []error
+	for i, permission := range permissions {
+		found := false
+		for _, p := range known {
+			found = found || p.Name == permission
+		}
+		if !found {
+			details = append(details, &huma.ErrorDetail{
+				Location: fmt.Sprintf("body.permissions[%d]", i),
+				Message:  "Unknown permission",
+				Value:    permission,
+			})
+		}
+	}
+	if len(details) > 0 {
+		return huma.Error422UnprocessableEntity("Unknown permissions", details...)
+	}
+
+	defer rs.security.InvalidatePermissions()
+	if err := rs.repo.DeleteRolePermissions(ctx, role); err != nil {
+		return huma.Error500InternalServerError("Cannot update permissions")
+	}
+	for _, permission := range permissions {
+		err := rs.repo.AddRolePermission(ctx, store.AddRolePermissionParams{
+			Role:       role,
+			Permission: permission,
+		})
+		if err != nil {
+			return huma.Error500InternalServerError("Cannot update permissions")
+		}
+	}
+	return nil
+}
+
+func (rs *ApiHandlers) RegisterGetRoles(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-roles",
+		Summary:     "Get roles",
+		Description: "Lists roles together with their permissions.",
+		Method:      http.MethodGet,
+		Path:        "/api/roles",
+		Tags:        []string{"Roles"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermRolesRead}},
+		},
+	}, func(ctx context.Context, input *struct{}) (*GetRolesOutput, error) {
+		rows, err := rs.repo.GetRoles(ctx)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot get roles")
+		}
+		roles := make([]RoleOutputBody, len(rows))
+		for i, row := range rows {
+			if roles[i], err = rs.roleOutput(ctx, row); err != nil {
+				return nil, huma.Error500InternalServerError("Cannot get roles")
+			}
+		}
+		return &GetRolesOutput{Body: roles}, nil
+	})
+}
+
+type CreateRoleInput struct {
+	AuthHeader
+	Body struct {
+		Name        types.Role `json:"name" required:"true" minLength:"1" maxLength:"50" pattern:"^[a-z][a-z0-9_-]*$"`
+		Description string     `json:"description,omitempty" maxLength:"200"`
+		Permissions []string   `json:"permissions,omitempty"`
+	}
+}
+
+func (rs *ApiHandlers) RegisterCreateRole(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID:   "create-role",
+		Summary:       "Create role",
+		Method:        http.MethodPost,
+		Path:          "/api/roles",
+		Tags:          []string{"Roles"},
+		DefaultStatus: http.StatusCreated,
+		Security: []map[string][]string{
+			{"Bearer": {security.PermRolesWrite}},
+		},
+		Errors: []int{
+			http.StatusConflict,
+			http.StatusUnprocessableEntity,
+		},
+	}, func(ctx context.Context, input *CreateRoleInput) (*RoleOutput, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		if _, err := rs.repo.GetRole(ctx, input.Body.Name); err == nil {
+			return nil, huma.Error409Conflict("Role already exists")
+		}
+		role, err := rs.repo.CreateRole(ctx, store.CreateRoleParams{
+			Name:        input.Body.Name,
+			Description: input.Body.Description,
+		})
+		if err != nil {
+			return nil, huma.Error400BadRequest(err.Error())
+		}
+		if err := rs.setRolePermissions(ctx, role.Name, input.Body.Permissions); err != nil {
+			rs.repo.DeleteRole(ctx, role.Name)
+			return nil, err
+		}
+		body, err := rs.roleOutput(ctx, role)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot get role")
+		}
+		rs.audit.Record(ctx, audit.Event{
+			Action:   audit.ActionCreateRole,
+			Target:   string(role.Name),
+			Metadata: map[string]any{"permissions": body.Permissions},
+		})
+		return &RoleOutput{Body: body}, nil
+	})
+}
+
+type UpdateRoleInput struct {
+	AuthHeader
+	Name types.Role `path:"name"`
+	Body struct {
+		Description string   `json:"description,omitempty" maxLength:"200"`
+		Permissions []string `json:"permissions" doc:"Replaces the permissions of the role"`
+	}
+}
+
+func (rs *ApiHandlers) RegisterUpdateRole(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "update-role",
+		Summary:     "Update role",
+		Description: "Sets the description and permissions of the role. The admin role always has every permission and cannot be changed.",
+		Method:      http.MethodPut,
+		Path:        "/api/roles/{name}",
+		Tags:        []string{"Roles"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermRolesWrite}},
+		},
+		Errors: []int{
+			http.StatusForbidden,
+			http.StatusNotFound,
+			http.StatusUnprocessableEntity,
+		},
+	}, func(ctx context.Context, input *UpdateRoleInput) (*RoleOutput, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		if input.Name == types.RoleAdmin {
+			return nil, huma.Error403Forbidden("The admin role cannot be changed")
+		}
+		role, err := rs.repo.GetRole(ctx, input.Name)
+		if err != nil {
+			return nil, huma.Error404NotFound("Role not found")
+		}
+		if err := rs.setRolePermissions(ctx, role.Name, input.Body.Permissions); err != nil {
+			return nil, err
+		}
+		err = rs.repo.UpdateRoleDescription(ctx, store.UpdateRoleDescriptionParams{
+			Description: input.Body.Description,
+			Name:        role.Name,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot update role")
+		}
+		role.Description = input.Body.Description
+		body, err := rs.roleOutput(ctx, role)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot get role")
+		}
+		rs.audit.Record(ctx, audit.Event{
+			Action:   audit.ActionUpdateRole,
+			Target:   string(role.Name),
+			Metadata: map[string]any{"permissions": body.Permissions},
+		})
+		return &RoleOutput{Body: body}, nil
+	})
+}
+
+type DeleteRoleInput struct {
+	AuthHeader
+	Name types.Role `path:"name"`
+}
+
+func (rs *ApiHandlers) RegisterDeleteRole(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-role",
+		Summary:     "Delete role",
+		Description: "Deletes a role nobody has. API keys acting as the role fall back to the user role.",
+		Method:      http.MethodDelete,
+		Path:        "/api/roles/{name}",
+		Tags:        []string{"Roles"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermRolesWrite}},
+		},
+		Errors: []int{
+			http.StatusForbidden,
+			http.StatusNotFound,
+			http.StatusConflict,
+		},
+	}, func(ctx context.Context, input *DeleteRoleInput) (*struct{}, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		role, err := rs.repo.GetRole(ctx, input.Name)
+		if err != nil {
+			return nil, huma.Error404NotFound("Role not found")
+		}
+		if role.Builtin == 1 {
+			return nil, huma.Error403Forbidden("Built-in roles cannot be deleted")
+		}
+		if count, err := rs.repo.CountUsersWithRole(ctx, role.Name); err != nil || count > 0 {
+			return nil, huma.Error409Conflict("Role is assigned to users")
+		}
+		if _, err := rs.repo.DeleteRole(ctx, role.Name); err != nil {
+			return nil, huma.Error409Conflict(err.Error())
+		}
+		rs.security.InvalidatePermissions()
+		rs.audit.Record(ctx, audit.Event{
+			Action: audit.ActionDeleteRole,
+			Target: string(role.Name),
+		})
+		return nil, nil
+	})
+}
+
+type GetPermissionsOutput struct {
+	Body []store.Permission
+}
+
+func (rs *ApiHandlers) RegisterGetPermissions(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-permissions",
+		Summary:     "Get permissions",
+		Description: "Lists the permissions roles can be given.",
+		Method:      http.MethodGet,
+		Path:        "/api/permissions",
+		Tags:        []string{"Roles"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermRolesRead}},
+		},
+	}, func(ctx context.Context, input *struct{}) (*GetPermissionsOutput, error) {
+		rows, err := rs.repo.GetPermissions(ctx)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot get permissions")
+		}
+		return &GetPermissionsOutput{Body: rows}, nil
+	})
+}
+
+type SetUserRoleInput struct {
+	AuthHeader
+	ID   uuid.UUID `path:"id"`
+	Body struct {
+		Role types.Role `json:"role" required:"true"`
+	}
+}
+
+func (rs *ApiHandlers) RegisterSetUserRole(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "set-user-role",
+		Summary:     "Set user role",
+		Description: "Assigns a role to the user. The user is logged out everywhere, so the new role applies at the next login.",
+		Method:      http.MethodPut,
+		Path:        "/api/users/{id}/role",
+		Tags:        []string{"Users"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermUsersWrite, security.PermRolesWrite}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusNotFound,
+			http.StatusUnprocessableEntity,
+		},
+	}, func(ctx context.Context, input *SetUserRoleInput) (*struct{}, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		if input.ID == input.UserId {
+			return nil, huma.Error400BadRequest("Cannot change your own role")
+		}
+		user, err := rs.repo.GetUserById(ctx, input.ID)
+		if err != nil {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		if _, err := rs.repo.GetRole(ctx, input.Body.Role); err != nil {
+			return nil, huma.Error422UnprocessableEntity("Unknown role", &huma.ErrorDetail{
+				Location: "body.role",
+				Message:  "Unknown role",
+				Value:    input.Body.Role,
+			})
+		}
+		err = rs.repo.SetUserRole(ctx, store.SetUserRoleParams{
+			Role: input.Body.Role,
+			ID:   input.ID,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot set role")
+		}
+		rs.audit.Record(ctx, audit.Event{
+			Action:   audit.ActionSetUserRole,
+			Target:   input.ID.String(),
+			Metadata: map[string]any{"from": user.Role, "to": input.Body.Role},
+		})
+		if err := rs.security.RevokeUserTokens(ctx, input.ID); err != nil {
+			return nil, huma.Error500InternalServerError("Cannot revoke tokens")
+		}
+		return nil, nil
+	})
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"huma-app/lib/config"
+	"huma-app/lib/sso"
+	"huma-app/store"
+	"huma-app/store/types"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const samlStateCookieName = "saml_state"
+
+// samlState travels in a signed cookie between the login redirect and the
+// response posted to the ACS url.
+type samlState struct {
+	jwt.RegisteredClaims
+	Provider  string `json:"provider"`
+	RequestID string `json:"request_id"`
+}
+
+type SamlProvidersOutput struct {
+	Body []OidcProviderOutputBody
+}
+
+func (rs *ApiHandlers) RegisterSamlProviders(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "saml-providers",
+		Summary:     "Get SAML providers",
+		Method:      http.MethodGet,
+		Path:        "/api/auth/saml",
+		Tags:        []string{"Auth"},
+	}, func(ctx context.Context, input *struct{}) (*SamlProvidersOutput, error) {
+		providers := []OidcProviderOutputBody{}
+		for _, cfg := range config.Get().Saml.Providers {
+			p := rs.saml[cfg.Name]
+			providers = append(providers, OidcProviderOutputBody{Name: p.Name(), Title: p.Title()})
+		}
+		return &SamlProvidersOutput{Body: providers}, nil
+	})
+}
+
+type SamlProviderInput struct {
+	Provider string `path:"provider"`
+}
+
+type SamlMetadataOutput struct {
+	ContentType string `header:"Content-Type"`
+	Body        []byte
+}
+
+func (rs *ApiHandlers) RegisterSamlMetadata(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "saml-metadata",
+		Summary:     "SAML service provider metadata",
+		Description: "Metadata to register the app at the identity provider, with the entity id, ACS url and signing certificate.",
+		Method:      http.MethodGet,
+		Path:        "/api/auth/saml/{provider}/metadata",
+		Tags:        []string{"Auth"},
+		Errors: []int{
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *SamlProviderInput) (*SamlMetadataOutput, error) {
+		provider, ok := rs.saml[input.Provider]
+		if !ok {
+			return nil, huma.Error404NotFound("Unknown provider")
+		}
+		metadata, err := provider.Metadata(ctx)
+		if err != nil {
+			slog.Error("cannot load saml provider", "provider", provider.Name(), "err", err)
+			return nil, huma.Error502BadGateway("Identity provider is not available")
+		}
+		return &SamlMetadataOutput{ContentType: "application/samlmetadata+xml", Body: metadata}, nil
+	})
+}
+
+func (rs *ApiHandlers) RegisterSamlLogin(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "saml-login",
+		Summary:     "SAML login",
+		Description: "Redirects to the identity provider with an authentication request. The response is posted back to saml-acs.",
+		Method:      http.MethodGet,
+		Path:        "/api/auth/saml/{provider}/login",
+		Tags:        []string{"Auth"},
+		Errors: []int{
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *SamlProviderInput) (*RedirectOutput, error) {
+		provider, ok := rs.saml[input.Provider]
+		if !ok {
+			return nil, huma.Error404NotFound("Unknown provider")
+		}
+
+		url, requestID, err := provider.AuthnRequestURL(ctx)
+		if err != nil {
+			slog.Error("cannot load saml provider", "provider", provider.Name(), "err", err)
+			return nil, huma.Error502BadGateway("Identity provider is not available")
+		}
+
+		signed, err := rs.security.SignClaims(samlState{
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(sso.SamlRequestTTL)),
+			},
+			Provider:  provider.Name(),
+			RequestID: requestID,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot start login")
+		}
+
+		return &RedirectOutput{
+			Status:   http.StatusFound,
+			Location: url,
+			SetCookie: setCookies(http.Cookie{
+				Name:     samlStateCookieName,
+				Value:    signed,
+				Path:     "/api/auth/saml",
+				MaxAge:   int(sso.SamlRequestTTL.Seconds()),
+				HttpOnly: true,
+				Secure:   true,
+				// None, since the identity provider posts the response
+				// from its own site. The cookie is signed and only names
+				// the pending request.
+				SameSite: http.SameSiteNoneMode,
+			}),
+		}, nil
+	})
+}
+
+type SamlAcsInput struct {
+	Provider string      `path:"provider"`
+	Cookie   http.Cookie `cookie:"saml_state"`
+	RawBody  []byte      `contentType:"application/x-www-form-urlencoded"`
+}
+
+func (rs *ApiHandlers) RegisterSamlAcs(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "saml-acs",
+		Summary:     "SAML assertion consumer service",
+		Description: "Completes the login started by saml-login. The signed assertion has to answer that request; logins started at the identity provider are not accepted. The user is found by the linked identity or by email, or created, and gets the usual session cookies, or with two-factor authentication a redirect to the two_factor frontend URL with a challenge for two-factor-verify. Accounts are created even when registration is invite-only, the identity provider decides who may log in. With a role attribute configured, the role of the accounts it created follows the identity provider on every login.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/saml/{provider}/acs",
+		Tags:        []string{"Auth"},
+		Errors: []int{
+			http.StatusUnauthorized,
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *SamlAcsInput) (*RedirectOutput, error) {
+		provider, ok := rs.saml[input.Provider]
+		if !ok {
+			return nil, huma.Error404NotFound("Unknown provider")
+		}
+
+		var state samlState
+		err := rs.security.ParseClaims(input.Cookie.Value, &state)
+		if err != nil || state.Provider != provider.Name() || state.RequestID == "" {
+			return nil, huma.Error401Unauthorized("Invalid login state")
+		}
+		form, err := url.ParseQuery(string(input.RawBody))
+		if err != nil {
+			return nil, huma.Error401Unauthorized("Cannot verify identity")
+		}
+
+		identity, err := provider.ParseResponse(ctx, form.Get("SAMLResponse"), state.RequestID)
+		if err != nil {
+			slog.Warn("invalid saml response", "provider", provider.Name(), "err", err)
+			return nil, huma.Error401Unauthorized("Cannot verify identity")
+		}
+
+		user, err := rs.samlUser(ctx, provider, identity)
+		if err != nil {
+			return nil, huma.Error401Unauthorized(err.Error())
+		}
+
+		// 303, so the browser follows with a GET.
+		return rs.finishRedirectLogin(ctx, "saml:"+provider.Name(), user, http.StatusSeeOther, http.Cookie{
+			Name:   samlStateCookieName,
+			Value:  "",
+			Path:   "/api/auth/saml",
+			MaxAge: -1,
+		})
+	})
+}
+
+// samlUser resolves the local user for an asserted identity like oidcUser,
+// except that the identity provider is trusted with the email and with
+// provisioning, see externalUser.
+func (rs *ApiHandlers) samlUser(ctx context.Context, provider *sso.SamlProvider, identity *sso.SamlIdentity) (*store.GetUserByIdentityRow, error) {
+	if identity.Subject == "" || identity.Email == "" {
+		return nil, errNoEmail
+	}
+	role, _ := provider.RoleMapping(identity)
+	return rs.externalUser(ctx, externalIdentity{
+		Provider:      "saml:" + provider.Name(),
+		Subject:       identity.Subject,
+		Email:         identity.Email,
+		EmailVerified: true,
+		Provisions:    true,
+		ManagesRole:   provider.ManagesRoles(),
+		Role:          types.Role(role),
+	})
+}
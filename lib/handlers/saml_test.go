@@ -0,0 +1,353 @@
+package handlers_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"html"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/google/uuid"
+)
+
+// mockSaml is a SAML identity provider for the "mock" provider. Its metadata
+// and the key pair of the service provider are written to the config dir.
+type mockSaml struct {
+	key         *rsa.PrivateKey
+	certificate *x509.Certificate
+}
+
+func newMockSaml(dir string) (*mockSaml, error) {
+	key, certificate, err := newCertificate("idp")
+	if err != nil {
+		return nil, err
+	}
+	m := &mockSaml{key: key, certificate: certificate}
+	metadata, err := xml.MarshalIndent(m.provider(key, nil, nil).Metadata(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "idp.xml"), metadata, 0600); err != nil {
+		return nil, err
+	}
+
+	key, certificate, err = newCertificate("sp")
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(filepath.Join(dir, "sp.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}), 0600)
+	if err != nil {
+		return nil, err
+	}
+	return m, os.WriteFile(filepath.Join(dir, "sp.key"), pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+}
+
+func newCertificate(name string) (*rsa.PrivateKey, *x509.Certificate, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	return key, certificate, err
+}
+
+func (m *mockSaml) provider(key *rsa.PrivateKey, sp *saml.EntityDescriptor, session *saml.Session) *saml.IdentityProvider {
+	metadataURL, _ := url.Parse("https://idp.test/metadata")
+	ssoURL, _ := url.Parse("https://idp.test/sso")
+	return &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             m.certificate,
+		MetadataURL:             *metadataURL,
+		SSOURL:                  *ssoURL,
+		ServiceProviderProvider: serviceProvider{sp},
+		SessionProvider:         sessionProvider{session},
+	}
+}
+
+type serviceProvider struct {
+	metadata *saml.EntityDescriptor
+}
+
+func (p serviceProvider) GetServiceProvider(*http.Request, string) (*saml.EntityDescriptor, error) {
+	return p.metadata, nil
+}
+
+type sessionProvider struct {
+	session *saml.Session
+}
+
+func (p sessionProvider) GetSession(http.ResponseWriter, *http.Request, *saml.IdpAuthnRequest) *saml.Session {
+	return p.session
+}
+
+// samlUser is who the identity provider asserts.
+type samlUser struct {
+	Subject string
+	Email   string
+	Groups  []string
+}
+
+// samlAssertion changes how the identity provider answers.
+type samlAssertion struct {
+	// Key signs the response instead of the key in the metadata.
+	Key *rsa.PrivateKey
+	// EntityID is the audience instead of the service provider's own.
+	EntityID string
+	// Plain leaves the assertion unencrypted, so tests can change it.
+	Plain bool
+}
+
+// samlStart runs saml-login and the identity provider's answer for user. It
+// returns the state cookie and the base64 SAMLResponse to post to the ACS.
+func samlStart(t *testing.T, user samlUser, assertion samlAssertion) (*http.Cookie, string) {
+	t.Helper()
+	res := serve(httptest.NewRequest(http.MethodGet, "/api/auth/saml/mock/login", nil))
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("saml-login: status %d", res.StatusCode)
+	}
+	state := responseCookie(res, "saml_state")
+	if state == nil {
+		t.Fatal("saml-login: no state cookie")
+	}
+	request, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res = serve(httptest.NewRequest(http.MethodGet, "/api/auth/saml/mock/metadata", nil))
+	body, _ := io.ReadAll(res.Body)
+	sp, err := samlsp.ParseMetadata(body)
+	if err != nil {
+		t.Fatalf("saml-metadata: %v", err)
+	}
+	if assertion.EntityID != "" {
+		sp.EntityID = assertion.EntityID
+	}
+	if assertion.Plain {
+		for i, descriptor := range sp.SPSSODescriptors {
+			keys := descriptor.KeyDescriptors[:0]
+			for _, key := range descriptor.KeyDescriptors {
+				if key.Use != "encryption" {
+					keys = append(keys, key)
+				}
+			}
+			sp.SPSSODescriptors[i].KeyDescriptors = keys
+		}
+	}
+	key := idp.key
+	if assertion.Key != nil {
+		key = assertion.Key
+	}
+	provider := idp.provider(key, sp, &saml.Session{
+		ID:         randomString(),
+		CreateTime: time.Now(),
+		ExpireTime: time.Now().Add(time.Hour),
+		Index:      "1",
+		NameID:     user.Subject,
+		UserEmail:  user.Email,
+		Groups:     user.Groups,
+	})
+
+	w := httptest.NewRecorder()
+	provider.ServeSSO(w, httptest.NewRequest(http.MethodGet, "https://idp.test/sso?"+request.RawQuery, nil))
+	form := regexp.MustCompile(`name="SAMLResponse" value="([^"]+)"`).FindStringSubmatch(w.Body.String())
+	if form == nil {
+		t.Fatalf("sso: status %d: %s", w.Code, w.Body.String())
+	}
+	return state, html.UnescapeString(form[1])
+}
+
+func samlAcs(state *http.Cookie, response string) *http.Response {
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/saml/mock/acs",
+		strings.NewReader(url.Values{"SAMLResponse": {response}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return serve(r, state)
+}
+
+func userRole(t *testing.T, email string) string {
+	t.Helper()
+	var role string
+	if err := db.QueryRow(`SELECT role FROM users WHERE email = ?`, email).Scan(&role); err != nil {
+		t.Fatal(err)
+	}
+	return role
+}
+
+// loginFailures counts the failed logins of email audited with reason.
+func loginFailures(t *testing.T, email, reason string) int {
+	t.Helper()
+	var n int
+	err := db.QueryRow(`SELECT count(*) FROM audit_events
+		WHERE action = 'user.login_failed' AND json_extract(metadata, '$.email') = ? AND json_extract(metadata, '$.reason') = ?`, email, reason).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSamlLogin(t *testing.T) {
+	state, response := samlStart(t, samlUser{Subject: "saml-login", Email: "saml-login@example.com", Groups: []string{"staff-admins"}}, samlAssertion{})
+
+	res := samlAcs(state, response)
+	if res.StatusCode != http.StatusSeeOther || res.Header.Get("Location") != "/app" {
+		t.Fatalf("acs: status %d, location %q", res.StatusCode, res.Header.Get("Location"))
+	}
+	if cookie := responseCookie(res, "jwt"); cookie == nil || cookie.Value == "" {
+		t.Error("acs: no session cookie")
+	}
+	if role := userRole(t, "saml-login@example.com"); role != "admin" {
+		t.Errorf("mapped role: %q", role)
+	}
+
+	var linked int
+	err := db.QueryRow(`SELECT count(*) FROM user_identities i JOIN users u ON u.id = i.user_id
+		WHERE i.provider = 'saml:mock' AND i.subject = 'saml-login' AND u.email = 'saml-login@example.com'`).Scan(&linked)
+	if err != nil || linked != 1 {
+		t.Errorf("identity not linked: %d, %v", linked, err)
+	}
+}
+
+func TestSamlRoleFollowsIdentityProvider(t *testing.T) {
+	user := samlUser{Subject: "saml-role", Email: "saml-role@example.com", Groups: []string{"staff-admins"}}
+	if res := samlAcs(samlStart(t, user, samlAssertion{})); res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("first login: status %d", res.StatusCode)
+	}
+	if role := userRole(t, user.Email); role != "admin" {
+		t.Fatalf("mapped role: %q", role)
+	}
+
+	user.Groups = []string{"staff"}
+	if res := samlAcs(samlStart(t, user, samlAssertion{})); res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("second login: status %d", res.StatusCode)
+	}
+	if role := userRole(t, user.Email); role != "user" {
+		t.Errorf("role without a mapped group: %q", role)
+	}
+}
+
+func TestSamlAcsRejectsReplay(t *testing.T) {
+	state, response := samlStart(t, samlUser{Subject: "saml-replay", Email: "saml-replay@example.com"}, samlAssertion{})
+	if res := samlAcs(state, response); res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("first post: status %d", res.StatusCode)
+	}
+	if res := samlAcs(state, response); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("replayed response: status %d", res.StatusCode)
+	}
+}
+
+func TestSamlAcsChecksSignature(t *testing.T) {
+	other, _, err := newCertificate("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, response := samlStart(t, samlUser{Subject: "saml-key", Email: "saml-key@example.com"}, samlAssertion{Key: other})
+	if res := samlAcs(state, response); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("signed with another key: status %d", res.StatusCode)
+	}
+
+	state, response = samlStart(t, samlUser{Subject: "saml-tampered", Email: "saml-tampered@example.com"}, samlAssertion{Plain: true})
+	decoded, err := base64.StdEncoding.DecodeString(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(decoded), "saml-tampered@example.com") {
+		t.Fatal("assertion is not plain")
+	}
+	tampered := strings.ReplaceAll(string(decoded), "saml-tampered@example.com", "saml-victim@example.com")
+	if res := samlAcs(state, base64.StdEncoding.EncodeToString([]byte(tampered))); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("tampered assertion: status %d", res.StatusCode)
+	}
+}
+
+func TestSamlAcsChecksAudience(t *testing.T) {
+	state, response := samlStart(t, samlUser{Subject: "saml-audience", Email: "saml-audience@example.com"}, samlAssertion{EntityID: "https://other.test/metadata"})
+	if res := samlAcs(state, response); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("assertion for another service provider: status %d", res.StatusCode)
+	}
+}
+
+func TestSamlKeepsRoleOfLinkedAccount(t *testing.T) {
+	_, err := db.Exec(`INSERT INTO users (id, email, password, role, verified) VALUES (?, 'saml-linked@example.com', '', 'editor', 1)`, uuid.NewString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := samlUser{Subject: "saml-linked", Email: "saml-linked@example.com", Groups: []string{"staff-admins"}}
+	if res := samlAcs(samlStart(t, user, samlAssertion{})); res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("acs: status %d", res.StatusCode)
+	}
+	if role := userRole(t, user.Email); role != "editor" {
+		t.Errorf("role of an account the provider did not create: %q", role)
+	}
+}
+
+func TestSamlRefusesDeactivatedUser(t *testing.T) {
+	user := samlUser{Subject: "saml-inactive", Email: "saml-inactive@example.com"}
+	if res := samlAcs(samlStart(t, user, samlAssertion{})); res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("first login: status %d", res.StatusCode)
+	}
+	if _, err := db.Exec(`UPDATE users SET active = 0 WHERE email = ?`, user.Email); err != nil {
+		t.Fatal(err)
+	}
+
+	res := samlAcs(samlStart(t, user, samlAssertion{}))
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("deactivated user: status %d", res.StatusCode)
+	}
+	if responseCookie(res, "jwt") != nil {
+		t.Error("deactivated user got a session cookie")
+	}
+	if n := loginFailures(t, user.Email, "inactive"); n != 1 {
+		t.Errorf("audited refusals: %d", n)
+	}
+}
+
+func TestSamlAsksForSecondFactor(t *testing.T) {
+	user := samlUser{Subject: "saml-totp", Email: "saml-totp@example.com"}
+	if res := samlAcs(samlStart(t, user, samlAssertion{})); res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("first login: status %d", res.StatusCode)
+	}
+	secret := enableTotp(t, user.Email)
+
+	res := samlAcs(samlStart(t, user, samlAssertion{}))
+	location, _ := url.Parse(res.Header.Get("Location"))
+	if res.StatusCode != http.StatusSeeOther || location == nil || location.Path != "/2fa" {
+		t.Fatalf("acs: status %d, location %q", res.StatusCode, res.Header.Get("Location"))
+	}
+	if responseCookie(res, "jwt") != nil {
+		t.Error("acs: session cookie before the second factor")
+	}
+	if cookie := responseCookie(res, "saml_state"); cookie == nil || cookie.MaxAge >= 0 {
+		t.Error("acs: state cookie not cleared")
+	}
+
+	res = twoFactorVerify(location.Query().Get("challenge"), totpCode(t, secret))
+	if res.StatusCode != http.StatusNoContent || responseCookie(res, "jwt") == nil {
+		t.Errorf("2fa verify: status %d", res.StatusCode)
+	}
+}
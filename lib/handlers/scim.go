@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"huma-app/lib/scim"
+	"huma-app/lib/security"
+	"huma-app/store/types"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// scimCoversRole keeps a provisioning client from managing accounts and roles
+// with permissions it does not have itself, like invitations do.
+func (rs *ApiHandlers) scimCoversRole(ctx context.Context, input *AuthHeader, role types.Role) error {
+	permissions, err := rs.repo.GetRolePermissions(ctx, role)
+	if err != nil {
+		return scim.ErrInternal("Cannot get permissions")
+	}
+	if covered, err := rs.security.HasPermissions(ctx, input.Role, permissions); err != nil || !covered {
+		return scim.NewError(http.StatusForbidden, "", "Cannot manage a role with permissions you do not have")
+	}
+	return nil
+}
+
+type ScimServiceProviderConfigOutput struct {
+	Body scim.ServiceProviderConfig
+}
+
+func (rs *ApiHandlers) RegisterScimServiceProviderConfig(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "scim-service-provider-config",
+		Summary:     "SCIM: service provider config",
+		Description: "Describes the supported SCIM features. Clients authenticate with an API key of a user whose role has the scim:provision permission, sent as a bearer token.",
+		Method:      http.MethodGet,
+		Path:        scim.BasePath + "/ServiceProviderConfig",
+		Tags:        []string{"SCIM"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermScimProvision}},
+		},
+	}, func(ctx context.Context, input *struct{}) (*ScimServiceProviderConfigOutput, error) {
+		return &ScimServiceProviderConfigOutput{Body: scim.ServiceProviderConfig{
+			Schemas: []string{scim.ServiceProviderConfigSchema},
+			Patch:   scim.Supported{Supported: true},
+			Filter:  scim.FilterSupport{Supported: true, MaxResults: 500},
+			AuthenticationSchemes: []scim.AuthenticationScheme{{
+				Type:        "oauthbearertoken",
+				Name:        "API key",
+				Description: "API key sent as Authorization: Bearer <key>",
+			}},
+		}}, nil
+	})
+}
@@ -0,0 +1,497 @@
+package handlers
+
+import (
+	"context"
+	"huma-app/lib/audit"
+	"huma-app/lib/scim"
+	"huma-app/lib/security"
+	"huma-app/store"
+	"huma-app/store/types"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+// ScimGroup is the SCIM Group resource of a role. The role name is both id
+// and displayName.
+type ScimGroup struct {
+	Schemas     []string          `json:"schemas"`
+	ID          types.Role        `json:"id"`
+	DisplayName string            `json:"displayName"`
+	Members     []scim.MultiValue `json:"members,omitempty"`
+	Meta        scim.Meta         `json:"meta"`
+}
+
+func (ScimGroup) ContentType(string) string {
+	return scim.MediaType
+}
+
+func (rs *ApiHandlers) scimGroupOutput(ctx context.Context, role store.Role) (ScimGroup, error) {
+	users, err := rs.repo.GetUsersByRole(ctx, role.Name)
+	if err != nil {
+		return ScimGroup{}, scim.ErrInternal("Cannot get members")
+	}
+	members := make([]scim.MultiValue, len(users))
+	for i, user := range users {
+		members[i] = scim.MultiValue{Value: user.ID.String(), Display: user.Email}
+	}
+	return ScimGroup{
+		Schemas:     []string{scim.GroupSchema},
+		ID:          role.Name,
+		DisplayName: string(role.Name),
+		Members:     members,
+		Meta: scim.Meta{
+			ResourceType: "Group",
+			Created:      role.CreatedAt.UTC().Format(time.RFC3339),
+			Location:     scim.BasePath + "/Groups/" + string(role.Name),
+		},
+	}, nil
+}
+
+func scimGroupAttributes(group ScimGroup) scim.Attributes {
+	attrs := scim.Attributes{
+		"id":           {string(group.ID)},
+		"displayname":  {group.DisplayName},
+		"meta.created": {group.Meta.Created},
+	}
+	for _, member := range group.Members {
+		attrs["members"] = append(attrs["members"], member.Value)
+		attrs["members.value"] = append(attrs["members.value"], member.Value)
+	}
+	return attrs
+}
+
+// excludesMembers reads the excludedAttributes parameter, which clients use
+// to skip the member lists of large groups.
+func excludesMembers(excluded string) bool {
+	for _, attr := range strings.Split(excluded, ",") {
+		if strings.EqualFold(strings.TrimSpace(attr), "members") {
+			return true
+		}
+	}
+	return false
+}
+
+// setScimMember gives the user the role. Users have a single role, so joining
+// a group leaves the previous one. The user is logged out everywhere, like
+// with set-user-role.
+func (rs *ApiHandlers) setScimMember(ctx context.Context, input *AuthHeader, member string, role types.Role) error {
+	id, err := uuid.Parse(member)
+	if err != nil {
+		return scim.NewError(http.StatusBadRequest, scim.ErrInvalidValue, "Unknown member "+member)
+	}
+	user, err := rs.repo.GetUserById(ctx, id)
+	if err != nil {
+		return scim.NewError(http.StatusBadRequest, scim.ErrInvalidValue, "Unknown member "+member)
+	}
+	if user.Role == role {
+		return nil
+	}
+	if id == input.UserId {
+		return scim.NewError(http.StatusBadRequest, scim.ErrMutability, "Cannot change your own role")
+	}
+	if err := rs.scimCoversRole(ctx, input, user.Role); err != nil {
+		return err
+	}
+	if err := rs.repo.SetUserRole(ctx, store.SetUserRoleParams{Role: role, ID: id}); err != nil {
+		return scim.ErrInternal("Cannot set role")
+	}
+	rs.audit.Record(ctx, audit.Event{
+		Action:   audit.ActionSetUserRole,
+		Target:   id.String(),
+		Metadata: map[string]any{"from": user.Role, "to": role},
+	})
+	if err := rs.security.RevokeUserTokens(ctx, id); err != nil {
+		return scim.ErrInternal("Cannot revoke tokens")
+	}
+	return nil
+}
+
+// removeScimMember moves a member of the role back to the user role.
+func (rs *ApiHandlers) removeScimMember(ctx context.Context, input *AuthHeader, member string, role types.Role) error {
+	if role == types.RoleUser {
+		return scim.NewError(http.StatusBadRequest, scim.ErrMutability, "Members cannot be removed from the user role")
+	}
+	id, err := uuid.Parse(member)
+	if err != nil {
+		return nil
+	}
+	if user, err := rs.repo.GetUserById(ctx, id); err != nil || user.Role != role {
+		return nil
+	}
+	return rs.setScimMember(ctx, input, member, types.RoleUser)
+}
+
+// replaceScimMembers makes the given users the members of the role.
+func (rs *ApiHandlers) replaceScimMembers(ctx context.Context, input *AuthHeader, role types.Role, members []string) error {
+	current, err := rs.repo.GetUsersByRole(ctx, role)
+	if err != nil {
+		return scim.ErrInternal("Cannot get members")
+	}
+	for _, user := range current {
+		if !slices.Contains(members, user.ID.String()) {
+			if err := rs.removeScimMember(ctx, input, user.ID.String(), role); err != nil {
+				return err
+			}
+		}
+	}
+	for _, member := range members {
+		if err := rs.setScimMember(ctx, input, member, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func memberValues(items []scim.MultiValue) []string {
+	values := make([]string, len(items))
+	for i, item := range items {
+		values[i] = strings.ToLower(item.Value)
+	}
+	return values
+}
+
+type ScimGroupsInput struct {
+	scim.ListParams
+	ExcludedAttributes string `query:"excludedAttributes" doc:"members leaves out the member lists"`
+}
+
+type ScimGroupsOutput struct {
+	Body scim.ListResponse[ScimGroup]
+}
+
+func (rs *ApiHandlers) RegisterScimGetGroups(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "scim-get-groups",
+		Summary:     "SCIM: get groups",
+		Description: "Lists roles as SCIM groups. Filters can use id, displayName, members and meta.created.",
+		Method:      http.MethodGet,
+		Path:        scim.BasePath + "/Groups",
+		Tags:        []string{"SCIM"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermScimProvision}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+		},
+	}, func(ctx context.Context, input *ScimGroupsInput) (*ScimGroupsOutput, error) {
+		filter, err := scim.ParseFilter(input.Filter)
+		if err != nil {
+			return nil, err
+		}
+		roles, err := rs.repo.GetRoles(ctx)
+		if err != nil {
+			return nil, scim.ErrInternal("Cannot get groups")
+		}
+		groups := []ScimGroup{}
+		for _, role := range roles {
+			group, err := rs.scimGroupOutput(ctx, role)
+			if err != nil {
+				return nil, err
+			}
+			if scim.Matches(filter, scimGroupAttributes(group)) {
+				if excludesMembers(input.ExcludedAttributes) {
+					group.Members = nil
+				}
+				groups = append(groups, group)
+			}
+		}
+		return &ScimGroupsOutput{Body: scim.NewListResponse(groups, input.StartIndex, input.Count)}, nil
+	})
+}
+
+type ScimGroupInput struct {
+	AuthHeader
+	ID                 types.Role `path:"id"`
+	ExcludedAttributes string     `query:"excludedAttributes" doc:"members leaves out the member list"`
+}
+
+type ScimGroupOutput struct {
+	Body ScimGroup
+}
+
+func (rs *ApiHandlers) RegisterScimGetGroup(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "scim-get-group",
+		Summary:     "SCIM: get group",
+		Method:      http.MethodGet,
+		Path:        scim.BasePath + "/Groups/{id}",
+		Tags:        []string{"SCIM"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermScimProvision}},
+		},
+		Errors: []int{
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *ScimGroupInput) (*ScimGroupOutput, error) {
+		role, err := rs.repo.GetRole(ctx, input.ID)
+		if err != nil {
+			return nil, scim.ErrNotFound("Group")
+		}
+		group, err := rs.scimGroupOutput(ctx, role)
+		if err != nil {
+			return nil, err
+		}
+		if excludesMembers(input.ExcludedAttributes) {
+			group.Members = nil
+		}
+		return &ScimGroupOutput{Body: group}, nil
+	})
+}
+
+type ScimGroupInputBody struct {
+	_           struct{}          `additionalProperties:"true"`
+	Schemas     []string          `json:"schemas,omitempty"`
+	DisplayName types.Role        `json:"displayName" minLength:"1" maxLength:"50" pattern:"^[a-z][a-z0-9_-]*$" doc:"Name of the role"`
+	Members     []scim.MultiValue `json:"members,omitempty" doc:"Values are user ids"`
+}
+
+type ScimCreateGroupInput struct {
+	AuthHeader
+	Body ScimGroupInputBody
+}
+
+type ScimCreateGroupOutput struct {
+	Location string `header:"Location"`
+	Body     ScimGroup
+}
+
+func (rs *ApiHandlers) RegisterScimCreateGroup(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID:   "scim-create-group",
+		Summary:       "SCIM: create group",
+		Description:   "Creates a role without permissions and moves the members to it. Permissions are granted with update-role.",
+		Method:        http.MethodPost,
+		Path:          scim.BasePath + "/Groups",
+		Tags:          []string{"SCIM"},
+		DefaultStatus: http.StatusCreated,
+		Security: []map[string][]string{
+			{"Bearer": {security.PermScimProvision}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusForbidden,
+			http.StatusConflict,
+		},
+	}, func(ctx context.Context, input *ScimCreateGroupInput) (*ScimCreateGroupOutput, error) {
+		if _, err := rs.repo.GetRole(ctx, input.Body.DisplayName); err == nil {
+			return nil, scim.NewError(http.StatusConflict, scim.ErrUniqueness, "Group already exists")
+		}
+		role, err := rs.repo.CreateRole(ctx, store.CreateRoleParams{Name: input.Body.DisplayName})
+		if err != nil {
+			return nil, scim.NewError(http.StatusBadRequest, scim.ErrInvalidValue, err.Error())
+		}
+		rs.audit.Record(ctx, audit.Event{
+			Action:   audit.ActionCreateRole,
+			Target:   string(role.Name),
+			Metadata: map[string]any{"permissions": []string{}},
+		})
+		if err := rs.replaceScimMembers(ctx, &input.AuthHeader, role.Name, memberValues(input.Body.Members)); err != nil {
+			return nil, err
+		}
+		group, err := rs.scimGroupOutput(ctx, role)
+		if err != nil {
+			return nil, err
+		}
+		return &ScimCreateGroupOutput{Location: group.Meta.Location, Body: group}, nil
+	})
+}
+
+type ScimReplaceGroupInput struct {
+	AuthHeader
+	ID   types.Role `path:"id"`
+	Body ScimGroupInputBody
+}
+
+func (rs *ApiHandlers) RegisterScimReplaceGroup(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "scim-replace-group",
+		Summary:     "SCIM: replace group",
+		Description: "Replaces the members of the role. Users no longer listed move to the user role. The displayName is the role name and cannot change.",
+		Method:      http.MethodPut,
+		Path:        scim.BasePath + "/Groups/{id}",
+		Tags:        []string{"SCIM"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermScimProvision}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *ScimReplaceGroupInput) (*ScimGroupOutput, error) {
+		role, err := rs.repo.GetRole(ctx, input.ID)
+		if err != nil {
+			return nil, scim.ErrNotFound("Group")
+		}
+		if input.Body.DisplayName != role.Name {
+			return nil, scim.NewError(http.StatusBadRequest, scim.ErrMutability, "displayName is the role name and cannot change")
+		}
+		if err := rs.scimCoversRole(ctx, &input.AuthHeader, role.Name); err != nil {
+			return nil, err
+		}
+		if err := rs.replaceScimMembers(ctx, &input.AuthHeader, role.Name, memberValues(input.Body.Members)); err != nil {
+			return nil, err
+		}
+		group, err := rs.scimGroupOutput(ctx, role)
+		if err != nil {
+			return nil, err
+		}
+		return &ScimGroupOutput{Body: group}, nil
+	})
+}
+
+type ScimPatchGroupInput struct {
+	AuthHeader
+	ID   types.Role `path:"id"`
+	Body scim.PatchRequest
+}
+
+func (rs *ApiHandlers) RegisterScimPatchGroup(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "scim-patch-group",
+		Summary:     "SCIM: patch group",
+		Description: "Adds, removes or replaces members. Removing a member moves the user to the user role; adding one moves the user out of its previous role.",
+		Method:      http.MethodPatch,
+		Path:        scim.BasePath + "/Groups/{id}",
+		Tags:        []string{"SCIM"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermScimProvision}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *ScimPatchGroupInput) (*ScimGroupOutput, error) {
+		role, err := rs.repo.GetRole(ctx, input.ID)
+		if err != nil {
+			return nil, scim.ErrNotFound("Group")
+		}
+		if err := rs.scimCoversRole(ctx, &input.AuthHeader, role.Name); err != nil {
+			return nil, err
+		}
+
+		for _, op := range input.Body.Operations {
+			kind, err := op.Kind()
+			if err != nil {
+				return nil, err
+			}
+			member, ok, err := scim.ValueFilter(op.Path, "members")
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				if kind != "remove" {
+					return nil, scim.NewError(http.StatusBadRequest, scim.ErrInvalidPath, "Filtered members can only be removed")
+				}
+				if err := rs.removeScimMember(ctx, &input.AuthHeader, member, role.Name); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			attrs, err := op.Attributes()
+			if err != nil {
+				return nil, err
+			}
+			for _, path := range slices.Sorted(maps.Keys(attrs)) {
+				value := attrs[path]
+				switch path {
+				case "displayname":
+					name, err := scim.String(path, value)
+					if err != nil {
+						return nil, err
+					}
+					if kind == "remove" || types.Role(name) != role.Name {
+						return nil, scim.NewError(http.StatusBadRequest, scim.ErrMutability, "displayName is the role name and cannot change")
+					}
+				case "members":
+					var members []string
+					if value != nil {
+						items, err := scim.MultiValues(path, value)
+						if err != nil {
+							return nil, err
+						}
+						members = memberValues(items)
+					}
+					switch {
+					case kind == "replace" || kind == "remove" && value == nil:
+						err = rs.replaceScimMembers(ctx, &input.AuthHeader, role.Name, members)
+					case kind == "remove":
+						for _, member := range members {
+							if err = rs.removeScimMember(ctx, &input.AuthHeader, member, role.Name); err != nil {
+								break
+							}
+						}
+					default:
+						for _, member := range members {
+							if err = rs.setScimMember(ctx, &input.AuthHeader, member, role.Name); err != nil {
+								break
+							}
+						}
+					}
+					if err != nil {
+						return nil, err
+					}
+				}
+				// Other attributes, like externalId, have no place in the
+				// store and are ignored.
+			}
+		}
+
+		group, err := rs.scimGroupOutput(ctx, role)
+		if err != nil {
+			return nil, err
+		}
+		return &ScimGroupOutput{Body: group}, nil
+	})
+}
+
+func (rs *ApiHandlers) RegisterScimDeleteGroup(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID:   "scim-delete-group",
+		Summary:       "SCIM: delete group",
+		Description:   "Moves the members to the user role and deletes the role. Built-in roles cannot be deleted.",
+		Method:        http.MethodDelete,
+		Path:          scim.BasePath + "/Groups/{id}",
+		Tags:          []string{"SCIM"},
+		DefaultStatus: http.StatusNoContent,
+		Security: []map[string][]string{
+			{"Bearer": {security.PermScimProvision}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *ScimGroupInput) (*struct{}, error) {
+		role, err := rs.repo.GetRole(ctx, input.ID)
+		if err != nil {
+			return nil, scim.ErrNotFound("Group")
+		}
+		if role.Builtin == 1 {
+			return nil, scim.NewError(http.StatusBadRequest, scim.ErrMutability, "Built-in roles cannot be deleted")
+		}
+		if err := rs.scimCoversRole(ctx, &input.AuthHeader, role.Name); err != nil {
+			return nil, err
+		}
+		if err := rs.replaceScimMembers(ctx, &input.AuthHeader, role.Name, nil); err != nil {
+			return nil, err
+		}
+		if _, err := rs.repo.DeleteRole(ctx, role.Name); err != nil {
+			return nil, scim.ErrInternal("Cannot delete group")
+		}
+		rs.security.InvalidatePermissions()
+		rs.audit.Record(ctx, audit.Event{
+			Action: audit.ActionDeleteRole,
+			Target: string(role.Name),
+		})
+		return nil, nil
+	})
+}
@@ -0,0 +1,442 @@
+package handlers
+
+import (
+	"context"
+	"huma-app/lib/audit"
+	"huma-app/lib/scim"
+	"huma-app/lib/security"
+	"huma-app/store"
+	"maps"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+// ScimUser is the SCIM User resource of an account. The userName is the
+// email address and the role is the only group.
+type ScimUser struct {
+	Schemas    []string          `json:"schemas"`
+	ID         uuid.UUID         `json:"id"`
+	ExternalID string            `json:"externalId,omitempty"`
+	UserName   string            `json:"userName"`
+	Active     bool              `json:"active"`
+	Emails     []scim.MultiValue `json:"emails"`
+	Groups     []scim.MultiValue `json:"groups" doc:"Read-only, membership is changed through the group"`
+	Meta       scim.Meta         `json:"meta"`
+}
+
+func (ScimUser) ContentType(string) string {
+	return scim.MediaType
+}
+
+func scimUserOutput(user store.GetScimUserRow) ScimUser {
+	return ScimUser{
+		Schemas:    []string{scim.UserSchema},
+		ID:         user.ID,
+		ExternalID: user.ExternalID,
+		UserName:   user.Email,
+		Active:     user.Active == 1,
+		Emails:     []scim.MultiValue{{Value: user.Email, Type: "work", Primary: true}},
+		Groups:     []scim.MultiValue{{Value: string(user.Role), Display: string(user.Role)}},
+		Meta: scim.Meta{
+			ResourceType: "User",
+			Created:      user.CreatedAt.UTC().Format(time.RFC3339),
+			Location:     scim.BasePath + "/Users/" + user.ID.String(),
+		},
+	}
+}
+
+func scimUserAttributes(user ScimUser) scim.Attributes {
+	attrs := scim.Attributes{
+		"id":           {user.ID.String()},
+		"username":     {user.UserName},
+		"active":       {strconv.FormatBool(user.Active)},
+		"emails":       {user.UserName},
+		"emails.value": {user.UserName},
+		"groups":       {user.Groups[0].Value},
+		"groups.value": {user.Groups[0].Value},
+		"meta.created": {user.Meta.Created},
+	}
+	if user.ExternalID != "" {
+		attrs["externalid"] = []string{user.ExternalID}
+	}
+	return attrs
+}
+
+func validScimEmail(email string) error {
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return scim.NewError(http.StatusBadRequest, scim.ErrInvalidValue, "userName must be an email address")
+	}
+	return nil
+}
+
+// updateScimUser brings the account to the given state. Deactivating logs the
+// user out everywhere.
+func (rs *ApiHandlers) updateScimUser(ctx context.Context, input *AuthHeader, user store.GetScimUserRow, email, externalID string, active bool) (ScimUser, error) {
+	if user.ID == input.UserId && !active {
+		return ScimUser{}, scim.NewError(http.StatusBadRequest, scim.ErrMutability, "Cannot deactivate yourself")
+	}
+	if err := rs.scimCoversRole(ctx, input, user.Role); err != nil {
+		return ScimUser{}, err
+	}
+
+	changes := map[string]any{}
+	if email != user.Email {
+		if err := validScimEmail(email); err != nil {
+			return ScimUser{}, err
+		}
+		if existing, err := rs.repo.GetUserByEmail(ctx, email); err == nil && existing.ID != user.ID {
+			return ScimUser{}, scim.NewError(http.StatusConflict, scim.ErrUniqueness, "userName is already in use")
+		}
+		if err := rs.repo.UpdateUserEmail(ctx, store.UpdateUserEmailParams{Email: email, ID: user.ID}); err != nil {
+			return ScimUser{}, scim.ErrInternal("Cannot update user")
+		}
+		changes["email"] = map[string]string{"from": user.Email, "to": email}
+	}
+	if externalID != user.ExternalID {
+		if err := rs.repo.SetUserExternalID(ctx, store.SetUserExternalIDParams{ExternalID: externalID, ID: user.ID}); err != nil {
+			return ScimUser{}, scim.ErrInternal("Cannot update user")
+		}
+		changes["external_id"] = map[string]string{"from": user.ExternalID, "to": externalID}
+	}
+	if len(changes) > 0 {
+		rs.audit.Record(ctx, audit.Event{
+			Action:   audit.ActionUpdateUser,
+			Target:   user.ID.String(),
+			Metadata: changes,
+		})
+	}
+
+	if active != (user.Active == 1) {
+		var flag int64
+		action := audit.ActionDeactivateUser
+		if active {
+			flag, action = 1, audit.ActionActivateUser
+		}
+		if err := rs.repo.SetUserActive(ctx, store.SetUserActiveParams{Active: flag, ID: user.ID}); err != nil {
+			return ScimUser{}, scim.ErrInternal("Cannot update user")
+		}
+		if !active {
+			if err := rs.security.RevokeUserTokens(ctx, user.ID); err != nil {
+				return ScimUser{}, scim.ErrInternal("Cannot revoke tokens")
+			}
+		}
+		rs.audit.Record(ctx, audit.Event{Action: action, Target: user.ID.String()})
+	}
+
+	user, err := rs.repo.GetScimUser(ctx, user.ID)
+	if err != nil {
+		return ScimUser{}, scim.ErrInternal("Cannot get user")
+	}
+	return scimUserOutput(user), nil
+}
+
+type ScimUsersInput struct {
+	scim.ListParams
+}
+
+type ScimUsersOutput struct {
+	Body scim.ListResponse[ScimUser]
+}
+
+func (rs *ApiHandlers) RegisterScimGetUsers(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "scim-get-users",
+		Summary:     "SCIM: get users",
+		Description: "Lists accounts as SCIM users, oldest first. Filters can use id, userName, externalId, active, emails, groups and meta.created.",
+		Method:      http.MethodGet,
+		Path:        scim.BasePath + "/Users",
+		Tags:        []string{"SCIM"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermScimProvision}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+		},
+	}, func(ctx context.Context, input *ScimUsersInput) (*ScimUsersOutput, error) {
+		filter, err := scim.ParseFilter(input.Filter)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := rs.repo.GetScimUsers(ctx)
+		if err != nil {
+			return nil, scim.ErrInternal("Cannot get users")
+		}
+		users := []ScimUser{}
+		for _, row := range rows {
+			user := scimUserOutput(store.GetScimUserRow(row))
+			if scim.Matches(filter, scimUserAttributes(user)) {
+				users = append(users, user)
+			}
+		}
+		return &ScimUsersOutput{Body: scim.NewListResponse(users, input.StartIndex, input.Count)}, nil
+	})
+}
+
+type ScimUserInput struct {
+	AuthHeader
+	ID uuid.UUID `path:"id"`
+}
+
+type ScimUserOutput struct {
+	Body ScimUser
+}
+
+func (rs *ApiHandlers) RegisterScimGetUser(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "scim-get-user",
+		Summary:     "SCIM: get user",
+		Method:      http.MethodGet,
+		Path:        scim.BasePath + "/Users/{id}",
+		Tags:        []string{"SCIM"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermScimProvision}},
+		},
+		Errors: []int{
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *ScimUserInput) (*ScimUserOutput, error) {
+		user, err := rs.repo.GetScimUser(ctx, input.ID)
+		if err != nil {
+			return nil, scim.ErrNotFound("User")
+		}
+		return &ScimUserOutput{Body: scimUserOutput(user)}, nil
+	})
+}
+
+type ScimUserInputBody struct {
+	// Attributes the store has no place for, like name, are accepted and
+	// ignored.
+	_          struct{} `additionalProperties:"true"`
+	Schemas    []string `json:"schemas,omitempty"`
+	ExternalID string   `json:"externalId,omitempty" maxLength:"255"`
+	UserName   string   `json:"userName" format:"email" doc:"Email address of the account"`
+	Active     *bool    `json:"active,omitempty" doc:"Defaults to true"`
+}
+
+type ScimCreateUserInput struct {
+	AuthHeader
+	Body ScimUserInputBody
+}
+
+type ScimCreateUserOutput struct {
+	Location string `header:"Location"`
+	Body     ScimUser
+}
+
+func (rs *ApiHandlers) RegisterScimCreateUser(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID:   "scim-create-user",
+		Summary:       "SCIM: create user",
+		Description:   "Creates a verified account without a password and with the user role. The user logs in through SSO or a magic link, or sets a password with the forgot password flow.",
+		Method:        http.MethodPost,
+		Path:          scim.BasePath + "/Users",
+		Tags:          []string{"SCIM"},
+		DefaultStatus: http.StatusCreated,
+		Security: []map[string][]string{
+			{"Bearer": {security.PermScimProvision}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusConflict,
+		},
+	}, func(ctx context.Context, input *ScimCreateUserInput) (*ScimCreateUserOutput, error) {
+		if _, err := rs.repo.GetUserByEmail(ctx, input.Body.UserName); err == nil {
+			return nil, scim.NewError(http.StatusConflict, scim.ErrUniqueness, "userName is already in use")
+		}
+		created, err := rs.repo.CreateUser(ctx, store.CreateUserParams{
+			ID:    uuid.New(),
+			Email: input.Body.UserName,
+		})
+		if err != nil {
+			return nil, scim.NewError(http.StatusBadRequest, scim.ErrInvalidValue, err.Error())
+		}
+		if err := rs.repo.VerifyUser(ctx, created.ID); err != nil {
+			return nil, scim.ErrInternal("Cannot verify user")
+		}
+		if input.Body.ExternalID != "" {
+			err := rs.repo.SetUserExternalID(ctx, store.SetUserExternalIDParams{ExternalID: input.Body.ExternalID, ID: created.ID})
+			if err != nil {
+				return nil, scim.ErrInternal("Cannot create user")
+			}
+		}
+		if input.Body.Active != nil && !*input.Body.Active {
+			if err := rs.repo.SetUserActive(ctx, store.SetUserActiveParams{Active: 0, ID: created.ID}); err != nil {
+				return nil, scim.ErrInternal("Cannot create user")
+			}
+		}
+		rs.audit.Record(ctx, audit.Event{
+			Action:   audit.ActionProvisionUser,
+			Target:   created.ID.String(),
+			Metadata: map[string]any{"email": created.Email, "external_id": input.Body.ExternalID},
+		})
+
+		user, err := rs.repo.GetScimUser(ctx, created.ID)
+		if err != nil {
+			return nil, scim.ErrInternal("Cannot get user")
+		}
+		body := scimUserOutput(user)
+		return &ScimCreateUserOutput{Location: body.Meta.Location, Body: body}, nil
+	})
+}
+
+type ScimReplaceUserInput struct {
+	AuthHeader
+	ID   uuid.UUID `path:"id"`
+	Body ScimUserInputBody
+}
+
+func (rs *ApiHandlers) RegisterScimReplaceUser(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "scim-replace-user",
+		Summary:     "SCIM: replace user",
+		Description: "Sets userName, externalId and active. A missing externalId is cleared and a missing active means true. Deactivated users are logged out everywhere and cannot log in.",
+		Method:      http.MethodPut,
+		Path:        scim.BasePath + "/Users/{id}",
+		Tags:        []string{"SCIM"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermScimProvision}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusForbidden,
+			http.StatusNotFound,
+			http.StatusConflict,
+		},
+	}, func(ctx context.Context, input *ScimReplaceUserInput) (*ScimUserOutput, error) {
+		user, err := rs.repo.GetScimUser(ctx, input.ID)
+		if err != nil {
+			return nil, scim.ErrNotFound("User")
+		}
+		active := input.Body.Active == nil || *input.Body.Active
+		body, err := rs.updateScimUser(ctx, &input.AuthHeader, user, input.Body.UserName, input.Body.ExternalID, active)
+		if err != nil {
+			return nil, err
+		}
+		return &ScimUserOutput{Body: body}, nil
+	})
+}
+
+type ScimPatchUserInput struct {
+	AuthHeader
+	ID   uuid.UUID `path:"id"`
+	Body scim.PatchRequest
+}
+
+func (rs *ApiHandlers) RegisterScimPatchUser(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "scim-patch-user",
+		Summary:     "SCIM: patch user",
+		Description: "Changes userName, emails, externalId and active. Other attributes are ignored, groups are changed through the group.",
+		Method:      http.MethodPatch,
+		Path:        scim.BasePath + "/Users/{id}",
+		Tags:        []string{"SCIM"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermScimProvision}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusForbidden,
+			http.StatusNotFound,
+			http.StatusConflict,
+		},
+	}, func(ctx context.Context, input *ScimPatchUserInput) (*ScimUserOutput, error) {
+		user, err := rs.repo.GetScimUser(ctx, input.ID)
+		if err != nil {
+			return nil, scim.ErrNotFound("User")
+		}
+
+		email, externalID, active := user.Email, user.ExternalID, user.Active == 1
+		for _, op := range input.Body.Operations {
+			kind, err := op.Kind()
+			if err != nil {
+				return nil, err
+			}
+			attrs, err := op.Attributes()
+			if err != nil {
+				return nil, err
+			}
+			// Sorted, so userName wins over emails given in the same value.
+			for _, path := range slices.Sorted(maps.Keys(attrs)) {
+				value := attrs[path]
+				isEmail := path == "emails" || strings.HasPrefix(path, "emails[") && strings.HasSuffix(path, "].value")
+				switch {
+				case kind == "remove" && (path == "active" || path == "username" || isEmail):
+					return nil, scim.NewError(http.StatusBadRequest, scim.ErrMutability, path+" cannot be removed")
+				case path == "groups" || strings.HasPrefix(path, "groups["):
+					return nil, scim.NewError(http.StatusBadRequest, scim.ErrMutability, "groups are changed through the group")
+				case path == "active":
+					active, err = scim.Bool(path, value)
+				case path == "username":
+					email, err = scim.String(path, value)
+				case path == "emails":
+					var items []scim.MultiValue
+					if items, err = scim.MultiValues(path, value); err == nil && scim.Primary(items) != "" {
+						email = scim.Primary(items)
+					}
+				case isEmail:
+					email, err = scim.String(path, value)
+				case path == "externalid" && kind == "remove":
+					externalID = ""
+				case path == "externalid":
+					externalID, err = scim.String(path, value)
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		body, err := rs.updateScimUser(ctx, &input.AuthHeader, user, email, externalID, active)
+		if err != nil {
+			return nil, err
+		}
+		return &ScimUserOutput{Body: body}, nil
+	})
+}
+
+func (rs *ApiHandlers) RegisterScimDeleteUser(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID:   "scim-delete-user",
+		Summary:       "SCIM: delete user",
+		Description:   "Deletes the account. Identity providers usually deactivate instead, which keeps the data.",
+		Method:        http.MethodDelete,
+		Path:          scim.BasePath + "/Users/{id}",
+		Tags:          []string{"SCIM"},
+		DefaultStatus: http.StatusNoContent,
+		Security: []map[string][]string{
+			{"Bearer": {security.PermScimProvision}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *ScimUserInput) (*struct{}, error) {
+		if input.ID == input.UserId {
+			return nil, scim.NewError(http.StatusBadRequest, scim.ErrMutability, "Cannot delete yourself")
+		}
+		user, err := rs.repo.GetScimUser(ctx, input.ID)
+		if err != nil {
+			return nil, scim.ErrNotFound("User")
+		}
+		if err := rs.scimCoversRole(ctx, &input.AuthHeader, user.Role); err != nil {
+			return nil, err
+		}
+		if err := rs.repo.DeleteUser(ctx, user.ID); err != nil {
+			return nil, scim.ErrInternal("Cannot delete user")
+		}
+		rs.audit.Record(ctx, audit.Event{
+			Action:   audit.ActionDeleteUser,
+			Target:   user.ID.String(),
+			Metadata: map[string]any{"email": user.Email},
+		})
+		return nil, nil
+	})
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+type SessionOutputBody struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device" doc:"Browser and OS guessed from the user agent"`
+	UserAgent  string    `json:"user_agent"`
+	Ip         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current" doc:"The session this request is made from"`
+}
+
+type GetSessionsOutput struct {
+	Body []SessionOutputBody
+}
+
+func (rs *ApiHandlers) RegisterGetSessions(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-sessions",
+		Summary:     "Get sessions",
+		Description: "Lists active logins of the current user, most recently used first.",
+		Method:      http.MethodGet,
+		Path:        "/api/auth/sessions",
+		Tags:        []string{"Auth"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+	}, func(ctx context.Context, input *AuthHeader) (*GetSessionsOutput, error) {
+		rows, err := rs.security.GetUserSessions(ctx, input.UserId)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot get sessions")
+		}
+		sessions := make([]SessionOutputBody, len(rows))
+		for i, row := range rows {
+			sessions[i] = SessionOutputBody{
+				ID:         row.ID,
+				Device:     row.Device,
+				UserAgent:  row.UserAgent,
+				Ip:         row.Ip,
+				CreatedAt:  row.CreatedAt,
+				LastSeenAt: row.LastSeenAt,
+				Current:    row.ID == input.Family,
+			}
+		}
+		return &GetSessionsOutput{Body: sessions}, nil
+	})
+}
+
+type DeleteSessionInput struct {
+	AuthHeader
+	ID string `path:"id"`
+}
+
+func (rs *ApiHandlers) RegisterDeleteSession(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-session",
+		Summary:     "Revoke session",
+		Description: "Logs the user out on one device. Its tokens stop working immediately.",
+		Method:      http.MethodDelete,
+		Path:        "/api/auth/sessions/{id}",
+		Tags:        []string{"Auth"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Errors: []int{
+			http.StatusForbidden,
+			http.StatusNotFound,
+		},
+	}, func(ctx context.Context, input *DeleteSessionInput) (*struct{}, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		if err := rs.security.RevokeUserSession(ctx, input.UserId, input.ID); err != nil {
+			return nil, huma.Error404NotFound("Session not found")
+		}
+		return nil, nil
+	})
+}
+
+func (rs *ApiHandlers) RegisterDeleteOtherSessions(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-other-sessions",
+		Summary:     "Log out everywhere else",
+		Description: "Revokes every session of the current user except the one this request is made from.",
+		Method:      http.MethodDelete,
+		Path:        "/api/auth/sessions",
+		Tags:        []string{"Auth"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+		},
+	}, func(ctx context.Context, input *AuthHeader) (*struct{}, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+
+		if input.Family == "" {
+			return nil, huma.Error400BadRequest("Request is not made from a session")
+		}
+		if err := rs.security.RevokeOtherSessions(ctx, input.UserId, input.Family); err != nil {
+			return nil, huma.Error500InternalServerError("Cannot revoke sessions")
+		}
+		return nil, nil
+	})
+}
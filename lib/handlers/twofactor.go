@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"context"
+	"huma-app/lib/middleware"
+	"huma-app/lib/security"
+	"huma-app/store"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	recoveryCodesCount = 10
+	// Wrong codes after which a login challenge is revoked and the login
+	// has to start over with the password.
+	twoFactorMaxAttempts = 5
+)
+
+type TwoFactorEnrollOutputBody struct {
+	Uri   string `json:"uri" doc:"otpauth:// URI for authenticator apps"`
+	QrPng []byte `json:"qr_png" doc:"Base64 encoded PNG with the QR code of the URI"`
+}
+
+type TwoFactorEnrollOutput struct {
+	Body TwoFactorEnrollOutputBody
+}
+
+func (rs *ApiHandlers) RegisterTwoFactorEnroll(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "two-factor-enroll",
+		Summary:     "Start 2FA enrollment",
+		Description: "Generates a new TOTP secret for the current user. Two-factor authentication is enabled only after the first code is confirmed.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/2fa/enroll",
+		Tags:        []string{"Auth"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Errors: []int{
+			http.StatusUnauthorized,
+			http.StatusConflict,
+		},
+	}, func(ctx context.Context, input *AuthHeader) (*TwoFactorEnrollOutput, error) {
+
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+
+		user, err := rs.repo.GetUserTotp(ctx, input.UserId)
+		if err != nil {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		if user.TotpEnabled == 1 {
+			return nil, huma.Error409Conflict("Two-factor authentication is already enabled")
+		}
+
+		key, err := security.GenerateTotpKey(user.Email)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot generate secret")
+		}
+		err = rs.repo.SetUserTotpSecret(ctx, store.SetUserTotpSecretParams{
+			TotpSecret: key.Secret,
+			ID:         user.ID,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot generate secret")
+		}
+
+		return &TwoFactorEnrollOutput{Body: TwoFactorEnrollOutputBody{
+			Uri:   key.URL,
+			QrPng: key.QrPng,
+		}}, nil
+	})
+}
+
+type TwoFactorCodeInputBody struct {
+	Code string `json:"code" required:"true" doc:"Code from the authenticator app"`
+}
+
+type TwoFactorCodeInput struct {
+	AuthHeader
+	Body TwoFactorCodeInputBody
+}
+
+type RecoveryCodesOutputBody struct {
+	RecoveryCodes []string `json:"recovery_codes" doc:"One-time codes to use when the authenticator is not available"`
+}
+
+type RecoveryCodesOutput struct {
+	Body RecoveryCodesOutputBody
+}
+
+func (rs *ApiHandlers) RegisterTwoFactorConfirm(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "two-factor-confirm",
+		Summary:     "Confirm 2FA enrollment",
+		Description: "Enables two-factor authentication once the first code from the authenticator app is valid. Returns recovery codes, which are shown only once.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/2fa/confirm",
+		Tags:        []string{"Auth"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusUnauthorized,
+			http.StatusConflict,
+		},
+	}, func(ctx context.Context, input *TwoFactorCodeInput) (*RecoveryCodesOutput, error) {
+
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+
+		user, err := rs.repo.GetUserTotp(ctx, input.UserId)
+		if err != nil {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		if user.TotpEnabled == 1 {
+			return nil, huma.Error409Conflict("Two-factor authentication is already enabled")
+		}
+		if user.TotpSecret == "" {
+			return nil, huma.Error400BadRequest("Two-factor enrollment is not started")
+		}
+		if !rs.checkTotp(ctx, user.ID, input.Body.Code, user.TotpSecret) {
+			return nil, huma.Error400BadRequest("Invalid code")
+		}
+
+		if err := rs.repo.EnableUserTotp(ctx, user.ID); err != nil {
+			return nil, huma.Error500InternalServerError("Cannot enable two-factor authentication")
+		}
+		codes, err := rs.resetRecoveryCodes(ctx, user.ID)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot generate recovery codes")
+		}
+		rs.noticeTwoFactorChanged(ctx, user.ID, true)
+
+		return &RecoveryCodesOutput{Body: RecoveryCodesOutputBody{RecoveryCodes: codes}}, nil
+	})
+}
+
+func (rs *ApiHandlers) RegisterTwoFactorRecoveryCodes(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "two-factor-recovery-codes",
+		Summary:     "Regenerate recovery codes",
+		Description: "Replaces all recovery codes of the current user with new ones.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/2fa/recovery-codes",
+		Tags:        []string{"Auth"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusUnauthorized,
+		},
+	}, func(ctx context.Context, input *TwoFactorCodeInput) (*RecoveryCodesOutput, error) {
+
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+
+		user, err := rs.repo.GetUserTotp(ctx, input.UserId)
+		if err != nil {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		if user.TotpEnabled == 0 || !rs.checkTotp(ctx, user.ID, input.Body.Code, user.TotpSecret) {
+			return nil, huma.Error400BadRequest("Invalid code")
+		}
+
+		codes, err := rs.resetRecoveryCodes(ctx, user.ID)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot generate recovery codes")
+		}
+
+		return &RecoveryCodesOutput{Body: RecoveryCodesOutputBody{RecoveryCodes: codes}}, nil
+	})
+}
+
+func (rs *ApiHandlers) RegisterTwoFactorDisable(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "two-factor-disable",
+		Summary:     "Disable 2FA",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/2fa/disable",
+		Tags:        []string{"Auth"},
+		Security: []map[string][]string{
+			{"Bearer": {}},
+		},
+		Errors: []int{
+			http.StatusBadRequest,
+			http.StatusUnauthorized,
+		},
+	}, func(ctx context.Context, input *TwoFactorCodeInput) (*StatusOutput, error) {
+
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+
+		user, err := rs.repo.GetUserTotp(ctx, input.UserId)
+		if err != nil {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		if user.TotpEnabled == 0 || !rs.checkTotp(ctx, user.ID, input.Body.Code, user.TotpSecret) {
+			return nil, huma.Error400BadRequest("Invalid code")
+		}
+
+		if err := rs.disableTwoFactor(ctx, user.ID); err != nil {
+			return nil, huma.Error500InternalServerError("Cannot disable two-factor authentication")
+		}
+		rs.noticeTwoFactorChanged(ctx, user.ID, false)
+
+		return &StatusOutput{Status: http.StatusOK}, nil
+	})
+}
+
+type TwoFactorVerifyInputBody struct {
+	Challenge    string `json:"challenge" required:"true" doc:"Challenge token returned by login"`
+	Code         string `json:"code,omitempty" doc:"Code from the authenticator app"`
+	RecoveryCode string `json:"recovery_code,omitempty" doc:"One of the recovery codes, if the authenticator is not available"`
+}
+
+type TwoFactorVerifyInput struct {
+	Body TwoFactorVerifyInputBody
+}
+
+func (rs *ApiHandlers) RegisterTwoFactorVerify(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "two-factor-verify",
+		Summary:     "Verify second factor",
+		Description: "Finishes a login that returned a two-factor challenge. Accepts either a TOTP code or a recovery code. Each TOTP code is accepted once, and the challenge is revoked after 5 wrong codes.",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/2fa/verify",
+		Tags:        []string{"Auth"},
+		Middlewares: huma.Middlewares{middleware.RateLimitMiddleware(api, rs.limiter.TwoFactor)},
+		Errors: []int{
+			http.StatusUnauthorized,
+			http.StatusForbidden,
+		},
+	}, func(ctx context.Context, input *TwoFactorVerifyInput) (*LoginOutput, error) {
+
+		challenge, err := rs.security.VerifyToken(ctx, input.Body.Challenge, security.TwoFactorToken)
+		if err != nil {
+			return nil, huma.Error401Unauthorized("Invalid or expired challenge")
+		}
+
+		user, err := rs.repo.GetUserTotp(ctx, challenge.UserID)
+		if err != nil || user.TotpEnabled == 0 {
+			return nil, huma.Error401Unauthorized("Invalid or expired challenge")
+		}
+		if err := rs.denyInactive(ctx, user.ID, user.Email, user.Active); err != nil {
+			return nil, err
+		}
+
+		var valid bool
+		switch {
+		case input.Body.Code != "":
+			valid = rs.checkTotp(ctx, user.ID, input.Body.Code, user.TotpSecret)
+		case input.Body.RecoveryCode != "":
+			n, err := rs.repo.UseRecoveryCode(ctx, store.UseRecoveryCodeParams{
+				UserID:   user.ID,
+				CodeHash: security.HashRecoveryCode(input.Body.RecoveryCode),
+			})
+			valid = err == nil && n == 1
+		}
+		if !valid {
+			failures, err := rs.repo.RecordTwoFactorFailure(ctx, challenge.ID)
+			if err != nil || failures >= twoFactorMaxAttempts {
+				rs.security.RevokeToken(ctx, challenge.ID)
+			}
+			return nil, huma.Error401Unauthorized("Invalid code")
+		}
+
+		rs.security.RevokeToken(ctx, challenge.ID)
+
+		cookies, err := rs.security.GenerateSessionCookies(ctx, user.ID, user.Role, "")
+		if err != nil {
+			return nil, sessionError(err)
+		}
+		rs.loggedIn(ctx, user.ID, "2fa")
+
+		return &LoginOutput{
+			SetCookie: setCookies(cookies...),
+			Status:    http.StatusNoContent,
+		}, nil
+	})
+}
+
+// checkTotp validates a code and claims its time step for the user. A code
+// of a step that was already accepted, or of an earlier one, is rejected.
+func (rs *ApiHandlers) checkTotp(ctx context.Context, userID uuid.UUID, code, secret string) bool {
+	step, ok := rs.security.ValidateTotp(code, secret)
+	if !ok {
+		return false
+	}
+	n, err := rs.repo.ClaimTotpStep(ctx, store.ClaimTotpStepParams{Step: step, ID: userID})
+	return err == nil && n == 1
+}
+
+// resetRecoveryCodes replaces the recovery codes of the user and returns the
+// new ones in plain text. Only their hashes are stored.
+func (rs *ApiHandlers) resetRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	codes, err := security.GenerateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := rs.repo.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		err := rs.repo.CreateRecoveryCode(ctx, store.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: security.HashRecoveryCode(code),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func (rs *ApiHandlers) disableTwoFactor(ctx context.Context, userID uuid.UUID) error {
+	if err := rs.repo.DisableUserTotp(ctx, userID); err != nil {
+		return err
+	}
+	return rs.repo.DeleteRecoveryCodes(ctx, userID)
+}
@@ -0,0 +1,96 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+// enableTotp turns on two-factor authentication for the user with email and
+// returns the secret of the authenticator.
+func enableTotp(t *testing.T, email string) string {
+	t.Helper()
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "Test", AccountName: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := db.Exec(`UPDATE users SET totp_secret = ?, totp_enabled = 1 WHERE email = ?`, key.Secret(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Fatalf("no user %s", email)
+	}
+	return key.Secret()
+}
+
+func totpCode(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func twoFactorVerify(challenge, code string) *http.Response {
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/2fa/verify",
+		strings.NewReader(`{"challenge":"`+challenge+`","code":"`+code+`"}`))
+	r.Header.Set("Content-Type", "application/json")
+	return serve(r)
+}
+
+// challenge logs in as email and returns the two-factor challenge.
+func challenge(t *testing.T, email string) string {
+	t.Helper()
+	res := login(email, testPassword)
+	var body struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		Challenge         string `json:"challenge"`
+	}
+	json.NewDecoder(res.Body).Decode(&body)
+	if res.StatusCode != http.StatusOK || !body.TwoFactorRequired || body.Challenge == "" {
+		t.Fatalf("login: status %d, no challenge", res.StatusCode)
+	}
+	return body.Challenge
+}
+
+func TestTwoFactorCodeIsAcceptedOnce(t *testing.T) {
+	createUser(t, "totp-replay@example.com", true)
+	secret := enableTotp(t, "totp-replay@example.com")
+	code := totpCode(t, secret)
+
+	res := twoFactorVerify(challenge(t, "totp-replay@example.com"), code)
+	if res.StatusCode != http.StatusNoContent || responseCookie(res, "jwt") == nil {
+		t.Fatalf("first use: status %d", res.StatusCode)
+	}
+	res = twoFactorVerify(challenge(t, "totp-replay@example.com"), code)
+	if res.StatusCode != http.StatusUnauthorized || responseCookie(res, "jwt") != nil {
+		t.Errorf("replayed code: status %d", res.StatusCode)
+	}
+}
+
+func TestTwoFactorChallengeRevokedAfterWrongCodes(t *testing.T) {
+	createUser(t, "totp-guess@example.com", true)
+	secret := enableTotp(t, "totp-guess@example.com")
+	code := totpCode(t, secret)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	token := challenge(t, "totp-guess@example.com")
+	for i := 0; i < 5; i++ {
+		if res := twoFactorVerify(token, wrong); res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: status %d", i+1, res.StatusCode)
+		}
+	}
+	if res := twoFactorVerify(token, code); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("right code after 5 wrong ones: status %d", res.StatusCode)
+	}
+}
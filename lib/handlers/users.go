@@ -2,17 +2,28 @@ package handlers
 
 import (
 	"context"
+	"huma-app/lib/audit"
+	"huma-app/lib/authn"
+	"huma-app/lib/config"
+	"huma-app/lib/security"
 	"huma-app/store"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/google/uuid"
 )
 
 type DeleteUserInput struct {
+	AuthHeader
 	ID uuid.UUID `path:"id"`
 }
 
+type GetAllUsersInput struct {
+	Org uuid.UUID `query:"org" doc:"Only members of this organization"`
+}
+
 type GetAllUsersOutput struct {
 	Body []store.GetUsersRow
 }
@@ -25,9 +36,20 @@ func (rs *ApiHandlers) RegisterGetAll(api huma.API) {
 		Path:        "/api/users",
 		Tags:        []string{"Users"},
 		Security: []map[string][]string{
-			{"Bearer": {"admin"}},
+			{"Bearer": {security.PermUsersRead}},
 		},
-	}, func(ctx context.Context, input *struct{}) (*GetAllUsersOutput, error) {
+	}, func(ctx context.Context, input *GetAllUsersInput) (*GetAllUsersOutput, error) {
+		if input.Org != uuid.Nil {
+			rows, err := rs.repo.GetUsersByOrg(ctx, input.Org)
+			if err != nil {
+				return nil, huma.Error500InternalServerError("Cannot get users")
+			}
+			users := make([]store.GetUsersRow, len(rows))
+			for i, row := range rows {
+				users[i] = store.GetUsersRow(row)
+			}
+			return &GetAllUsersOutput{Body: users}, nil
+		}
 		rows, _ := rs.repo.GetUsers(ctx)
 		return &GetAllUsersOutput{Body: rows}, nil
 	})
@@ -41,13 +63,144 @@ func (rs *ApiHandlers) RegisterDelete(api huma.API) {
 		Path:        "/api/users/{id}",
 		Tags:        []string{"Users"},
 		Security: []map[string][]string{
-			{"Bearer": {"admin"}},
+			{"Bearer": {security.PermUsersDelete}},
 		},
 	}, func(ctx context.Context, input *DeleteUserInput) (*struct{}, error) {
-		err := rs.repo.DeleteUser(ctx, input.ID)
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		user, err := rs.repo.GetUserById(ctx, input.ID)
 		if err != nil {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		if err := rs.repo.DeleteUser(ctx, input.ID); err != nil {
 			return nil, huma.Error400BadRequest(err.Error())
 		}
+		rs.audit.Record(ctx, audit.Event{
+			Action:   audit.ActionDeleteUser,
+			Target:   input.ID.String(),
+			Metadata: map[string]any{"email": user.Email},
+		})
 		return nil, nil
 	})
 }
+
+type ResetTwoFactorInput struct {
+	AuthHeader
+	ID uuid.UUID `path:"id"`
+}
+
+func (rs *ApiHandlers) RegisterResetTwoFactor(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "reset-user-two-factor",
+		Summary:     "Reset user 2FA",
+		Description: "Disables two-factor authentication of the user and deletes their recovery codes, e.g. when the authenticator device is lost.",
+		Method:      http.MethodDelete,
+		Path:        "/api/users/{id}/2fa",
+		Tags:        []string{"Users"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermUsersWrite}},
+		},
+	}, func(ctx context.Context, input *ResetTwoFactorInput) (*struct{}, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		if _, err := rs.repo.GetUserById(ctx, input.ID); err != nil {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		if err := rs.disableTwoFactor(ctx, input.ID); err != nil {
+			return nil, huma.Error400BadRequest(err.Error())
+		}
+		rs.noticeTwoFactorChanged(ctx, input.ID, false)
+		return nil, nil
+	})
+}
+
+type LinkUserIdentityInputBody struct {
+	Provider string `json:"provider" required:"true" doc:"A login backend like ldap, an OIDC provider, or saml: and the name of a SAML provider"`
+	Subject  string `json:"subject" required:"true" doc:"Id of the user at the provider, the DN for ldap"`
+}
+
+type LinkUserIdentityInput struct {
+	AuthHeader
+	ID   uuid.UUID `path:"id"`
+	Body LinkUserIdentityInputBody
+}
+
+func (rs *ApiHandlers) RegisterLinkUserIdentity(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "link-user-identity",
+		Summary:     "Link user identity",
+		Description: "Links an identity at a login backend or identity provider to the user, for accounts that logins do not link by themselves. Linking a login backend removes the local password, so the backend alone decides the login. The provider does not manage the role of the user.",
+		Method:      http.MethodPost,
+		Path:        "/api/users/{id}/identities",
+		Tags:        []string{"Users"},
+		Security: []map[string][]string{
+			{"Bearer": {security.PermUsersWrite}},
+		},
+		Errors: []int{
+			http.StatusNotFound,
+			http.StatusConflict,
+			http.StatusUnprocessableEntity,
+		},
+	}, func(ctx context.Context, input *LinkUserIdentityInput) (*struct{}, error) {
+		if err := input.denyImpersonation(); err != nil {
+			return nil, err
+		}
+		user, err := rs.repo.GetUserById(ctx, input.ID)
+		if err != nil {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		if !rs.knownProvider(input.Body.Provider) {
+			return nil, huma.Error422UnprocessableEntity("Unknown provider", &huma.ErrorDetail{
+				Location: "body.provider",
+				Message:  "Unknown provider",
+				Value:    input.Body.Provider,
+			})
+		}
+		_, err = rs.repo.GetUserByIdentity(ctx, store.GetUserByIdentityParams{
+			Provider: input.Body.Provider,
+			Subject:  input.Body.Subject,
+		})
+		if err == nil {
+			return nil, huma.Error409Conflict("Identity is already linked")
+		}
+
+		err = rs.repo.CreateUserIdentity(ctx, store.CreateUserIdentityParams{
+			UserID:   user.ID,
+			Provider: input.Body.Provider,
+			Subject:  input.Body.Subject,
+			Email:    user.Email,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Cannot link identity")
+		}
+		if authn.IsBackend(input.Body.Provider) {
+			err := rs.repo.UpdateUserPassword(ctx, store.UpdateUserPasswordParams{Password: "", ID: user.ID})
+			if err != nil {
+				return nil, huma.Error500InternalServerError("Cannot remove password")
+			}
+		}
+		rs.audit.Record(ctx, audit.Event{
+			Action:   audit.ActionLinkIdentity,
+			Target:   user.ID.String(),
+			Metadata: map[string]any{"provider": input.Body.Provider, "subject": input.Body.Subject},
+		})
+		return nil, nil
+	})
+}
+
+// knownProvider tells whether identities of the provider can log in: a
+// configured login backend other than local, an OIDC provider or a SAML
+// provider as saml:name.
+func (rs *ApiHandlers) knownProvider(provider string) bool {
+	if authn.IsBackend(provider) {
+		return slices.Contains(config.Get().Auth.Backends, provider)
+	}
+	if name, ok := strings.CutPrefix(provider, "saml:"); ok {
+		_, ok := rs.saml[name]
+		return ok
+	}
+	_, ok := rs.oidc[provider]
+	return ok
+}
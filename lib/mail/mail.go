@@ -21,8 +21,17 @@ type mail struct {
 type emailTemplate string
 
 const (
-	verifyTemplate   emailTemplate = "verify.tpl"
-	passwordTemplate emailTemplate = "password.tpl"
+	verifyTemplate          emailTemplate = "verify.tpl"
+	passwordTemplate        emailTemplate = "password.tpl"
+	unlockTemplate          emailTemplate = "unlock.tpl"
+	magicTemplate           emailTemplate = "magic.tpl"
+	emailChangeTemplate     emailTemplate = "email_change.tpl"
+	emailNoticeTemplate     emailTemplate = "email_change_notice.tpl"
+	invitationTemplate      emailTemplate = "invitation.tpl"
+	passwordChangedTemplate emailTemplate = "password_changed.tpl"
+	emailChangedTemplate    emailTemplate = "email_changed.tpl"
+	twoFactorTemplate       emailTemplate = "two_factor_changed.tpl"
+	newLoginTemplate        emailTemplate = "new_login.tpl"
 )
 
 type templateData struct {
@@ -124,6 +133,54 @@ type PasswordEmailParams struct {
 	Link    string
 }
 
+type UnlockEmailParams struct {
+	AppName string
+	Link    string
+	Until   string
+}
+
+type MagicLinkEmailParams struct {
+	AppName string
+	Link    string
+}
+
+type EmailChangeParams struct {
+	AppName string
+	Link    string
+}
+
+type EmailChangeNoticeParams struct {
+	AppName  string
+	NewEmail string
+	Link     string
+}
+
+type InvitationParams struct {
+	AppName string
+	Link    string
+	Until   string
+}
+
+// SecurityNoticeParams describe where a change to the account came from.
+// Link signs the account out everywhere.
+type SecurityNoticeParams struct {
+	AppName string
+	When    string
+	Ip      string
+	Device  string
+	Link    string
+}
+
+type EmailChangedParams struct {
+	SecurityNoticeParams
+	NewEmail string
+}
+
+type TwoFactorChangedParams struct {
+	SecurityNoticeParams
+	Enabled bool
+}
+
 func SendVerifyMail(to string, params VerifyEmailParams) error {
 	return sendMail(verifyTemplate, to, params)
 }
@@ -131,3 +188,39 @@ func SendVerifyMail(to string, params VerifyEmailParams) error {
 func SendPasswordMail(to string, params PasswordEmailParams) error {
 	return sendMail(passwordTemplate, to, params)
 }
+
+func SendUnlockMail(to string, params UnlockEmailParams) error {
+	return sendMail(unlockTemplate, to, params)
+}
+
+func SendMagicLinkMail(to string, params MagicLinkEmailParams) error {
+	return sendMail(magicTemplate, to, params)
+}
+
+func SendEmailChangeMail(to string, params EmailChangeParams) error {
+	return sendMail(emailChangeTemplate, to, params)
+}
+
+func SendEmailChangeNoticeMail(to string, params EmailChangeNoticeParams) error {
+	return sendMail(emailNoticeTemplate, to, params)
+}
+
+func SendInvitationMail(to string, params InvitationParams) error {
+	return sendMail(invitationTemplate, to, params)
+}
+
+func SendPasswordChangedMail(to string, params SecurityNoticeParams) error {
+	return sendMail(passwordChangedTemplate, to, params)
+}
+
+func SendEmailChangedMail(to string, params EmailChangedParams) error {
+	return sendMail(emailChangedTemplate, to, params)
+}
+
+func SendTwoFactorChangedMail(to string, params TwoFactorChangedParams) error {
+	return sendMail(twoFactorTemplate, to, params)
+}
+
+func SendNewLoginMail(to string, params SecurityNoticeParams) error {
+	return sendMail(newLoginTemplate, to, params)
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// CsrfCookieName is the cookie holding the token for the double-submit check.
+// The same value has to come back in the X-CSRF-Token header, which another
+// site cannot set because it cannot read the cookie or our responses.
+const CsrfCookieName = "csrf_token"
+
+var xCsrfToken = http.CanonicalHeaderKey("X-CSRF-Token")
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// CsrfMiddleware guards state-changing Bearer operations authenticated by the
+// jwt cookie. Requests authenticated by credentials in a header are exempt,
+// browsers never add those on their own.
+func CsrfMiddleware(api huma.API) func(ctx huma.Context, next func(huma.Context)) {
+	preferHeader := headerFirst()
+	return func(ctx huma.Context, next func(huma.Context)) {
+		if isSafeMethod(ctx.Method()) || getApiKey(ctx) != "" {
+			next(ctx)
+			return
+		}
+		if _, fromHeader := getAccessToken(ctx, preferHeader); fromHeader {
+			next(ctx)
+			return
+		}
+
+		isAuthorizationRequired := false
+		for _, opScheme := range ctx.Operation().Security {
+			if _, ok := opScheme["Bearer"]; ok {
+				isAuthorizationRequired = true
+			}
+		}
+		if !isAuthorizationRequired {
+			next(ctx)
+			return
+		}
+
+		cookie, err := huma.ReadCookie(ctx, CsrfCookieName)
+		header := ctx.Header(xCsrfToken)
+		if err != nil || cookie.Value == "" || header == "" ||
+			subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 {
+			huma.WriteErr(api, ctx, http.StatusForbidden, "CSRF token is missing or invalid")
+			return
+		}
+		next(ctx)
+	}
+}
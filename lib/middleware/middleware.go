@@ -1,13 +1,19 @@
 package middleware
 
 import (
+	"huma-app/lib/config"
 	"huma-app/lib/security"
+	"huma-app/store/types"
+	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
 
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/go-chi/httplog/v2"
+	"github.com/google/uuid"
 	"golang.org/x/time/rate"
 )
 
@@ -43,6 +49,13 @@ func RealIpMiddleware(ctx huma.Context, next func(huma.Context)) {
 	next(ctx)
 }
 
+// UserAgentMiddleware keeps the User-Agent header in the context, sessions
+// describe their device with it.
+func UserAgentMiddleware(ctx huma.Context, next func(huma.Context)) {
+	ctx = huma.WithValue(ctx, "user-agent", ctx.Header("User-Agent"))
+	next(ctx)
+}
+
 // Структура для хранения лимитеров по IP
 type IPRateLimiter struct {
 	ips map[string]*rate.Limiter
@@ -89,14 +102,61 @@ func RateLimitMiddleware(api huma.API, limiter *IPRateLimiter) func(ctx huma.Con
 	}
 }
 
+var xApiKey = http.CanonicalHeaderKey("X-API-Key")
+
+// getApiKey returns the API key sent in the X-API-Key header or as a bearer
+// token in the Authorization header.
+func getApiKey(ctx huma.Context) string {
+	if key := ctx.Header(xApiKey); key != "" {
+		return key
+	}
+	if key, ok := strings.CutPrefix(ctx.Header("Authorization"), "Bearer "); ok && security.IsApiKey(key) {
+		return key
+	}
+	return ""
+}
+
+// headerFirst tells whether the Authorization header wins over the jwt
+// cookie when a request carries both.
+func headerFirst() bool {
+	switch precedence := config.Get().Auth.TokenPrecedence; precedence {
+	case "header":
+		return true
+	case "cookie", "":
+		return false
+	default:
+		log.Fatalf("unknown token_precedence %q, use cookie or header", precedence)
+		return false
+	}
+}
+
+// getAccessToken returns the access token sent as a bearer token in the
+// Authorization header or in the jwt cookie, and whether it came from the
+// header. API keys in the header are left to getApiKey.
+func getAccessToken(ctx huma.Context, preferHeader bool) (string, bool) {
+	header, ok := strings.CutPrefix(ctx.Header("Authorization"), "Bearer ")
+	if !ok || security.IsApiKey(header) {
+		header = ""
+	}
+	cookie, err := huma.ReadCookie(ctx, security.JWTCookieName)
+	if err != nil {
+		cookie = &http.Cookie{}
+	}
+	if header != "" && (preferHeader || cookie.Value == "") {
+		return header, true
+	}
+	return cookie.Value, false
+}
+
 func JwtAuthMiddleware(api huma.API, sec *security.Security) func(ctx huma.Context, next func(huma.Context)) {
+	preferHeader := headerFirst()
 	return func(ctx huma.Context, next func(huma.Context)) {
 
-		var anyOfNeededRoles []string
+		var neededPermissions []string
 		isAuthorizationRequired := false
 		for _, opScheme := range ctx.Operation().Security {
-			var ok bool
-			if anyOfNeededRoles, ok = opScheme["Bearer"]; ok {
+			if permissions, ok := opScheme["Bearer"]; ok {
+				neededPermissions = permissions
 				isAuthorizationRequired = true
 			}
 		}
@@ -106,34 +166,78 @@ func JwtAuthMiddleware(api huma.API, sec *security.Security) func(ctx huma.Conte
 			return
 		}
 
-		token, err := huma.ReadCookie(ctx, "jwt")
-		if err != nil || len(token.Value) == 0 {
-			huma.WriteErr(api, ctx, http.StatusUnauthorized, "Unauthorized")
-			return
-		}
+		var claims *security.AppToken
+		if key := getApiKey(ctx); key != "" {
+			var err error
+			claims, err = sec.VerifyApiKey(ctx.Context(), key)
+			if err != nil {
+				huma.WriteErr(api, ctx, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+		} else {
+			token, _ := getAccessToken(ctx, preferHeader)
+			if token == "" {
+				huma.WriteErr(api, ctx, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
 
-		claims, err := sec.VerifyToken(token.Value, security.AccessToken)
-		if err != nil {
-			huma.WriteErr(api, ctx, http.StatusUnauthorized, "Unauthorized")
-			return
+			var err error
+			claims, err = sec.VerifyToken(ctx.Context(), token, security.AccessToken)
+			if err != nil {
+				huma.WriteErr(api, ctx, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			if err := sec.CheckSession(ctx.Context(), claims); err != nil {
+				huma.WriteErr(api, ctx, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
 		}
 
 		ctx = huma.WithValue(ctx, "user_id", claims.UserID)
 		ctx = huma.WithValue(ctx, "user_role", claims.UserRole)
+		ctx = huma.WithValue(ctx, "token_id", claims.ID)
+		ctx = huma.WithValue(ctx, "token_family", claims.FamilyID)
+		if claims.ImpersonatorID != nil {
+			ctx = huma.WithValue(ctx, "impersonator_id", *claims.ImpersonatorID)
+			httplog.LogEntrySetField(ctx.Context(), "impersonator_id", slog.StringValue(claims.ImpersonatorID.String()))
+		}
+		if claims.OrgID != nil {
+			ctx = huma.WithValue(ctx, "active_org", *claims.OrgID)
+		}
 
-		if len(anyOfNeededRoles) == 0 {
-			next(ctx)
-			return
+		if len(neededPermissions) > 0 {
+			allowed, err := sec.HasPermissions(ctx.Context(), claims.UserRole, neededPermissions)
+			if err != nil {
+				huma.WriteErr(api, ctx, http.StatusInternalServerError, "Cannot check permissions")
+				return
+			}
+			if !allowed {
+				huma.WriteErr(api, ctx, http.StatusForbidden, "Forbidden")
+				return
+			}
 		}
 
-		for _, role := range anyOfNeededRoles {
-			if role == string(claims.UserRole) {
-				next(ctx)
+		if neededOrgRole, ok := ctx.Operation().Metadata[security.OrgRoleMetadata].(types.OrgRole); ok {
+			// Non-members get 404, so org ids cannot be probed.
+			orgID, err := uuid.Parse(ctx.Param("orgId"))
+			if err != nil {
+				huma.WriteErr(api, ctx, http.StatusNotFound, "Organization not found")
 				return
 			}
+			orgRole, err := sec.OrgRole(ctx.Context(), orgID, claims.UserID)
+			if err != nil {
+				huma.WriteErr(api, ctx, http.StatusNotFound, "Organization not found")
+				return
+			}
+			if !orgRole.AtLeast(neededOrgRole) {
+				huma.WriteErr(api, ctx, http.StatusForbidden, "Forbidden")
+				return
+			}
+			ctx = huma.WithValue(ctx, "org_id", orgID)
+			ctx = huma.WithValue(ctx, "org_role", orgRole)
 		}
 
-		huma.WriteErr(api, ctx, http.StatusForbidden, "Forbidden")
+		next(ctx)
 	}
 }
 
@@ -0,0 +1,57 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachedList looks passwords up in a local copy of a breached password
+// corpus in the k-anonymity range format used by Have I Been Pwned: the
+// directory holds one file per first five hex characters of the SHA-1 hash,
+// named ABCDE or ABCDE.txt, with "SUFFIX:COUNT" lines. Only the file of the
+// prefix is read, so the corpus never has to fit in memory.
+type BreachedList struct {
+	dir string
+}
+
+func NewBreachedList(dir string) *BreachedList {
+	return &BreachedList{dir: dir}
+}
+
+func (b *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := b.open(prefix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func (b *BreachedList) open(prefix string) (*os.File, error) {
+	f, err := os.Open(filepath.Join(b.dir, prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return os.Open(filepath.Join(b.dir, prefix))
+	}
+	return f, err
+}
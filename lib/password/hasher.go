@@ -0,0 +1,148 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"huma-app/lib/config"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	ErrInvalidHash      = errors.New("invalid password hash")
+)
+
+// Hasher hashes passwords with the configured algorithm and verifies hashes
+// made with any supported one. Hashes are PHC strings; bcrypt keeps its own
+// $2b$ format, which PHC adopts as is.
+type Hasher struct {
+	cfg config.PasswordHash
+}
+
+func NewHasher(cfg config.PasswordHash) (*Hasher, error) {
+	switch cfg.Algorithm {
+	case "argon2id":
+	case "bcrypt":
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, ErrUnknownAlgorithm
+	}
+	return &Hasher{cfg: cfg}, nil
+}
+
+// MaxBytes is the longest password the configured algorithm accepts, or 0
+// if there is no limit.
+func (h *Hasher) MaxBytes() int {
+	if h.cfg.Algorithm == "bcrypt" {
+		return 72
+	}
+	return 0
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.cfg.Algorithm == "bcrypt" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, h.cfg.Argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	params := argon2Params{
+		memory:  h.cfg.Argon2Memory,
+		time:    h.cfg.Argon2Time,
+		threads: h.cfg.Argon2Threads,
+	}
+	key := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, h.cfg.Argon2KeyLength)
+	return params.encode(salt, key), nil
+}
+
+// Verify checks the password against the hash. rehash is true when the
+// password matched but the hash was made with another algorithm or weaker
+// parameters than configured now, so the caller should store a fresh one.
+func (h *Hasher) Verify(password, hash string) (ok bool, rehash bool, err error) {
+	switch {
+	case hash == "":
+		// Accounts created through SSO have no password.
+		return false, false, nil
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return false, false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, false, nil
+		}
+		rehash = h.cfg.Algorithm != "argon2id" ||
+			params.memory != h.cfg.Argon2Memory ||
+			params.time != h.cfg.Argon2Time ||
+			params.threads != h.cfg.Argon2Threads ||
+			uint32(len(key)) != h.cfg.Argon2KeyLength ||
+			uint32(len(salt)) != h.cfg.Argon2SaltLength
+		return true, rehash, nil
+	case strings.HasPrefix(hash, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return false, false, err
+		}
+		return true, h.cfg.Algorithm != "bcrypt" || cost != h.cfg.BcryptCost, nil
+	default:
+		return false, false, ErrUnknownAlgorithm
+	}
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+func (p argon2Params) encode(salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+// decodeArgon2 parses $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+func decodeArgon2(hash string) (params argon2Params, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return params, nil, nil, ErrInvalidHash
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,108 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"huma-app/lib/config"
+	"log/slog"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrBreached = errors.New("password has appeared in a data breach")
+
+// Policy checks new passwords before they are hashed.
+type Policy struct {
+	cfg      config.PasswordPolicy
+	maxBytes int
+	breached *BreachedList
+}
+
+// maxLength keeps hashing and the strength estimate cheap.
+const maxLength = 256
+
+// NewPolicy makes a policy for passwords hashed by the hasher, which may
+// limit their length.
+func NewPolicy(cfg config.PasswordPolicy, hasher *Hasher) *Policy {
+	p := &Policy{cfg: cfg, maxBytes: hasher.MaxBytes()}
+	if cfg.BreachedPath != "" {
+		p.breached = NewBreachedList(cfg.BreachedPath)
+	}
+	return p
+}
+
+// Check returns every rule the password violates, so the client can show them
+// all at once. The email of the account is used to reject passwords built
+// from it.
+func (p *Policy) Check(password, email string) []error {
+	var errs []error
+
+	length := utf8.RuneCountInString(password)
+	if length < p.cfg.MinLength {
+		errs = append(errs, fmt.Errorf("password must be at least %d characters long", p.cfg.MinLength))
+	}
+	if length > maxLength {
+		errs = append(errs, fmt.Errorf("password must not be longer than %d characters", maxLength))
+	} else if p.maxBytes > 0 && len(password) > p.maxBytes {
+		errs = append(errs, fmt.Errorf("password must not be longer than %d bytes", p.maxBytes))
+	}
+	if classes := charClasses(password); classes < p.cfg.MinClasses {
+		errs = append(errs, fmt.Errorf("password must contain at least %d of: lowercase letters, uppercase letters, digits, symbols", p.cfg.MinClasses))
+	}
+	if containsEmail(password, email) {
+		errs = append(errs, errors.New("password must not contain the email address"))
+	}
+	if len(errs) > 0 {
+		// Weak by the rules above, no need to explain the score too.
+		return errs
+	}
+
+	if score := Strength(password, email); score < p.cfg.MinScore {
+		errs = append(errs, fmt.Errorf("password is too easy to guess (strength %d of 4, at least %d required)", score, p.cfg.MinScore))
+	}
+
+	if p.breached != nil {
+		found, err := p.breached.Contains(password)
+		if err != nil {
+			slog.Error("cannot check breached passwords", "err", err)
+			// The list is an extra safeguard, a broken one should not lock
+			// users out of registration.
+			return errs
+		}
+		if found {
+			errs = append(errs, ErrBreached)
+		}
+	}
+	return errs
+}
+
+func charClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+func containsEmail(password, email string) bool {
+	if email == "" {
+		return false
+	}
+	password = strings.ToLower(password)
+	email = strings.ToLower(email)
+	local, _, _ := strings.Cut(email, "@")
+	if strings.Contains(password, email) {
+		return true
+	}
+	return len(local) >= 3 && strings.Contains(password, local)
+}
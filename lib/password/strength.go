@@ -0,0 +1,260 @@
+package password
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Strength estimates how hard the password is to guess, in the spirit of
+// zxcvbn: the password is split into the cheapest sequence of known patterns
+// (common passwords, keyboard walks, sequences, repeats, years, parts of the
+// email) and brute-forced runs, and the estimated number of guesses is
+// mapped to a score from 0 (trivial) to 4 (strong).
+func Strength(password, email string) int {
+	guesses := estimateGuesses(password, userInputs(email))
+	switch {
+	case guesses < 1e3:
+		return 0
+	case guesses < 1e6:
+		return 1
+	case guesses < 1e8:
+		return 2
+	case guesses < 1e10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+//go:embed common.txt
+var commonList string
+
+// commonRanks maps common passwords and words to their popularity rank,
+// which is also the number of guesses an attacker needs to reach them.
+var commonRanks = func() map[string]int {
+	ranks := map[string]int{}
+	for i, word := range strings.Fields(commonList) {
+		if _, ok := ranks[word]; !ok {
+			ranks[word] = i + 1
+		}
+	}
+	return ranks
+}()
+
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+	"1qaz2wsx3edc4rfv5tgb6yhn7ujm8ik9ol0p",
+	"йцукенгшщзхъ",
+	"фывапролджэ",
+	"ячсмитьбю",
+}
+
+var leet = strings.NewReplacer("4", "a", "@", "a", "8", "b", "3", "e", "6", "g", "1", "i", "!", "i", "0", "o", "5", "s", "$", "s", "7", "t", "2", "z")
+
+// minPatternLength keeps single characters and pairs in brute force, where
+// they are cheaper anyway.
+const minPatternLength = 3
+
+func userInputs(email string) []string {
+	email = strings.ToLower(email)
+	local, domain, _ := strings.Cut(email, "@")
+	inputs := []string{email}
+	for _, part := range strings.FieldsFunc(local+"."+domain, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(part) >= minPatternLength {
+			inputs = append(inputs, part)
+		}
+	}
+	return inputs
+}
+
+// estimateGuesses finds the segmentation of the password with the fewest
+// guesses. Every segment is either a known pattern or brute force.
+func estimateGuesses(password string, inputs []string) float64 {
+	runes := []rune(password)
+	n := len(runes)
+	if n == 0 {
+		return 1
+	}
+
+	// best[i] is the log10 of guesses for the first i runes.
+	best := make([]float64, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = math.Inf(1)
+		for j := 0; j < i; j++ {
+			g := best[j] + segmentGuesses(runes[j:i], inputs)
+			if g < best[i] {
+				best[i] = g
+			}
+		}
+	}
+	return math.Pow(10, best[n])
+}
+
+// segmentGuesses returns the log10 of guesses for a part of the password.
+func segmentGuesses(segment []rune, inputs []string) float64 {
+	guesses := bruteForce(segment)
+	if len(segment) < minPatternLength {
+		return guesses
+	}
+	s := string(segment)
+	for _, g := range []float64{
+		dictionaryGuesses(s, inputs),
+		repeatGuesses(segment),
+		sequenceGuesses(segment),
+		keyboardGuesses(s),
+		yearGuesses(s),
+	} {
+		guesses = math.Min(guesses, g)
+	}
+	return guesses
+}
+
+func bruteForce(segment []rune) float64 {
+	var lower, upper, digit, symbol bool
+	for _, r := range segment {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	cardinality := 0
+	if lower {
+		cardinality += 26
+	}
+	if upper {
+		cardinality += 26
+	}
+	if digit {
+		cardinality += 10
+	}
+	if symbol {
+		cardinality += 33
+	}
+	return float64(len(segment)) * math.Log10(float64(cardinality))
+}
+
+// variations is the log10 of the extra guesses for capitalization and l33t
+// substitutions of a dictionary word.
+func variations(s string) float64 {
+	extra := 0.0
+	lower := strings.ToLower(s)
+	runes := []rune(lower)
+	capitalized := string(unicode.ToUpper(runes[0])) + string(runes[1:])
+	switch s {
+	case lower:
+	case strings.ToUpper(s), capitalized:
+		extra += math.Log10(2)
+	default:
+		extra += math.Log10(float64(len(runes)))
+	}
+	if leet.Replace(lower) != lower {
+		extra += math.Log10(2)
+	}
+	return extra
+}
+
+func dictionaryGuesses(s string, inputs []string) float64 {
+	lower := strings.ToLower(s)
+	guesses := math.Inf(1)
+	for _, word := range []string{lower, leet.Replace(lower)} {
+		if rank, ok := commonRanks[word]; ok {
+			guesses = math.Min(guesses, math.Log10(float64(rank)))
+		}
+		if rev := reverse(word); rev != word {
+			if rank, ok := commonRanks[rev]; ok {
+				guesses = math.Min(guesses, math.Log10(float64(rank)*2))
+			}
+		}
+		for i, input := range inputs {
+			if word == input {
+				guesses = math.Min(guesses, math.Log10(float64(i+1)))
+			}
+		}
+	}
+	return guesses + variations(s)
+}
+
+// repeatGuesses handles "aaaa" and "abcabc": the guesses of the repeated
+// unit times the number of repeats.
+func repeatGuesses(segment []rune) float64 {
+	n := len(segment)
+	for unit := 1; unit <= n/2; unit++ {
+		if n%unit != 0 {
+			continue
+		}
+		repeated := true
+		for i := unit; i < n; i++ {
+			if segment[i] != segment[i-unit] {
+				repeated = false
+				break
+			}
+		}
+		if repeated {
+			return bruteForce(segment[:unit]) + math.Log10(float64(n/unit))
+		}
+	}
+	return math.Inf(1)
+}
+
+// sequenceGuesses handles runs with a constant step like "abcd", "9753" or
+// "zyx".
+func sequenceGuesses(segment []rune) float64 {
+	step := segment[1] - segment[0]
+	if step == 0 || step > 5 || step < -5 {
+		return math.Inf(1)
+	}
+	for i := 2; i < len(segment); i++ {
+		if segment[i]-segment[i-1] != step {
+			return math.Inf(1)
+		}
+	}
+	base := 26.0
+	if unicode.IsDigit(segment[0]) {
+		base = 10
+	}
+	return math.Log10(base * float64(len(segment)) * 2)
+}
+
+func keyboardGuesses(s string) float64 {
+	lower := strings.ToLower(s)
+	rev := reverse(lower)
+	for _, row := range keyboardRows {
+		if strings.Contains(row, lower) || strings.Contains(row, rev) {
+			return math.Log10(float64(len(keyboardRows)) * float64(len([]rune(lower))) * 4)
+		}
+	}
+	return math.Inf(1)
+}
+
+func yearGuesses(s string) float64 {
+	if len(s) != 4 || (!strings.HasPrefix(s, "19") && !strings.HasPrefix(s, "20")) {
+		return math.Inf(1)
+	}
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return math.Inf(1)
+		}
+	}
+	return math.Log10(200)
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
@@ -0,0 +1,268 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Attributes are the values a filter sees of a resource, keyed by the
+// lowercase attribute path, e.g. "username" or "emails.value". Values are
+// strings, booleans are "true" and "false".
+type Attributes map[string][]string
+
+// Filter is a parsed SCIM filter, see RFC 7644 section 3.4.2.2. Supported
+// are the attribute operators, and, or, not and parentheses; value paths
+// like emails[type eq "work"] are not.
+type Filter interface {
+	Match(attrs Attributes) bool
+}
+
+type comparison struct {
+	attr  string
+	op    string
+	value string
+	null  bool
+}
+
+type logical struct {
+	and         bool
+	left, right Filter
+}
+
+type negation struct {
+	filter Filter
+}
+
+// ParseFilter parses a filter. An empty filter matches everything and is
+// returned as nil. Errors are SCIM invalidFilter errors.
+func ParseFilter(filter string) (Filter, error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, nil
+	}
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, invalidFilter(err.Error())
+	}
+	p := &parser{tokens: tokens}
+	f, err := p.or()
+	if err != nil {
+		return nil, invalidFilter(err.Error())
+	}
+	if p.pos < len(p.tokens) {
+		return nil, invalidFilter(fmt.Sprintf("unexpected %q", p.tokens[p.pos]))
+	}
+	return f, nil
+}
+
+// Matches reports whether the filter matches, a nil filter always does.
+func Matches(f Filter, attrs Attributes) bool {
+	return f == nil || f.Match(attrs)
+}
+
+func invalidFilter(detail string) *Error {
+	return NewError(http.StatusBadRequest, ErrInvalidFilter, detail)
+}
+
+func (c comparison) Match(attrs Attributes) bool {
+	values := attrs[c.attr]
+	switch c.op {
+	case "pr":
+		return len(values) > 0
+	case "eq":
+		if c.null {
+			return len(values) == 0
+		}
+	case "ne":
+		if c.null {
+			return len(values) > 0
+		}
+		return !comparison{c.attr, "eq", c.value, false}.Match(attrs)
+	}
+	for _, v := range values {
+		// Attributes here are all case insensitive.
+		v = strings.ToLower(v)
+		var ok bool
+		switch c.op {
+		case "eq":
+			ok = v == c.value
+		case "co":
+			ok = strings.Contains(v, c.value)
+		case "sw":
+			ok = strings.HasPrefix(v, c.value)
+		case "ew":
+			ok = strings.HasSuffix(v, c.value)
+		case "gt":
+			ok = v > c.value
+		case "ge":
+			ok = v >= c.value
+		case "lt":
+			ok = v < c.value
+		case "le":
+			ok = v <= c.value
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (l logical) Match(attrs Attributes) bool {
+	if l.and {
+		return l.left.Match(attrs) && l.right.Match(attrs)
+	}
+	return l.left.Match(attrs) || l.right.Match(attrs)
+}
+
+func (n negation) Match(attrs Attributes) bool {
+	return !n.filter.Match(attrs)
+}
+
+// tokenize splits a filter into words, parentheses and quoted strings, which
+// keep their quotes.
+func tokenize(filter string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(filter); {
+		switch c := filter[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(filter) && filter[end] != '"'; end++ {
+				if filter[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(filter) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, filter[i:end+1])
+			i = end + 1
+		default:
+			end := i
+			for end < len(filter) && !strings.ContainsRune(" \t()\"", rune(filter[end])) {
+				end++
+			}
+			tokens = append(tokens, filter[i:end])
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+// or and and follow the precedence of the RFC: and binds tighter.
+func (p *parser) or() (Filter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{and: false, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (Filter, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) factor() (Filter, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of filter")
+	case strings.EqualFold(token, "not"):
+		if p.next() != "(" {
+			return nil, fmt.Errorf("expected ( after not")
+		}
+		f, err := p.group()
+		if err != nil {
+			return nil, err
+		}
+		return negation{f}, nil
+	case token == "(":
+		return p.group()
+	}
+	if strings.ContainsAny(token, "[]") {
+		return nil, fmt.Errorf("value paths are not supported")
+	}
+
+	c := comparison{attr: strings.ToLower(token), op: strings.ToLower(p.next())}
+	switch c.op {
+	case "pr":
+		return c, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("unknown operator %q", c.op)
+	}
+	value := p.next()
+	switch {
+	case value == "":
+		return nil, fmt.Errorf("missing value for %s", token)
+	case value == "null":
+		if c.op != "eq" && c.op != "ne" {
+			return nil, fmt.Errorf("null only works with eq and ne")
+		}
+		c.null = true
+	case strings.HasPrefix(value, `"`):
+		if err := json.Unmarshal([]byte(value), &c.value); err != nil {
+			return nil, fmt.Errorf("invalid string %s", value)
+		}
+	default:
+		// true, false and numbers
+		c.value = value
+	}
+	c.value = strings.ToLower(c.value)
+	return c, nil
+}
+
+func (p *parser) group() (Filter, error) {
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.next() != ")" {
+		return nil, fmt.Errorf("missing )")
+	}
+	return f, nil
+}
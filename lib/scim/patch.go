@@ -0,0 +1,126 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PatchRequest is the body of PATCH requests, see RFC 7644 section 3.5.2.
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas,omitempty"`
+	Operations []PatchOperation `json:"Operations" minItems:"1"`
+}
+
+type PatchOperation struct {
+	Op    string `json:"op" doc:"add, remove or replace"`
+	Path  string `json:"path,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+// Kind is the lowercase op, some clients capitalize it.
+func (op PatchOperation) Kind() (string, error) {
+	switch kind := strings.ToLower(op.Op); kind {
+	case "add", "remove", "replace":
+		return kind, nil
+	}
+	return "", NewError(http.StatusBadRequest, ErrInvalidSyntax, fmt.Sprintf("unknown op %q", op.Op))
+}
+
+// Attributes returns the attributes an operation sets, keyed by the
+// lowercase path. An operation without a path carries them as an object.
+func (op PatchOperation) Attributes() (map[string]any, error) {
+	if op.Path != "" {
+		return map[string]any{strings.ToLower(op.Path): op.Value}, nil
+	}
+	values, ok := op.Value.(map[string]any)
+	if !ok {
+		return nil, NewError(http.StatusBadRequest, ErrInvalidValue, "value must be an object when path is missing")
+	}
+	attrs := make(map[string]any, len(values))
+	for k, v := range values {
+		attrs[strings.ToLower(k)] = v
+	}
+	return attrs, nil
+}
+
+func invalidValue(attr string) *Error {
+	return NewError(http.StatusBadRequest, ErrInvalidValue, fmt.Sprintf("invalid value for %s", attr))
+}
+
+// Bool reads a boolean attribute. Some clients send "True" and "False".
+func Bool(attr string, value any) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b, nil
+		}
+	}
+	return false, invalidValue(attr)
+}
+
+func String(attr string, value any) (string, error) {
+	if v, ok := value.(string); ok {
+		return v, nil
+	}
+	return "", invalidValue(attr)
+}
+
+// MultiValue is an item of a multi-valued attribute like emails or members.
+type MultiValue struct {
+	_       struct{} `additionalProperties:"true"`
+	Value   string   `json:"value"`
+	Display string   `json:"display,omitempty"`
+	Type    string   `json:"type,omitempty"`
+	Primary bool     `json:"primary,omitempty"`
+}
+
+// MultiValues reads a multi-valued attribute, given as a list or a single
+// item.
+func MultiValues(attr string, value any) ([]MultiValue, error) {
+	if _, ok := value.([]any); !ok {
+		value = []any{value}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, invalidValue(attr)
+	}
+	var items []MultiValue
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, invalidValue(attr)
+	}
+	return items, nil
+}
+
+// Primary returns the value of the primary item, or of the first if none is
+// marked primary.
+func Primary(items []MultiValue) string {
+	for _, item := range items {
+		if item.Primary {
+			return item.Value
+		}
+	}
+	if len(items) > 0 {
+		return items[0].Value
+	}
+	return ""
+}
+
+// ValueFilter reads paths like members[value eq "id"], which pick an item of
+// attr by its value. ok is false for other paths.
+func ValueFilter(path, attr string) (value string, ok bool, err error) {
+	prefix := strings.ToLower(attr) + "["
+	if !strings.HasPrefix(strings.ToLower(path), prefix) || !strings.HasSuffix(path, "]") {
+		return "", false, nil
+	}
+	f, err := ParseFilter(path[len(prefix) : len(path)-1])
+	c, isComparison := f.(comparison)
+	if err != nil || !isComparison || c.attr != "value" || c.op != "eq" || c.null {
+		return "", true, NewError(http.StatusBadRequest, ErrInvalidPath, fmt.Sprintf("unsupported path %s", path))
+	}
+	return c.value, true, nil
+}
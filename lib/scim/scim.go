@@ -0,0 +1,191 @@
+// Package scim has the protocol side of SCIM 2.0 (RFC 7643 and RFC 7644):
+// schema URNs, the error and list response formats, filters and PATCH
+// operations. Resources are built by the handlers from the store.
+package scim
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// BasePath prefixes every SCIM operation.
+const BasePath = "/scim/v2"
+
+// MediaType is sent with every SCIM response.
+const MediaType = "application/scim+json"
+
+const (
+	UserSchema                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	GroupSchema                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	ListResponseSchema          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpSchema               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// Values of scimType in errors, see RFC 7644 section 3.12.
+const (
+	ErrInvalidFilter = "invalidFilter"
+	ErrUniqueness    = "uniqueness"
+	ErrMutability    = "mutability"
+	ErrInvalidSyntax = "invalidSyntax"
+	ErrInvalidPath   = "invalidPath"
+	ErrNoTarget      = "noTarget"
+	ErrInvalidValue  = "invalidValue"
+)
+
+// Error is the SCIM error response. It implements huma.StatusError, so
+// handlers can return it as is.
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status" doc:"HTTP status code as a string"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+func NewError(status int, scimType, detail string) *Error {
+	return &Error{
+		Schemas:  []string{ErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+func (e *Error) GetStatus() int {
+	status, _ := strconv.Atoi(e.Status)
+	return status
+}
+
+func (e *Error) ContentType(string) string {
+	return MediaType
+}
+
+func ErrNotFound(resource string) *Error {
+	return NewError(http.StatusNotFound, "", fmt.Sprintf("%s not found", resource))
+}
+
+func ErrInternal(detail string) *Error {
+	return NewError(http.StatusInternalServerError, "", detail)
+}
+
+var installErrors sync.Once
+
+// InstallErrors makes errors huma writes on its own, like failed validation
+// or authentication, come out as SCIM errors for SCIM operations. SCIM has
+// no 422, invalid input is a 400 with scimType invalidValue.
+func InstallErrors() {
+	installErrors.Do(func() {
+		next := huma.NewErrorWithContext
+		huma.NewErrorWithContext = func(ctx huma.Context, status int, msg string, errs ...error) huma.StatusError {
+			if ctx == nil || ctx.Operation() == nil || !strings.HasPrefix(ctx.Operation().Path, BasePath+"/") {
+				return next(ctx, status, msg, errs...)
+			}
+			details := []string{msg}
+			for _, err := range errs {
+				if err != nil {
+					details = append(details, err.Error())
+				}
+			}
+			scimType := ""
+			if status == http.StatusUnprocessableEntity {
+				status, scimType = http.StatusBadRequest, ErrInvalidValue
+			}
+			return NewError(status, scimType, strings.Join(details, ": "))
+		}
+	})
+}
+
+// Meta is the meta attribute of resources.
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+// ListResponse is a page of resources. Indexes are 1-based.
+type ListResponse[T any] struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []T      `json:"Resources"`
+}
+
+func (ListResponse[T]) ContentType(string) string {
+	return MediaType
+}
+
+// NewListResponse returns the page of all starting at startIndex with at
+// most count resources.
+func NewListResponse[T any](all []T, startIndex, count int) ListResponse[T] {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	page := []T{}
+	if start := startIndex - 1; start < len(all) {
+		end := min(start+max(count, 0), len(all))
+		page = all[start:end]
+	}
+	return ListResponse[T]{
+		Schemas:      []string{ListResponseSchema},
+		TotalResults: len(all),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	}
+}
+
+// ListParams are the query parameters of list operations.
+type ListParams struct {
+	Filter     string `query:"filter" doc:"SCIM filter, e.g. userName eq \"jane@example.com\""`
+	StartIndex int    `query:"startIndex" minimum:"1" default:"1"`
+	Count      int    `query:"count" minimum:"0" maximum:"500" default:"100"`
+}
+
+// ServiceProviderConfig tells clients which optional features are supported,
+// see RFC 7643 section 5.
+type ServiceProviderConfig struct {
+	Schemas               []string               `json:"schemas"`
+	Patch                 Supported              `json:"patch"`
+	Bulk                  BulkSupport            `json:"bulk"`
+	Filter                FilterSupport          `json:"filter"`
+	ChangePassword        Supported              `json:"changePassword"`
+	Sort                  Supported              `json:"sort"`
+	Etag                  Supported              `json:"etag"`
+	AuthenticationSchemes []AuthenticationScheme `json:"authenticationSchemes"`
+}
+
+func (ServiceProviderConfig) ContentType(string) string {
+	return MediaType
+}
+
+type Supported struct {
+	Supported bool `json:"supported"`
+}
+
+type BulkSupport struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type FilterSupport struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type AuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
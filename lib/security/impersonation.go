@@ -0,0 +1,32 @@
+package security
+
+import (
+	"context"
+	"huma-app/store/types"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ImpersonationTTL bounds an impersonation. There is no refresh token, when
+// the access token expires the admin falls back to their own session.
+const ImpersonationTTL = time.Hour
+
+// WithImpersonator marks the token as issued to an admin acting as the user.
+func WithImpersonator(adminID uuid.UUID) TokenOption {
+	return func(claims *AppToken) {
+		claims.ImpersonatorID = &adminID
+	}
+}
+
+// GenerateImpersonationCookie issues an access cookie for the target user on
+// behalf of the admin, in a session of its own so it can be revoked like any
+// other login.
+func (security Security) GenerateImpersonationCookie(ctx context.Context, adminID, userID uuid.UUID, userRole types.Role) (*http.Cookie, error) {
+	familyID := uuid.NewString()
+	if err := security.createSession(ctx, userID, familyID); err != nil {
+		return nil, err
+	}
+	return security.GenerateTokenToCookies(ctx, AccessToken, ImpersonationTTL, userID, userRole, WithFamily(familyID), WithImpersonator(adminID))
+}
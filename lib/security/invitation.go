@@ -0,0 +1,24 @@
+package security
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Invitations are for people without an account yet, so their links cannot
+// carry a JWT recorded in the tokens table. They carry a random token whose
+// hash is stored with the invitation instead.
+
+// GenerateInvitationToken returns a new random invitation token and its hash.
+func GenerateInvitationToken() (token string, hash string, err error) {
+	token, err = RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashInvitationToken(token), nil
+}
+
+func HashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
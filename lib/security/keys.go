@@ -0,0 +1,247 @@
+package security
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"huma-app/lib/config"
+	"log"
+	"log/slog"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minHmacSecretBytes is the shortest secret accepted for HS256 keys, the
+// size of the hash output.
+const minHmacSecretBytes = 32
+
+// legacyKid is used for tokens signed before keys had ids and for the single
+// key configured through secret.jwt, which only verifies them.
+const legacyKid = "default"
+
+var (
+	ErrUnknownKey      = errors.New("unknown signing key")
+	ErrUnsupportedAlg  = errors.New("unsupported signing algorithm")
+	ErrInvalidKeyFile  = errors.New("invalid key file")
+	ErrNoActiveKey     = errors.New("active signing key is not configured")
+	ErrDuplicateKeyKid = errors.New("duplicate key id")
+	ErrVerifyOnlyKey   = errors.New("secret.jwt only verifies tokens and cannot be the active key")
+)
+
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	sign   any
+	verify any
+	// public is nil for symmetric keys, which are never published.
+	public crypto.PublicKey
+	// verifyOnly keys are kept for tokens issued before a migration and never
+	// sign new ones.
+	verifyOnly bool
+}
+
+// KeySet holds every key tokens can be verified with and the one new tokens
+// are signed with.
+type KeySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+func MustLoadKeySet() *KeySet {
+	keys, err := LoadKeySet(config.Get().Secret)
+	if err != nil {
+		log.Fatalf("error loading jwt keys: %s", err)
+	}
+	return keys
+}
+
+// LoadKeySet builds the key set from config. Without any configured key an
+// ephemeral Ed25519 key is generated, so tokens do not survive a restart. The
+// deprecated secret.jwt only verifies tokens without a kid until they expire.
+func LoadKeySet(cfg config.Secret) (*KeySet, error) {
+	ks := &KeySet{keys: map[string]*signingKey{}}
+
+	for _, k := range cfg.Keys {
+		key, err := loadKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		if _, ok := ks.keys[key.kid]; ok {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, ErrDuplicateKeyKid)
+		}
+		ks.keys[key.kid] = key
+	}
+
+	if cfg.Jwt != "" {
+		if len(cfg.Jwt) < minHmacSecretBytes {
+			return nil, fmt.Errorf("secret.jwt must be at least %d bytes", minHmacSecretBytes)
+		}
+		slog.Warn("secret.jwt is deprecated and only verifies existing tokens, configure secret.keys")
+		if _, ok := ks.keys[legacyKid]; !ok {
+			ks.keys[legacyKid] = &signingKey{
+				kid:        legacyKid,
+				method:     jwt.SigningMethodHS256,
+				verify:     []byte(cfg.Jwt),
+				verifyOnly: true,
+			}
+		}
+	}
+
+	switch {
+	case cfg.ActiveKey != "":
+		ks.active = ks.keys[cfg.ActiveKey]
+		if ks.active == nil {
+			return nil, ErrNoActiveKey
+		}
+		if ks.active.verifyOnly {
+			return nil, ErrVerifyOnlyKey
+		}
+	case len(cfg.Keys) > 0:
+		ks.active = ks.keys[cfg.Keys[0].Kid]
+	default:
+		slog.Warn("no jwt keys configured, using an ephemeral key")
+		public, private, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return nil, err
+		}
+		ks.active = &signingKey{
+			kid:    "ephemeral",
+			method: jwt.SigningMethodEdDSA,
+			sign:   private,
+			verify: public,
+			public: public,
+		}
+		ks.keys[ks.active.kid] = ks.active
+	}
+
+	return ks, nil
+}
+
+func loadKey(cfg config.JwtKey) (*signingKey, error) {
+	if cfg.Kid == "" {
+		return nil, errors.New("kid is required")
+	}
+	key := &signingKey{kid: cfg.Kid}
+
+	switch cfg.Algorithm {
+	case "HS256":
+		if len(cfg.Secret) < minHmacSecretBytes {
+			return nil, fmt.Errorf("secret for HS256 must be at least %d bytes", minHmacSecretBytes)
+		}
+		key.method = jwt.SigningMethodHS256
+		key.sign = []byte(cfg.Secret)
+		key.verify = []byte(cfg.Secret)
+		return key, nil
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+	case "EdDSA":
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, ErrUnsupportedAlg
+	}
+
+	data, err := os.ReadFile(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKeyFile
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		rsaKey, rsaErr := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if rsaErr != nil {
+			return nil, err
+		}
+		private = rsaKey
+	}
+
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		if key.method != jwt.SigningMethodRS256 {
+			return nil, ErrInvalidKeyFile
+		}
+		key.sign, key.verify, key.public = private, &private.PublicKey, &private.PublicKey
+	case ed25519.PrivateKey:
+		if key.method != jwt.SigningMethodEdDSA {
+			return nil, ErrInvalidKeyFile
+		}
+		public := private.Public()
+		key.sign, key.verify, key.public = private, public, public
+	default:
+		return nil, ErrInvalidKeyFile
+	}
+	return key, nil
+}
+
+// keyFunc picks the verification key by the kid header and makes sure the
+// token uses the algorithm the key is configured for.
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = legacyKid
+	}
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("неожиданный метод подписи: %v", token.Header["alg"])
+	}
+	return key.verify, nil
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	token.Header["kid"] = ks.active.kid
+	return token.SignedString(ks.active.sign)
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set. Symmetric keys are left out.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
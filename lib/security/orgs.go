@@ -0,0 +1,30 @@
+package security
+
+import (
+	"context"
+	"huma-app/store"
+	"huma-app/store/types"
+
+	"github.com/google/uuid"
+)
+
+// OrgRoleMetadata is the Operation.Metadata key of org-scoped operations.
+// Its value is the types.OrgRole the caller needs in the organization named
+// by the {orgId} path parameter.
+const OrgRoleMetadata = "orgRole"
+
+// WithOrg makes the organization the active one of the token.
+func WithOrg(orgID uuid.UUID) TokenOption {
+	return func(claims *AppToken) {
+		claims.OrgID = &orgID
+	}
+}
+
+// OrgRole returns the role of the user in the organization, or an error if
+// the user is not a member.
+func (security Security) OrgRole(ctx context.Context, orgID, userID uuid.UUID) (types.OrgRole, error) {
+	return security.repo.GetOrgMemberRole(ctx, store.GetOrgMemberRoleParams{
+		OrgID:  orgID,
+		UserID: userID,
+	})
+}
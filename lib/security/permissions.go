@@ -0,0 +1,83 @@
+package security
+
+import (
+	"context"
+	"huma-app/store/types"
+	"sync"
+	"time"
+)
+
+// Permissions are declared by operations as the scopes of their Bearer
+// security requirement. Which role has which permission lives in the
+// role_permissions table.
+const (
+	PermUsersRead        = "users:read"
+	PermUsersWrite       = "users:write"
+	PermUsersDelete      = "users:delete"
+	PermUsersImpersonate = "users:impersonate"
+	PermUsersInvite      = "users:invite"
+	PermRolesRead        = "roles:read"
+	PermRolesWrite       = "roles:write"
+	PermAuditRead        = "audit:read"
+	PermScimProvision    = "scim:provision"
+)
+
+// permissionCacheTTL bounds how long a change made by another instance, or
+// directly in the database, takes to apply.
+const permissionCacheTTL = time.Minute
+
+// permissionCache keeps the permissions of every role in memory, so the
+// middleware does not query the database on each request.
+type permissionCache struct {
+	mu       sync.RWMutex
+	roles    map[types.Role]map[string]bool
+	loadedAt time.Time
+}
+
+func (security Security) rolePermissions(ctx context.Context) (map[types.Role]map[string]bool, error) {
+	cache := security.permissions
+	cache.mu.RLock()
+	roles, loadedAt := cache.roles, cache.loadedAt
+	cache.mu.RUnlock()
+	if roles != nil && security.Now().Sub(loadedAt) < permissionCacheTTL {
+		return roles, nil
+	}
+
+	rows, err := security.repo.GetAllRolePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roles = make(map[types.Role]map[string]bool)
+	for _, row := range rows {
+		if roles[row.Role] == nil {
+			roles[row.Role] = make(map[string]bool)
+		}
+		roles[row.Role][row.Permission] = true
+	}
+
+	cache.mu.Lock()
+	cache.roles, cache.loadedAt = roles, security.Now()
+	cache.mu.Unlock()
+	return roles, nil
+}
+
+// HasPermissions reports whether the role has every one of the permissions.
+func (security Security) HasPermissions(ctx context.Context, role types.Role, permissions []string) (bool, error) {
+	roles, err := security.rolePermissions(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, permission := range permissions {
+		if !roles[role][permission] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// InvalidatePermissions drops the cached permissions after roles changed.
+func (security Security) InvalidatePermissions() {
+	security.permissions.mu.Lock()
+	security.permissions.roles = nil
+	security.permissions.mu.Unlock()
+}
@@ -0,0 +1,92 @@
+package security
+
+import (
+	"context"
+	"huma-app/store/types"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+var RefreshCookieName = "refresh"
+
+// GenerateSessionCookies issues a short-lived access cookie and a refresh
+// cookie belonging to the same token family. An empty familyID starts a new
+// family, i.e. a new login, and records its session. Options apply to both
+// tokens, so they survive a refresh.
+func (security Security) GenerateSessionCookies(ctx context.Context, userID uuid.UUID, userRole types.Role, familyID string, opts ...TokenOption) ([]http.Cookie, error) {
+	access, refresh, err := security.GenerateSessionTokens(ctx, userID, userRole, familyID, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return []http.Cookie{{
+		Name:     JWTCookieName,
+		Value:    access,
+		Expires:  security.Now().Add(security.AccessTTL),
+		HttpOnly: true,
+		Path:     "/",
+		SameSite: http.SameSiteStrictMode,
+		Secure:   true,
+		MaxAge:   int(security.AccessTTL.Seconds()),
+	}, {
+		Name:     RefreshCookieName,
+		Value:    refresh,
+		Expires:  security.Now().Add(security.RefreshTTL),
+		HttpOnly: true,
+		Path:     "/api/auth",
+		SameSite: http.SameSiteStrictMode,
+		Secure:   true,
+		MaxAge:   int(security.RefreshTTL.Seconds()),
+	}}, nil
+}
+
+// GenerateSessionTokens is GenerateSessionCookies for clients that send the
+// access token in the Authorization header and keep the tokens themselves.
+func (security Security) GenerateSessionTokens(ctx context.Context, userID uuid.UUID, userRole types.Role, familyID string, opts ...TokenOption) (access, refresh string, err error) {
+	if familyID == "" {
+		familyID = uuid.NewString()
+		if err := security.createSession(ctx, userID, familyID); err != nil {
+			return "", "", err
+		}
+	}
+	opts = append(opts, WithFamily(familyID))
+	access, err = security.GenerateToken(ctx, AccessToken, security.AccessTTL, userID, userRole, opts...)
+	if err != nil {
+		return "", "", err
+	}
+	refresh, err = security.GenerateToken(ctx, RefreshToken, security.RefreshTTL, userID, userRole, opts...)
+	if err != nil {
+		return "", "", err
+	}
+	return access, refresh, nil
+}
+
+// RotateRefreshToken consumes a refresh token. Each refresh token can be used
+// exactly once; presenting an already used one means it was stolen, so the
+// whole family is revoked and ErrTokenReused is returned.
+func (security Security) RotateRefreshToken(ctx context.Context, tokenString string) (*AppToken, error) {
+	claims, err := security.parseToken(tokenString, RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	n, err := security.repo.RevokeActiveToken(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		if claims.FamilyID != "" {
+			security.RevokeTokenFamily(ctx, claims.FamilyID)
+		}
+		return nil, ErrTokenReused
+	}
+	return claims, nil
+}
+
+func (security Security) DeleteRefreshCookie() *http.Cookie {
+	return &http.Cookie{
+		Name:    RefreshCookieName,
+		Value:   "",
+		Path:    "/api/auth",
+		Expires: security.Now(),
+	}
+}
@@ -1,9 +1,13 @@
 package security
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"fmt"
 	"huma-app/lib/config"
+	"huma-app/store"
 	"huma-app/store/types"
 	"net/http"
 	"time"
@@ -20,16 +24,44 @@ type AppToken struct {
 	UserID    uuid.UUID
 	UserRole  types.Role
 	TokenType TokenType
+	// Fingerprint binds a password token to the password hash it was issued
+	// for, so the token stops working once the password changes.
+	Fingerprint string `json:",omitempty"`
+	// FamilyID groups the access and refresh tokens issued for one login and
+	// is the id of its session.
+	FamilyID string `json:",omitempty"`
+	// ImpersonatorID is the admin acting as the user, see WithImpersonator.
+	ImpersonatorID *uuid.UUID `json:",omitempty"`
+	// OrgID is the active organization of the session, see WithOrg.
+	OrgID *uuid.UUID `json:",omitempty"`
 }
 
 var _ jwt.Claims = &AppToken{}
 
-type TokenType string
+// TokenOption sets optional claims of a generated token.
+type TokenOption func(*AppToken)
+
+// WithFamily puts the token into the given token family.
+func WithFamily(familyID string) TokenOption {
+	return func(claims *AppToken) {
+		claims.FamilyID = familyID
+	}
+}
+
+type TokenType = types.TokenType
 
 const (
-	AccessToken   TokenType = "access"
-	EmailToken    TokenType = "email"    // for verify email
-	PasswordToken TokenType = "password" // for password forgot
+	AccessToken      TokenType = "access"
+	EmailToken       TokenType = "email"        // for verify email
+	PasswordToken    TokenType = "password"     // for password forgot
+	RefreshToken     TokenType = "refresh"      // for access token renewal
+	TwoFactorToken   TokenType = "2fa"          // for second factor challenge
+	ApiKeyToken      TokenType = "api_key"      // for requests authenticated by api key
+	UnlockToken      TokenType = "unlock"       // for unlocking account after failed logins
+	MagicToken       TokenType = "magic"        // for passwordless login by email link
+	EmailChangeToken TokenType = "email_change" // for confirming a new email address
+	EmailCancelToken TokenType = "email_cancel" // for cancelling an email change from the old address
+	NotMeToken       TokenType = "not_me"       // for signing out everywhere from a security notice
 )
 
 var (
@@ -38,45 +70,111 @@ var (
 	ErrInvalidTokenType = errors.New("invalid token type")
 	ErrInvalidRolesType = errors.New("invalid role type. Must be []string")
 	ErrExpired          = errors.New("token is expired")
+	ErrFingerprint      = errors.New("token fingerprint mismatch")
+	ErrRevoked          = errors.New("token is revoked")
+	ErrTokenReused      = errors.New("refresh token reused")
 )
 
 type Security struct {
-	key             []byte
-	Now             func() time.Time
-	ExpiresInterval time.Duration
+	keys        *KeySet
+	repo        *store.Queries
+	Now         func() time.Time
+	AccessTTL   time.Duration
+	RefreshTTL  time.Duration
+	permissions *permissionCache
 }
 
-func NewSecurity() *Security {
+func NewSecurity(repo *store.Queries) *Security {
 	return &Security{
-		key:             []byte(config.Get().Secret.Jwt),
-		Now:             time.Now,
-		ExpiresInterval: 24 * time.Hour,
+		keys:        MustLoadKeySet(),
+		repo:        repo,
+		Now:         time.Now,
+		AccessTTL:   config.Get().Token.AccessTTL,
+		RefreshTTL:  config.Get().Token.RefreshTTL,
+		permissions: &permissionCache{},
 	}
 }
 
-func (security Security) GenerateToken(tokenType TokenType, expiresIn time.Duration, userID uuid.UUID, userRole types.Role) (string, error) {
+func (security Security) GenerateToken(ctx context.Context, tokenType TokenType, expiresIn time.Duration, userID uuid.UUID, userRole types.Role, opts ...TokenOption) (string, error) {
 	claims := AppToken{
 		UserID:    userID,
 		UserRole:  userRole,
 		TokenType: tokenType,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "my-app",
-		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(security.key)
+	for _, opt := range opts {
+		opt(&claims)
+	}
+	return security.signToken(ctx, claims, expiresIn)
 }
 
-func (security Security) VerifyToken(tokenString string, tokenType TokenType) (*AppToken, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &AppToken{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("неожиданный метод подписи: %v", token.Header["alg"])
-		}
-		return security.key, nil
+// GeneratePasswordToken issues a PasswordToken bound to the current password
+// hash of the user. Once the password is changed the token is rejected by
+// VerifyPasswordToken, which makes the reset link single-use.
+func (security Security) GeneratePasswordToken(ctx context.Context, expiresIn time.Duration, userID uuid.UUID, userRole types.Role, passwordHash string) (string, error) {
+	return security.signToken(ctx, AppToken{
+		UserID:      userID,
+		UserRole:    userRole,
+		TokenType:   PasswordToken,
+		Fingerprint: security.fingerprint(passwordHash),
+	}, expiresIn)
+}
+
+// signToken records the token in the tokens table under a fresh jti, so it
+// can be revoked before it expires, and signs it.
+func (security Security) signToken(ctx context.Context, claims AppToken, expiresIn time.Duration) (string, error) {
+	now := security.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		Issuer:    "my-app",
+	}
+	err := security.repo.CreateToken(ctx, store.CreateTokenParams{
+		ID:        claims.ID,
+		UserID:    claims.UserID,
+		TokenType: claims.TokenType,
+		ExpiresAt: claims.ExpiresAt.UTC(),
+		FamilyID:  claims.FamilyID,
 	})
+	if err != nil {
+		return "", err
+	}
+	return security.keys.sign(claims)
+}
+
+// fingerprint hashes the (already salted) password hash, so the hash itself
+// does not end up in the token.
+func (security Security) fingerprint(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyPasswordToken checks a PasswordToken against the password hash the
+// user currently has.
+func (security Security) VerifyPasswordToken(claims *AppToken, passwordHash string) error {
+	if !hmac.Equal([]byte(claims.Fingerprint), []byte(security.fingerprint(passwordHash))) {
+		return ErrFingerprint
+	}
+	return nil
+}
+
+func (security Security) VerifyToken(ctx context.Context, tokenString string, tokenType TokenType) (*AppToken, error) {
+	claims, err := security.parseToken(tokenString, tokenType)
+	if err != nil {
+		return nil, err
+	}
+	row, err := security.repo.GetToken(ctx, claims.ID)
+	if err != nil || row.Revoked == 1 || row.TokenType != tokenType || row.UserID != claims.UserID {
+		return nil, ErrRevoked
+	}
+	return claims, nil
+}
+
+// parseToken checks the signature, lifetime and type of the token without
+// looking at the tokens table.
+func (security Security) parseToken(tokenString string, tokenType TokenType) (*AppToken, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &AppToken{}, security.keys.keyFunc)
 	if err != nil {
 		return nil, ErrInvalidTokenType
 	}
@@ -93,23 +191,58 @@ func (security Security) VerifyToken(tokenString string, tokenType TokenType) (*
 	}
 }
 
-func (security Security) GenerateTokenToCookies(tokenType TokenType, expiresIn time.Duration, userID uuid.UUID, userRole types.Role) (*http.Cookie, error) {
-	token, err := security.GenerateToken(tokenType, expiresIn, userID, userRole)
+// RevokeToken invalidates a single token by its jti.
+func (security Security) RevokeToken(ctx context.Context, id string) error {
+	return security.repo.RevokeToken(ctx, id)
+}
+
+// RevokeTokenFamily invalidates every token issued for one login.
+func (security Security) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	if err := security.repo.RevokeTokenFamily(ctx, familyID); err != nil {
+		return err
+	}
+	return security.repo.RevokeSession(ctx, familyID)
+}
+
+// RevokeUserTokens invalidates every outstanding token of the user.
+func (security Security) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	if err := security.repo.RevokeUserTokens(ctx, userID); err != nil {
+		return err
+	}
+	return security.repo.RevokeUserSessions(ctx, userID)
+}
+
+// RevokeUserTokensOfType invalidates outstanding tokens of one type, e.g.
+// links from emails that were superseded by a newer one.
+func (security Security) RevokeUserTokensOfType(ctx context.Context, userID uuid.UUID, tokenType TokenType) error {
+	return security.repo.RevokeUserTokensByType(ctx, store.RevokeUserTokensByTypeParams{
+		UserID:    userID,
+		TokenType: tokenType,
+	})
+}
+
+func (security Security) GenerateTokenToCookies(ctx context.Context, tokenType TokenType, expiresIn time.Duration, userID uuid.UUID, userRole types.Role, opts ...TokenOption) (*http.Cookie, error) {
+	token, err := security.GenerateToken(ctx, tokenType, expiresIn, userID, userRole, opts...)
 	if err != nil {
 		return &http.Cookie{}, err
 	}
 	return &http.Cookie{
 		Name:     JWTCookieName,
 		Value:    token,
-		Expires:  security.Now().Add(security.ExpiresInterval),
+		Expires:  security.Now().Add(expiresIn),
 		HttpOnly: true,
 		Path:     "/",
 		SameSite: http.SameSiteStrictMode,
 		Secure:   true,
-		MaxAge:   int(security.ExpiresInterval.Seconds()),
+		MaxAge:   int(expiresIn.Seconds()),
 	}, nil
 }
 
+// JWKS returns the public keys tokens can be verified with.
+func (security Security) JWKS() JWKS {
+	return security.keys.JWKS()
+}
+
 func (security Security) DeleteCookie() *http.Cookie {
 	return &http.Cookie{
 		Name:    JWTCookieName,
@@ -0,0 +1,150 @@
+package security
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"huma-app/store"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A session is one login on one device. Its id is the FamilyID of the tokens
+// issued for the login, so every access token names its session.
+
+var (
+	ErrSessionRevoked = errors.New("session is revoked")
+	ErrUserInactive   = errors.New("user is deactivated")
+)
+
+// sessionTouchInterval limits how often last_seen_at is written.
+const sessionTouchInterval = time.Minute
+
+// createSession records a new login. Deactivated users cannot start one,
+// which covers every way to log in.
+func (security Security) createSession(ctx context.Context, userID uuid.UUID, sessionID string) error {
+	active, err := security.repo.GetUserActive(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if active == 0 {
+		return ErrUserInactive
+	}
+	userAgent, _ := ctx.Value("user-agent").(string)
+	ip, _ := ctx.Value("real-ip").(string)
+	return security.repo.CreateSession(ctx, store.CreateSessionParams{
+		ID:        sessionID,
+		UserID:    userID,
+		Device:    DescribeDevice(userAgent),
+		UserAgent: userAgent,
+		Ip:        ip,
+	})
+}
+
+// CheckSession rejects tokens of revoked sessions and keeps the last seen
+// time and address of the session current. Tokens issued outside of a login,
+// like API keys, have no session and pass.
+func (security Security) CheckSession(ctx context.Context, claims *AppToken) error {
+	if claims.FamilyID == "" {
+		return nil
+	}
+	session, err := security.repo.GetSession(ctx, claims.FamilyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSessionRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if session.Revoked == 1 || session.UserID != claims.UserID {
+		return ErrSessionRevoked
+	}
+	if security.Now().Sub(session.LastSeenAt) > sessionTouchInterval {
+		ip, _ := ctx.Value("real-ip").(string)
+		return security.repo.TouchSession(ctx, store.TouchSessionParams{
+			Ip: ip,
+			ID: session.ID,
+		})
+	}
+	return nil
+}
+
+func (security Security) GetUserSessions(ctx context.Context, userID uuid.UUID) ([]store.Session, error) {
+	return security.repo.GetUserSessions(ctx, userID)
+}
+
+// RevokeUserSession ends a session of the user. ErrTokenNotFound means there
+// is no such active session.
+func (security Security) RevokeUserSession(ctx context.Context, userID uuid.UUID, sessionID string) error {
+	session, err := security.repo.GetSession(ctx, sessionID)
+	if err != nil || session.UserID != userID || session.Revoked == 1 {
+		return ErrTokenNotFound
+	}
+	return security.RevokeTokenFamily(ctx, sessionID)
+}
+
+// RevokeOtherSessions ends every session of the user but the given one.
+func (security Security) RevokeOtherSessions(ctx context.Context, userID uuid.UUID, keepID string) error {
+	err := security.repo.RevokeOtherFamilies(ctx, store.RevokeOtherFamiliesParams{
+		UserID:   userID,
+		FamilyID: keepID,
+	})
+	if err != nil {
+		return err
+	}
+	return security.repo.RevokeOtherUserSessions(ctx, store.RevokeOtherUserSessionsParams{
+		UserID: userID,
+		ID:     keepID,
+	})
+}
+
+// DescribeDevice makes a short human readable name like "Firefox on Linux"
+// from a user agent.
+func DescribeDevice(userAgent string) string {
+	if userAgent == "" {
+		return ""
+	}
+	ua := strings.ToLower(userAgent)
+
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"edg/", "Edge"},
+		{"opr/", "Opera"},
+		{"yabrowser/", "Yandex Browser"},
+		{"firefox/", "Firefox"},
+		{"chrome/", "Chrome"},
+		{"safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	os := ""
+	for _, o := range []struct{ token, name string }{
+		{"iphone", "iPhone"},
+		{"ipad", "iPad"},
+		{"android", "Android"},
+		{"windows", "Windows"},
+		{"mac os x", "macOS"},
+		{"linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			os = o.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+	return "Unknown device"
+}
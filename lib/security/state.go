@@ -0,0 +1,34 @@
+package security
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SignClaims signs claims with the active key without recording them in the
+// tokens table. It is meant for short-lived state that is not tied to a user
+// yet, e.g. during an SSO redirect.
+func (security Security) SignClaims(claims jwt.Claims) (string, error) {
+	return security.keys.sign(claims)
+}
+
+// ParseClaims verifies a token produced by SignClaims and decodes it into
+// claims.
+func (security Security) ParseClaims(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, security.keys.keyFunc)
+	if err != nil || !token.Valid {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// RandomString returns n random bytes encoded with unpadded base64url.
+func RandomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -43,12 +44,14 @@ func setLogger() *httplog.Logger {
 	logger := httplog.NewLogger(config.Get().Api.Name, httplog.Options{
 		LogLevel: slog.LevelDebug,
 		// JSON:             true,
-		Concise:          true,
-		RequestHeaders:   true,
-		ResponseHeaders:  true,
-		MessageFieldName: "message",
-		LevelFieldName:   "severity",
-		TimeFieldFormat:  time.RFC3339,
+		Concise:        true,
+		RequestHeaders: true,
+		// httplog hides authorization and cookie headers itself.
+		HideRequestHeaders: []string{"x-api-key", "x-csrf-token"},
+		ResponseHeaders:    true,
+		MessageFieldName:   "message",
+		LevelFieldName:     "severity",
+		TimeFieldFormat:    time.RFC3339,
 		Tags: map[string]string{
 			"version": config.Get().Api.Version,
 			"env":     "dev",
@@ -92,11 +95,14 @@ func NewMux() *chi.Mux {
 	mux := chi.NewMux()
 
 	mux.Use(cors.Handler(cors.Options{
-		// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
-		AllowedOrigins: []string{"https://*", "http://*"},
-		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
+		// Credentials are allowed, so only trusted origins may be listed:
+		// any of them can read the CSRF token. An empty AllowedOrigins would
+		// mean any origin, hence the func.
+		AllowOriginFunc: func(r *http.Request, origin string) bool {
+			return slices.Contains(config.Get().Server.CorsOrigins, origin)
+		},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-API-Key"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
@@ -0,0 +1,146 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"huma-app/lib/config"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown oidc provider")
+	ErrNoIdToken       = errors.New("no id_token in token response")
+	ErrNonceMismatch   = errors.New("nonce mismatch")
+)
+
+// OidcIdentity is what we take from a verified ID token.
+type OidcIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// OidcProvider is an OpenID Connect issuer used for the authorization code
+// flow with PKCE. Discovery happens on first use, so the app starts even if
+// the issuer is unreachable.
+type OidcProvider struct {
+	cfg    config.OidcProvider
+	client *http.Client
+
+	mu       sync.Mutex
+	verifier *oidc.IDTokenVerifier
+	oauth    *oauth2.Config
+}
+
+type OidcProviders map[string]*OidcProvider
+
+// NewOidcProviders builds providers from config. client is used for all
+// requests to the issuers; nil means http.DefaultClient.
+func NewOidcProviders(cfgs []config.OidcProvider, client *http.Client) OidcProviders {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	providers := OidcProviders{}
+	for _, cfg := range cfgs {
+		providers[cfg.Name] = &OidcProvider{cfg: cfg, client: client}
+	}
+	return providers
+}
+
+func (p *OidcProvider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *OidcProvider) Title() string {
+	if p.cfg.Title == "" {
+		return p.cfg.Name
+	}
+	return p.cfg.Title
+}
+
+func (p *OidcProvider) context(ctx context.Context) context.Context {
+	return oidc.ClientContext(ctx, p.client)
+}
+
+func (p *OidcProvider) init() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauth != nil {
+		return nil
+	}
+
+	issuer := strings.TrimSuffix(p.cfg.DiscoveryURL, "/.well-known/openid-configuration")
+	// The context is kept by the provider to refresh the issuer keys later.
+	provider, err := oidc.NewProvider(p.context(context.Background()), issuer)
+	if err != nil {
+		return err
+	}
+
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+	p.oauth = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	return nil
+}
+
+// AuthCodeURL returns the issuer URL the user is redirected to.
+func (p *OidcProvider) AuthCodeURL(state string, nonce string, verifier string) (string, error) {
+	if err := p.init(); err != nil {
+		return "", err
+	}
+	return p.oauth.AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(verifier),
+	), nil
+}
+
+// Exchange trades the authorization code for tokens and verifies the ID
+// token, including its nonce.
+func (p *OidcProvider) Exchange(ctx context.Context, code string, verifier string, nonce string) (*OidcIdentity, error) {
+	if err := p.init(); err != nil {
+		return nil, err
+	}
+	ctx = p.context(ctx)
+
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, ErrNoIdToken
+	}
+	idToken, err := p.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	return &OidcIdentity{
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+	}, nil
+}
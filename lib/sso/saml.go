@@ -0,0 +1,263 @@
+package sso
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"huma-app/lib/config"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+)
+
+var (
+	ErrInvalidSamlKey = errors.New("saml key is not a signing key")
+	ErrNoIdpMetadata  = errors.New("no idp metadata configured")
+	ErrSamlReplay     = errors.New("saml request was already answered")
+)
+
+// SamlRequestTTL is how long a login may take at the IdP. Answered requests
+// are remembered that long, so a response cannot be posted twice.
+const SamlRequestTTL = 10 * time.Minute
+
+// SamlIdentity is what we take from a verified assertion.
+type SamlIdentity struct {
+	Subject    string
+	Email      string
+	Attributes map[string][]string
+}
+
+// SamlProvider is a SAML 2.0 identity provider we are the service provider
+// for, using SP-initiated login with the redirect binding and responses
+// posted to the ACS url. The IdP metadata is loaded on first use, so the app
+// starts even if it is unreachable.
+type SamlProvider struct {
+	cfg    config.SamlProvider
+	client *http.Client
+
+	mu       sync.Mutex
+	sp       *saml.ServiceProvider
+	answered map[string]time.Time
+}
+
+type SamlProviders map[string]*SamlProvider
+
+// NewSamlProviders builds providers from config. client is used to fetch the
+// IdP metadata; nil means http.DefaultClient.
+func NewSamlProviders(cfgs []config.SamlProvider, client *http.Client) SamlProviders {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	providers := SamlProviders{}
+	for _, cfg := range cfgs {
+		providers[cfg.Name] = &SamlProvider{cfg: cfg, client: client, answered: map[string]time.Time{}}
+	}
+	return providers
+}
+
+func (p *SamlProvider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *SamlProvider) Title() string {
+	if p.cfg.Title == "" {
+		return p.cfg.Name
+	}
+	return p.cfg.Title
+}
+
+// RoleMapping returns the role for the first value of the role attribute
+// that has one, or false if there is none. ok is also false when roles are
+// not taken from the IdP at all, see ManagesRoles.
+func (p *SamlProvider) RoleMapping(identity *SamlIdentity) (role string, ok bool) {
+	for _, value := range identity.Attributes[p.cfg.RoleAttribute] {
+		if role, ok := p.cfg.RoleMapping[value]; ok {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+// ManagesRoles tells whether the IdP decides the role of its users.
+func (p *SamlProvider) ManagesRoles() bool {
+	return p.cfg.RoleAttribute != ""
+}
+
+func (p *SamlProvider) url(endpoint string) (url.URL, error) {
+	u, err := url.Parse(strings.TrimSuffix(p.cfg.RootURL, "/") + "/api/auth/saml/" + p.cfg.Name + "/" + endpoint)
+	if err != nil {
+		return url.URL{}, err
+	}
+	return *u, nil
+}
+
+func (p *SamlProvider) init(ctx context.Context) (*saml.ServiceProvider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sp != nil {
+		return p.sp, nil
+	}
+
+	pair, err := tls.LoadX509KeyPair(p.cfg.CertificatePath, p.cfg.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, ErrInvalidSamlKey
+	}
+	certificate, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata *saml.EntityDescriptor
+	switch {
+	case p.cfg.IdpMetadataPath != "":
+		data, err := os.ReadFile(p.cfg.IdpMetadataPath)
+		if err != nil {
+			return nil, err
+		}
+		if metadata, err = samlsp.ParseMetadata(data); err != nil {
+			return nil, err
+		}
+	case p.cfg.IdpMetadataURL != "":
+		metadataURL, err := url.Parse(p.cfg.IdpMetadataURL)
+		if err != nil {
+			return nil, err
+		}
+		if metadata, err = samlsp.FetchMetadata(ctx, p.client, *metadataURL); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrNoIdpMetadata
+	}
+
+	metadataURL, err := p.url("metadata")
+	if err != nil {
+		return nil, err
+	}
+	acsURL, err := p.url("acs")
+	if err != nil {
+		return nil, err
+	}
+	entityID := p.cfg.EntityID
+	if entityID == "" {
+		entityID = metadataURL.String()
+	}
+	p.sp = &saml.ServiceProvider{
+		EntityID:          entityID,
+		Key:               key,
+		Certificate:       certificate,
+		HTTPClient:        p.client,
+		MetadataURL:       metadataURL,
+		AcsURL:            acsURL,
+		IDPMetadata:       metadata,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+	}
+	return p.sp, nil
+}
+
+// Metadata returns the service provider metadata to register at the IdP.
+func (p *SamlProvider) Metadata(ctx context.Context) ([]byte, error) {
+	sp, err := p.init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return xml.MarshalIndent(sp.Metadata(), "", "  ")
+}
+
+// AuthnRequestURL returns the IdP url the user is redirected to and the id of
+// the request, which the response has to refer to.
+func (p *SamlProvider) AuthnRequestURL(ctx context.Context) (string, string, error) {
+	sp, err := p.init(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	request, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", "", err
+	}
+	u, err := request.Redirect("", sp)
+	if err != nil {
+		return "", "", err
+	}
+	return u.String(), request.ID, nil
+}
+
+// answer marks the request as answered, failing if it already was.
+func (p *SamlProvider) answer(requestID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for id, at := range p.answered {
+		if now.Sub(at) > SamlRequestTTL {
+			delete(p.answered, id)
+		}
+	}
+	if _, ok := p.answered[requestID]; ok {
+		return ErrSamlReplay
+	}
+	p.answered[requestID] = now
+	return nil
+}
+
+// ParseResponse verifies the base64 SAMLResponse posted to the ACS url. The
+// assertion has to be signed by the IdP, be meant for us and answer the
+// request with the given id, and each request is answered once.
+func (p *SamlProvider) ParseResponse(ctx context.Context, response string, requestID string) (*SamlIdentity, error) {
+	sp, err := p.init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(response)
+	if err != nil {
+		return nil, err
+	}
+	// The destination is checked against our ACS url as configured rather
+	// than as seen behind a proxy.
+	assertion, err := sp.ParseXMLResponse(decoded, []string{requestID}, sp.AcsURL)
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			return nil, invalid.PrivateErr
+		}
+		return nil, err
+	}
+	if err := p.answer(requestID); err != nil {
+		return nil, err
+	}
+
+	identity := &SamlIdentity{Attributes: map[string][]string{}}
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		identity.Subject = assertion.Subject.NameID.Value
+	}
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			for _, value := range attr.Values {
+				identity.Attributes[attr.Name] = append(identity.Attributes[attr.Name], value.Value)
+				if attr.FriendlyName != "" && attr.FriendlyName != attr.Name {
+					identity.Attributes[attr.FriendlyName] = append(identity.Attributes[attr.FriendlyName], value.Value)
+				}
+			}
+		}
+	}
+	identity.Email = identity.Subject
+	if p.cfg.EmailAttribute != "" {
+		identity.Email = ""
+		if values := identity.Attributes[p.cfg.EmailAttribute]; len(values) > 0 {
+			identity.Email = values[0]
+		}
+	}
+	return identity, nil
+}
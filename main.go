@@ -5,10 +5,12 @@ import (
 	"flag"
 	"fmt"
 	"huma-app/lib/api"
+	"huma-app/lib/audit"
 	"huma-app/lib/config"
 	"huma-app/lib/server"
 	"huma-app/store"
 	"log/slog"
+	"os"
 	"time"
 
 	"github.com/ne-sachirou/go-graceful"
@@ -18,9 +20,20 @@ import (
 func main() {
 
 	spec := flag.Bool("spec", false, "write openapi.json")
+	auditVerify := flag.Bool("audit-verify", false, "check the audit log hash chain and exit")
 	flag.Parse()
 
 	db := store.InitDB()
+	if *auditVerify {
+		count, head, err := audit.NewLogger(store.New(db)).Verify(context.Background())
+		db.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "audit log invalid after %d entries: %v\n", count, err)
+			os.Exit(1)
+		}
+		fmt.Printf("audit log ok: %d entries, head %s\n", count, head)
+		return
+	}
 	mux := server.NewMux()
 	api.NewApi(db, mux)
 	if *spec {
@@ -33,10 +46,15 @@ func main() {
 		config.Get().Server.Port,
 	)
 	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.New(db).RunTokenPruner(ctx, time.Hour)
+
 	slog.Info("Server started on " + addr)
 
 	if err := gracefulhttp.ListenAndServe(
-		context.Background(),
+		ctx,
 		addr,
 		mux,
 		graceful.GracefulShutdownTimeout(time.Second),
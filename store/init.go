@@ -3,14 +3,26 @@ package store
 import (
 	"database/sql"
 	"log/slog"
+	"strings"
 
 	_ "modernc.org/sqlite"
 
 	"huma-app/lib/config"
 )
 
+// dsn enables foreign keys (tokens are removed together with their user) and
+// makes the driver write time.Time values in a format SQLite date functions
+// understand.
+func dsn(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_pragma=foreign_keys(1)&_time_format=sqlite"
+}
+
 func InitDB() *sql.DB {
-	db, err := sql.Open("sqlite", config.Get().Storage.Path)
+	db, err := sql.Open("sqlite", dsn(config.Get().Storage.Path))
 	if err != nil {
 		slog.Error("cannot open db connection", "err", err)
 	}
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS tokens (
+  id TEXT NOT NULL PRIMARY KEY,
+  user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_type TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP NOT NULL,
+  revoked INTEGER NOT NULL DEFAULT 0 CHECK(revoked IN (0,1))
+);
+CREATE INDEX IF NOT EXISTS tokens_user_id_idx ON tokens(user_id);
+CREATE INDEX IF NOT EXISTS tokens_expires_at_idx ON tokens(expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS tokens;
\ No newline at end of file
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE tokens ADD COLUMN family_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS tokens_family_id_idx ON tokens(family_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS tokens_family_id_idx;
+ALTER TABLE tokens DROP COLUMN family_id;
\ No newline at end of file
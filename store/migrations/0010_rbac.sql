@@ -0,0 +1,125 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+CREATE TABLE IF NOT EXISTS roles (
+  name TEXT NOT NULL PRIMARY KEY,
+  description TEXT NOT NULL DEFAULT '',
+  builtin INTEGER NOT NULL DEFAULT 0 CHECK(builtin IN (0,1)),
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+  name TEXT NOT NULL PRIMARY KEY,
+  description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+  role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+  permission TEXT NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+  PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description, builtin) VALUES
+  ('admin', 'Full access', 1),
+  ('user', 'Default role of new users', 1),
+  ('editor', '', 1);
+
+INSERT INTO permissions (name, description) VALUES
+  ('users:read', 'List users'),
+  ('users:write', 'Reset 2FA, unlock and change the role of users'),
+  ('users:delete', 'Delete users'),
+  ('users:impersonate', 'Sign in as another user'),
+  ('roles:read', 'List roles and permissions'),
+  ('roles:write', 'Create, change and delete roles, assign roles to users');
+
+INSERT INTO role_permissions (role, permission) SELECT 'admin', name FROM permissions;
+
+-- The role columns lose their CHECK constraint and reference roles instead.
+-- SQLite cannot alter a constraint, so both tables are rebuilt with foreign
+-- keys off, otherwise dropping users would cascade to tokens and the rest.
+PRAGMA foreign_keys = OFF;
+
+CREATE TABLE users_new (
+  id TEXT NOT NULL PRIMARY KEY,
+  email TEXT NOT NULL,
+  password TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  role TEXT NOT NULL DEFAULT 'user' REFERENCES roles(name),
+  verified INTEGER NOT NULL DEFAULT 0 CHECK(verified IN (0,1)),
+  totp_secret TEXT NOT NULL DEFAULT '',
+  totp_enabled INTEGER NOT NULL DEFAULT 0 CHECK(totp_enabled IN (0,1)),
+  failed_logins INTEGER NOT NULL DEFAULT 0,
+  locked_until TIMESTAMP,
+  pending_email TEXT NOT NULL DEFAULT '',
+  UNIQUE (email)
+);
+INSERT INTO users_new (id, email, password, created_at, role, verified, totp_secret, totp_enabled, failed_logins, locked_until, pending_email)
+SELECT id, email, password, created_at, role, verified, totp_secret, totp_enabled, failed_logins, locked_until, pending_email FROM users;
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+
+CREATE TABLE api_keys_new (
+  id TEXT NOT NULL PRIMARY KEY,
+  user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  prefix TEXT NOT NULL,
+  key_hash TEXT NOT NULL,
+  role TEXT NOT NULL DEFAULT 'user' REFERENCES roles(name) ON DELETE SET DEFAULT,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP,
+  last_used_at TIMESTAMP,
+  UNIQUE (key_hash)
+);
+INSERT INTO api_keys_new SELECT id, user_id, name, prefix, key_hash, role, created_at, expires_at, last_used_at FROM api_keys;
+DROP TABLE api_keys;
+ALTER TABLE api_keys_new RENAME TO api_keys;
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys(user_id);
+
+PRAGMA foreign_keys = ON;
+
+-- +goose Down
+PRAGMA foreign_keys = OFF;
+
+CREATE TABLE users_old (
+  id TEXT NOT NULL PRIMARY KEY,
+  email TEXT NOT NULL,
+  password TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  role TEXT NOT NULL DEFAULT 'user' CHECK(role IN ('admin', 'user', 'editor')),
+  verified INTEGER NOT NULL DEFAULT 0 CHECK(verified IN (0,1)),
+  totp_secret TEXT NOT NULL DEFAULT '',
+  totp_enabled INTEGER NOT NULL DEFAULT 0 CHECK(totp_enabled IN (0,1)),
+  failed_logins INTEGER NOT NULL DEFAULT 0,
+  locked_until TIMESTAMP,
+  pending_email TEXT NOT NULL DEFAULT '',
+  UNIQUE (email)
+);
+INSERT INTO users_old (id, email, password, created_at, role, verified, totp_secret, totp_enabled, failed_logins, locked_until, pending_email)
+SELECT id, email, password, created_at, CASE WHEN role IN ('admin', 'user', 'editor') THEN role ELSE 'user' END,
+       verified, totp_secret, totp_enabled, failed_logins, locked_until, pending_email FROM users;
+DROP TABLE users;
+ALTER TABLE users_old RENAME TO users;
+
+CREATE TABLE api_keys_old (
+  id TEXT NOT NULL PRIMARY KEY,
+  user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  prefix TEXT NOT NULL,
+  key_hash TEXT NOT NULL,
+  role TEXT NOT NULL DEFAULT 'user' CHECK(role IN ('admin', 'user', 'editor')),
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP,
+  last_used_at TIMESTAMP,
+  UNIQUE (key_hash)
+);
+INSERT INTO api_keys_old SELECT id, user_id, name, prefix, key_hash,
+       CASE WHEN role IN ('admin', 'user', 'editor') THEN role ELSE 'user' END,
+       created_at, expires_at, last_used_at FROM api_keys;
+DROP TABLE api_keys;
+ALTER TABLE api_keys_old RENAME TO api_keys;
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys(user_id);
+
+PRAGMA foreign_keys = ON;
+
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
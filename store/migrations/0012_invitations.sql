@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS invitations (
+  id TEXT NOT NULL PRIMARY KEY,
+  email TEXT NOT NULL,
+  role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+  token_hash TEXT NOT NULL,
+  invited_by TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP NOT NULL,
+  UNIQUE (email),
+  UNIQUE (token_hash)
+);
+
+INSERT INTO permissions (name, description) VALUES ('users:invite', 'Invite new users by email');
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'users:invite');
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'users:invite';
+DROP TABLE IF EXISTS invitations;
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS known_devices (
+  user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  user_agent TEXT NOT NULL,
+  ip TEXT NOT NULL,
+  first_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, user_agent, ip)
+);
+
+-- Devices of open sessions are known, so nobody is warned about them.
+INSERT OR IGNORE INTO known_devices (user_id, user_agent, ip, first_seen_at, last_seen_at)
+SELECT user_id, user_agent, ip, MIN(created_at), MAX(last_seen_at)
+FROM sessions
+WHERE revoked = 0
+GROUP BY user_id, user_agent, ip;
+
+ALTER TABLE users ADD COLUMN login_notices INTEGER NOT NULL DEFAULT 1 CHECK(login_notices IN (0,1));
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN login_notices;
+DROP TABLE IF EXISTS known_devices;
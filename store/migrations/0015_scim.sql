@@ -0,0 +1,14 @@
+-- +goose Up
+-- Deactivated users keep their data but cannot log in, SCIM clients
+-- deprovision by deactivating. external_id is the id of the user at the
+-- identity provider.
+ALTER TABLE users ADD COLUMN active INTEGER NOT NULL DEFAULT 1 CHECK(active IN (0,1));
+ALTER TABLE users ADD COLUMN external_id TEXT NOT NULL DEFAULT '';
+
+INSERT INTO permissions (name, description) VALUES ('scim:provision', 'Provision users and groups over SCIM');
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'scim:provision');
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'scim:provision';
+ALTER TABLE users DROP COLUMN external_id;
+ALTER TABLE users DROP COLUMN active;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Time step of the last TOTP code accepted for the user. Codes of that step
+-- or an earlier one are rejected, so a code cannot be used twice.
+ALTER TABLE users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+
+-- Wrong codes entered for a two-factor login challenge.
+CREATE TABLE IF NOT EXISTS two_factor_attempts (
+  token_id TEXT NOT NULL PRIMARY KEY REFERENCES tokens(id) ON DELETE CASCADE,
+  failures INTEGER NOT NULL DEFAULT 0
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS two_factor_attempts;
+ALTER TABLE users DROP COLUMN totp_last_step;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- Invitation emails are stored lower-cased and looked up the same way. Of
+-- invitations to one organization that only differ in case, one is kept.
+UPDATE OR REPLACE org_invitations SET email = lower(email) WHERE email != lower(email);
+
+-- +goose Down
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Set on the identity whose provider created the user. Only that provider
+-- manages the role of the user; identities linked to an existing account
+-- leave it alone.
+ALTER TABLE user_identities ADD COLUMN provisioned INTEGER NOT NULL DEFAULT 0;
+UPDATE user_identities SET provisioned = 1 WHERE EXISTS (
+  SELECT 1 FROM audit_events
+  WHERE audit_events.action = 'user.provision'
+    AND audit_events.target = user_identities.user_id
+    AND json_extract(audit_events.metadata, '$.provider') = user_identities.provider
+);
+
+-- +goose Down
+ALTER TABLE user_identities DROP COLUMN provisioned;
@@ -5,17 +5,152 @@
 package store
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 	"huma-app/store/types"
 )
 
-type User struct {
+type ApiKey struct {
+	ID         uuid.UUID    `json:"id"`
+	UserID     uuid.UUID    `json:"user_id"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	KeyHash    string       `json:"key_hash"`
+	Role       types.Role   `json:"role"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+}
+
+type AuditEvent struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ActorID   string    `json:"actor_id"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Ip        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Metadata  string    `json:"metadata"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+type Invitation struct {
 	ID        uuid.UUID  `json:"id"`
 	Email     string     `json:"email"`
-	Password  string     `json:"password"`
-	CreatedAt time.Time  `json:"created_at"`
 	Role      types.Role `json:"role"`
-	Verified  int64      `json:"verified"`
+	TokenHash string     `json:"token_hash"`
+	InvitedBy uuid.UUID  `json:"invited_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
+type KnownDevice struct {
+	UserID      uuid.UUID `json:"user_id"`
+	UserAgent   string    `json:"user_agent"`
+	Ip          string    `json:"ip"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+type OrgInvitation struct {
+	ID        uuid.UUID     `json:"id"`
+	OrgID     uuid.UUID     `json:"org_id"`
+	Email     string        `json:"email"`
+	Role      types.OrgRole `json:"role"`
+	CreatedAt time.Time     `json:"created_at"`
+	ExpiresAt time.Time     `json:"expires_at"`
+}
+
+type OrgMember struct {
+	OrgID     uuid.UUID     `json:"org_id"`
+	UserID    uuid.UUID     `json:"user_id"`
+	Role      types.OrgRole `json:"role"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+type Organization struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type RecoveryCode struct {
+	ID       int64        `json:"id"`
+	UserID   uuid.UUID    `json:"user_id"`
+	CodeHash string       `json:"code_hash"`
+	UsedAt   sql.NullTime `json:"used_at"`
+}
+
+type Role struct {
+	Name        types.Role `json:"name"`
+	Description string     `json:"description"`
+	Builtin     int64      `json:"builtin"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type RolePermission struct {
+	Role       types.Role `json:"role"`
+	Permission string     `json:"permission"`
+}
+
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     uuid.UUID `json:"user_id"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"user_agent"`
+	Ip         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Revoked    int64     `json:"revoked"`
+}
+
+type Token struct {
+	ID        string          `json:"id"`
+	UserID    uuid.UUID       `json:"user_id"`
+	TokenType types.TokenType `json:"token_type"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	Revoked   int64           `json:"revoked"`
+	FamilyID  string          `json:"family_id"`
+}
+
+type TwoFactorAttempt struct {
+	TokenID  string `json:"token_id"`
+	Failures int64  `json:"failures"`
+}
+
+type User struct {
+	ID           uuid.UUID    `json:"id"`
+	Email        string       `json:"email"`
+	Password     string       `json:"password"`
+	CreatedAt    time.Time    `json:"created_at"`
+	Role         types.Role   `json:"role"`
+	Verified     int64        `json:"verified"`
+	TotpSecret   string       `json:"totp_secret"`
+	TotpEnabled  int64        `json:"totp_enabled"`
+	FailedLogins int64        `json:"failed_logins"`
+	LockedUntil  sql.NullTime `json:"locked_until"`
+	PendingEmail string       `json:"pending_email"`
+	LoginNotices int64        `json:"login_notices"`
+	Active       int64        `json:"active"`
+	ExternalID   string       `json:"external_id"`
+	TotpLastStep int64        `json:"totp_last_step"`
+}
+
+type UserIdentity struct {
+	ID          int64     `json:"id"`
+	UserID      uuid.UUID `json:"user_id"`
+	Provider    string    `json:"provider"`
+	Subject     string    `json:"subject"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	Provisioned int64     `json:"provisioned"`
 }
@@ -0,0 +1,28 @@
+-- name: CreateApiKey :one
+INSERT INTO api_keys
+(
+    id,
+    user_id,
+    name,
+    prefix,
+    key_hash,
+    role,
+    expires_at
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?
+) RETURNING id, name, prefix, role, created_at, expires_at, last_used_at;
+
+-- name: GetUserApiKeys :many
+SELECT id, name, prefix, role, created_at, expires_at, last_used_at
+FROM api_keys WHERE user_id = ? ORDER BY created_at;
+
+-- name: GetApiKeyByHash :one
+SELECT api_keys.id, api_keys.user_id, api_keys.role, api_keys.expires_at, users.role AS user_role, users.active AS user_active
+FROM api_keys JOIN users ON users.id = api_keys.user_id
+WHERE api_keys.key_hash = ? LIMIT 1;
+
+-- name: TouchApiKey :exec
+UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?;
+
+-- name: DeleteApiKey :execrows
+DELETE FROM api_keys WHERE id = ? AND user_id = ?;
\ No newline at end of file
@@ -0,0 +1,33 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events
+(
+    created_at,
+    actor_id,
+    action,
+    target,
+    ip,
+    user_agent,
+    metadata,
+    prev_hash,
+    hash
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?, ?, ?
+);
+
+-- name: GetLastAuditHash :one
+SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1;
+
+-- name: GetAuditEvents :many
+SELECT id, created_at, actor_id, action, target, ip, user_agent, metadata, prev_hash, hash FROM audit_events
+WHERE (CAST(sqlc.arg(actor_id) AS TEXT) = '' OR actor_id = sqlc.arg(actor_id))
+  AND (CAST(sqlc.arg(action) AS TEXT) = '' OR action = sqlc.arg(action))
+  AND (CAST(sqlc.arg(target) AS TEXT) = '' OR target = sqlc.arg(target))
+  AND (CAST(sqlc.arg(before_id) AS INTEGER) = 0 OR id < sqlc.arg(before_id))
+  AND datetime(created_at) >= datetime(sqlc.arg(since))
+  AND datetime(created_at) < datetime(sqlc.arg(until))
+ORDER BY id DESC
+LIMIT sqlc.arg(max_rows);
+
+-- name: GetAuditEventsAfter :many
+SELECT id, created_at, actor_id, action, target, ip, user_agent, metadata, prev_hash, hash FROM audit_events
+WHERE id > ? ORDER BY id LIMIT ?;
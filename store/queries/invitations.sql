@@ -0,0 +1,35 @@
+-- name: CreateInvitation :one
+INSERT INTO invitations
+(
+    id,
+    email,
+    role,
+    token_hash,
+    invited_by,
+    expires_at
+) VALUES (
+    ?, ?, ?, ?, ?, ?
+)
+ON CONFLICT (email) DO UPDATE SET
+    role = excluded.role,
+    token_hash = excluded.token_hash,
+    invited_by = excluded.invited_by,
+    created_at = CURRENT_TIMESTAMP,
+    expires_at = excluded.expires_at
+RETURNING id, email, role, token_hash, invited_by, created_at, expires_at;
+
+-- name: GetInvitations :many
+SELECT id, email, role, token_hash, invited_by, created_at, expires_at FROM invitations ORDER BY created_at DESC;
+
+-- name: GetInvitation :one
+SELECT id, email, role, token_hash, invited_by, created_at, expires_at FROM invitations WHERE id = ? LIMIT 1;
+
+-- name: GetInvitationByTokenHash :one
+SELECT id, email, role, token_hash, invited_by, created_at, expires_at FROM invitations WHERE token_hash = ? LIMIT 1;
+
+-- name: RenewInvitation :one
+UPDATE invitations SET token_hash = ?, expires_at = ? WHERE id = ?
+RETURNING id, email, role, token_hash, invited_by, created_at, expires_at;
+
+-- name: DeleteInvitation :execrows
+DELETE FROM invitations WHERE id = ?;
@@ -0,0 +1,16 @@
+-- name: CountKnownDevices :one
+SELECT COUNT(*) FROM known_devices WHERE user_id = ?;
+
+-- name: CreateKnownDevice :exec
+INSERT OR IGNORE INTO known_devices
+(
+    user_id,
+    user_agent,
+    ip
+) VALUES (
+    ?, ?, ?
+);
+
+-- name: TouchKnownDevice :execrows
+UPDATE known_devices SET last_seen_at = CURRENT_TIMESTAMP
+WHERE user_id = ? AND user_agent = ? AND ip = ?;
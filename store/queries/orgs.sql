@@ -0,0 +1,89 @@
+-- name: CreateOrganization :one
+INSERT INTO organizations
+(
+    id,
+    name
+) VALUES (
+    ?, ?
+) RETURNING id, name, created_at;
+
+-- name: GetOrganization :one
+SELECT id, name, created_at FROM organizations WHERE id = ? LIMIT 1;
+
+-- name: GetUserOrganizations :many
+SELECT organizations.id, organizations.name, organizations.created_at, org_members.role
+FROM organizations
+JOIN org_members ON org_members.org_id = organizations.id
+WHERE org_members.user_id = ?
+ORDER BY organizations.name;
+
+-- name: RenameOrganization :exec
+UPDATE organizations SET name = ? WHERE id = ?;
+
+-- name: DeleteOrganization :exec
+DELETE FROM organizations WHERE id = ?;
+
+-- name: AddOrgMember :exec
+INSERT INTO org_members (org_id, user_id, role) VALUES (?, ?, ?)
+ON CONFLICT (org_id, user_id) DO NOTHING;
+
+-- name: GetOrgMemberRole :one
+SELECT role FROM org_members WHERE org_id = ? AND user_id = ? LIMIT 1;
+
+-- name: GetOrgMembers :many
+SELECT org_members.user_id, users.email, org_members.role, org_members.created_at
+FROM org_members
+JOIN users ON users.id = org_members.user_id
+WHERE org_members.org_id = ?
+ORDER BY org_members.created_at;
+
+-- name: SetOrgMemberRole :execrows
+UPDATE org_members SET role = ? WHERE org_id = ? AND user_id = ?;
+
+-- name: RemoveOrgMember :execrows
+DELETE FROM org_members WHERE org_id = ? AND user_id = ?;
+
+-- name: CountOrgOwners :one
+SELECT COUNT(*) FROM org_members WHERE org_id = ? AND role = 'owner';
+
+-- name: CreateOrgInvitation :one
+INSERT INTO org_invitations
+(
+    id,
+    org_id,
+    email,
+    role,
+    expires_at
+) VALUES (
+    ?, ?, ?, ?, ?
+)
+ON CONFLICT (org_id, email) DO UPDATE SET
+    role = excluded.role,
+    created_at = CURRENT_TIMESTAMP,
+    expires_at = excluded.expires_at
+RETURNING id, org_id, email, role, created_at, expires_at;
+
+-- name: GetOrgInvitations :many
+SELECT id, org_id, email, role, created_at, expires_at FROM org_invitations
+WHERE org_id = ? AND datetime(expires_at) > datetime('now')
+ORDER BY created_at DESC;
+
+-- name: GetInvitationsByEmail :many
+SELECT org_invitations.id, org_invitations.org_id, organizations.name AS org_name, org_invitations.role, org_invitations.created_at, org_invitations.expires_at
+FROM org_invitations
+JOIN organizations ON organizations.id = org_invitations.org_id
+WHERE org_invitations.email = ? AND datetime(org_invitations.expires_at) > datetime('now')
+ORDER BY org_invitations.created_at DESC;
+
+-- name: GetInvitationByEmail :one
+SELECT id, org_id, email, role, created_at, expires_at FROM org_invitations
+WHERE id = ? AND email = ? AND datetime(expires_at) > datetime('now') LIMIT 1;
+
+-- name: DeleteOrgInvitation :execrows
+DELETE FROM org_invitations WHERE id = ? AND org_id = ?;
+
+-- name: DeleteInvitationByEmail :execrows
+DELETE FROM org_invitations WHERE id = ? AND email = ?;
+
+-- name: DeleteExpiredOrgInvitations :execrows
+DELETE FROM org_invitations WHERE datetime(expires_at) < datetime('now');
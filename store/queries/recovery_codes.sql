@@ -0,0 +1,15 @@
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes
+(
+    user_id,
+    code_hash
+) VALUES (
+    ?, ?
+);
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes WHERE user_id = ?;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+WHERE user_id = ? AND code_hash = ? AND used_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,38 @@
+-- name: GetRoles :many
+SELECT name, description, builtin, created_at FROM roles ORDER BY name;
+
+-- name: GetRole :one
+SELECT name, description, builtin, created_at FROM roles WHERE name = ? LIMIT 1;
+
+-- name: CreateRole :one
+INSERT INTO roles
+(
+    name,
+    description
+) VALUES (
+    ?, ?
+) RETURNING name, description, builtin, created_at;
+
+-- name: UpdateRoleDescription :exec
+UPDATE roles SET description = ? WHERE name = ?;
+
+-- name: DeleteRole :execrows
+DELETE FROM roles WHERE name = ? AND builtin = 0;
+
+-- name: CountUsersWithRole :one
+SELECT COUNT(*) FROM users WHERE role = ?;
+
+-- name: GetPermissions :many
+SELECT name, description FROM permissions ORDER BY name;
+
+-- name: GetRolePermissions :many
+SELECT permission FROM role_permissions WHERE role = ? ORDER BY permission;
+
+-- name: GetAllRolePermissions :many
+SELECT role, permission FROM role_permissions;
+
+-- name: AddRolePermission :exec
+INSERT INTO role_permissions (role, permission) VALUES (?, ?);
+
+-- name: DeleteRolePermissions :exec
+DELETE FROM role_permissions WHERE role = ?;
@@ -0,0 +1,33 @@
+-- name: CreateSession :exec
+INSERT INTO sessions
+(
+    id,
+    user_id,
+    device,
+    user_agent,
+    ip
+) VALUES (
+    ?, ?, ?, ?, ?
+);
+
+-- name: GetSession :one
+SELECT * FROM sessions WHERE id = ? LIMIT 1;
+
+-- name: GetUserSessions :many
+SELECT * FROM sessions WHERE user_id = ? AND revoked = 0 ORDER BY last_seen_at DESC;
+
+-- name: TouchSession :exec
+UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP, ip = ? WHERE id = ?;
+
+-- name: RevokeSession :exec
+UPDATE sessions SET revoked = 1 WHERE id = ?;
+
+-- name: RevokeUserSessions :exec
+UPDATE sessions SET revoked = 1 WHERE user_id = ?;
+
+-- name: RevokeOtherUserSessions :exec
+UPDATE sessions SET revoked = 1 WHERE user_id = ? AND id != ?;
+
+-- name: DeleteStaleSessions :execrows
+DELETE FROM sessions
+WHERE revoked = 1 OR NOT EXISTS (SELECT 1 FROM tokens WHERE tokens.family_id = sessions.id);
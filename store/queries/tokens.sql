@@ -0,0 +1,41 @@
+-- name: CreateToken :exec
+INSERT INTO tokens
+(
+    id,
+    user_id,
+    token_type,
+    expires_at,
+    family_id
+) VALUES (
+    ?, ?, ?, ?, ?
+);
+
+-- name: GetToken :one
+SELECT * FROM tokens WHERE id = ? LIMIT 1;
+
+-- name: RevokeToken :exec
+UPDATE tokens SET revoked = 1 WHERE id = ?;
+
+-- name: RevokeActiveToken :execrows
+UPDATE tokens SET revoked = 1 WHERE id = ? AND revoked = 0;
+
+-- name: RevokeTokenFamily :exec
+UPDATE tokens SET revoked = 1 WHERE family_id = ?;
+
+-- name: RevokeUserTokens :exec
+UPDATE tokens SET revoked = 1 WHERE user_id = ?;
+
+-- name: DeleteExpiredTokens :execrows
+DELETE FROM tokens WHERE datetime(expires_at) < datetime('now');
+
+-- name: RevokeUserTokensByType :exec
+UPDATE tokens SET revoked = 1 WHERE user_id = ? AND token_type = ?;
+
+
+-- name: RevokeOtherFamilies :exec
+UPDATE tokens SET revoked = 1 WHERE user_id = ? AND family_id != '' AND family_id != ?;
+
+-- name: RecordTwoFactorFailure :one
+INSERT INTO two_factor_attempts (token_id, failures) VALUES (?, 1)
+ON CONFLICT (token_id) DO UPDATE SET failures = failures + 1
+RETURNING failures;
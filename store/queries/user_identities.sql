@@ -0,0 +1,19 @@
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities
+(
+    user_id,
+    provider,
+    subject,
+    email,
+    provisioned
+) VALUES (
+    ?, ?, ?, ?, ?
+);
+
+-- name: GetUserByIdentity :one
+SELECT users.id, users.email, users.role, users.active, users.totp_enabled, user_identities.provisioned
+FROM user_identities JOIN users ON users.id = user_identities.user_id
+WHERE user_identities.provider = ? AND user_identities.subject = ? LIMIT 1;
+
+-- name: GetUserIdentityProviders :many
+SELECT provider FROM user_identities WHERE user_id = ? ORDER BY id;
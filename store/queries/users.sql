@@ -9,10 +9,13 @@ INSERT INTO users
 ) RETURNING id,email, role ;
 
 -- name: GetUserById :one
-SELECT id, email, role FROM users WHERE id = ? LIMIT 1;
+SELECT id, email, role, verified, login_notices FROM users WHERE id = ? LIMIT 1;
 
 -- name: GetUserByEmail :one
-SELECT id, email, password, role FROM users WHERE email = ? LIMIT 1;
+SELECT id, email, password, role, verified, totp_enabled, failed_logins, locked_until, active FROM users WHERE email = ? LIMIT 1;
+
+-- name: GetUserWithPasswordById :one
+SELECT id, email, password, role FROM users WHERE id = ? LIMIT 1;
 
 -- name: GetUsers :many
 SELECT id, email, role, created_at FROM users;
@@ -21,4 +24,74 @@ SELECT id, email, role, created_at FROM users;
 DELETE FROM users WHERE id = ?;
 
 -- name: VerifyUser :exec
-UPDATE users SET verified = 1 WHERE id = ?;
\ No newline at end of file
+UPDATE users SET verified = 1 WHERE id = ?;
+
+-- name: UpdateUserPassword :exec
+UPDATE users SET password = ? WHERE id = ?;
+
+-- name: GetUserTotp :one
+SELECT id, email, role, totp_secret, totp_enabled, active FROM users WHERE id = ? LIMIT 1;
+
+-- name: SetUserTotpSecret :exec
+UPDATE users SET totp_secret = ?, totp_enabled = 0 WHERE id = ?;
+
+-- name: EnableUserTotp :exec
+UPDATE users SET totp_enabled = 1 WHERE id = ?;
+
+-- name: DisableUserTotp :exec
+UPDATE users SET totp_secret = '', totp_enabled = 0 WHERE id = ?;
+
+-- name: ClaimTotpStep :execrows
+UPDATE users SET totp_last_step = sqlc.arg(step)
+WHERE id = sqlc.arg(id) AND totp_last_step < sqlc.arg(step);
+
+-- name: IncrementFailedLogins :one
+UPDATE users SET failed_logins = failed_logins + 1 WHERE id = ? RETURNING failed_logins;
+
+-- name: SetUserLockedUntil :exec
+UPDATE users SET locked_until = ? WHERE id = ?;
+
+-- name: ResetFailedLogins :exec
+UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = ?;
+
+-- name: GetUserPendingEmail :one
+SELECT id, email, role, pending_email FROM users WHERE id = ? LIMIT 1;
+
+-- name: SetUserPendingEmail :exec
+UPDATE users SET pending_email = ? WHERE id = ?;
+
+-- name: ApplyPendingEmail :execrows
+UPDATE users SET email = pending_email, pending_email = '', verified = 1 WHERE id = ? AND pending_email != '';
+
+-- name: SetUserRole :exec
+UPDATE users SET role = ? WHERE id = ?;
+
+-- name: GetUsersByOrg :many
+SELECT users.id, users.email, users.role, users.created_at
+FROM users
+JOIN org_members ON org_members.user_id = users.id
+WHERE org_members.org_id = ?;
+
+-- name: SetUserLoginNotices :exec
+UPDATE users SET login_notices = ? WHERE id = ?;
+
+-- name: GetUserActive :one
+SELECT active FROM users WHERE id = ? LIMIT 1;
+
+-- name: SetUserActive :exec
+UPDATE users SET active = ? WHERE id = ?;
+
+-- name: SetUserExternalID :exec
+UPDATE users SET external_id = ? WHERE id = ?;
+
+-- name: UpdateUserEmail :exec
+UPDATE users SET email = ?, pending_email = '' WHERE id = ?;
+
+-- name: GetScimUsers :many
+SELECT id, email, role, active, external_id, created_at FROM users ORDER BY created_at, id;
+
+-- name: GetScimUser :one
+SELECT id, email, role, active, external_id, created_at FROM users WHERE id = ? LIMIT 1;
+
+-- name: GetUsersByRole :many
+SELECT id, email FROM users WHERE role = ? ORDER BY email;
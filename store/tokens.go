@@ -0,0 +1,40 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// RunTokenPruner periodically deletes expired rows from the tokens table,
+// sessions left without tokens and expired organization invitations, until
+// ctx is cancelled.
+func (q *Queries) RunTokenPruner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := q.DeleteExpiredTokens(ctx)
+		if err != nil {
+			slog.Error("cannot prune expired tokens", "err", err)
+		} else if n > 0 {
+			slog.Info("expired tokens pruned", "count", n)
+		}
+		n, err = q.DeleteStaleSessions(ctx)
+		if err != nil {
+			slog.Error("cannot prune stale sessions", "err", err)
+		} else if n > 0 {
+			slog.Info("stale sessions pruned", "count", n)
+		}
+		n, err = q.DeleteExpiredOrgInvitations(ctx)
+		if err != nil {
+			slog.Error("cannot prune expired invitations", "err", err)
+		} else if n > 0 {
+			slog.Info("expired invitations pruned", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
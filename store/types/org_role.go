@@ -0,0 +1,23 @@
+package types
+
+// OrgRole is the role of a member within one organization, independent of
+// the global Role of the user.
+type OrgRole string
+
+const (
+	OrgRoleOwner  OrgRole = "owner"
+	OrgRoleAdmin  OrgRole = "admin"
+	OrgRoleMember OrgRole = "member"
+)
+
+var orgRoleRank = map[OrgRole]int{
+	OrgRoleMember: 1,
+	OrgRoleAdmin:  2,
+	OrgRoleOwner:  3,
+}
+
+// AtLeast reports whether the role grants everything min grants. Unknown
+// roles grant nothing.
+func (r OrgRole) AtLeast(min OrgRole) bool {
+	return orgRoleRank[r] > 0 && orgRoleRank[r] >= orgRoleRank[min]
+}
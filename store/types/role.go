@@ -1,5 +1,7 @@
 package types
 
+// Role names a row of the roles table. Roles are managed at runtime, the
+// constants are the built-in ones.
 type Role string
 
 const (
@@ -7,12 +9,3 @@ const (
 	RoleUser   Role = "user"
 	RoleEditor Role = "editor"
 )
-
-func (r Role) IsValid() bool {
-	switch r {
-	case RoleAdmin, RoleUser, RoleEditor:
-		return true
-	default:
-		return false
-	}
-}
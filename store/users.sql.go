@@ -7,12 +7,43 @@ package store
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 	"huma-app/store/types"
 )
 
+const applyPendingEmail = `-- name: ApplyPendingEmail :execrows
+UPDATE users SET email = pending_email, pending_email = '', verified = 1 WHERE id = ? AND pending_email != ''
+`
+
+func (q *Queries) ApplyPendingEmail(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, applyPendingEmail, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const claimTotpStep = `-- name: ClaimTotpStep :execrows
+UPDATE users SET totp_last_step = ?1
+WHERE id = ?2 AND totp_last_step < ?1
+`
+
+type ClaimTotpStepParams struct {
+	Step int64     `json:"step"`
+	ID   uuid.UUID `json:"id"`
+}
+
+func (q *Queries) ClaimTotpStep(ctx context.Context, arg ClaimTotpStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, claimTotpStep, arg.Step, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users
 (
@@ -52,15 +83,119 @@ func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const disableUserTotp = `-- name: DisableUserTotp :exec
+UPDATE users SET totp_secret = '', totp_enabled = 0 WHERE id = ?
+`
+
+func (q *Queries) DisableUserTotp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, disableUserTotp, id)
+	return err
+}
+
+const enableUserTotp = `-- name: EnableUserTotp :exec
+UPDATE users SET totp_enabled = 1 WHERE id = ?
+`
+
+func (q *Queries) EnableUserTotp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, enableUserTotp, id)
+	return err
+}
+
+const getScimUser = `-- name: GetScimUser :one
+SELECT id, email, role, active, external_id, created_at FROM users WHERE id = ? LIMIT 1
+`
+
+type GetScimUserRow struct {
+	ID         uuid.UUID  `json:"id"`
+	Email      string     `json:"email"`
+	Role       types.Role `json:"role"`
+	Active     int64      `json:"active"`
+	ExternalID string     `json:"external_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (q *Queries) GetScimUser(ctx context.Context, id uuid.UUID) (GetScimUserRow, error) {
+	row := q.db.QueryRowContext(ctx, getScimUser, id)
+	var i GetScimUserRow
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Role,
+		&i.Active,
+		&i.ExternalID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getScimUsers = `-- name: GetScimUsers :many
+SELECT id, email, role, active, external_id, created_at FROM users ORDER BY created_at, id
+`
+
+type GetScimUsersRow struct {
+	ID         uuid.UUID  `json:"id"`
+	Email      string     `json:"email"`
+	Role       types.Role `json:"role"`
+	Active     int64      `json:"active"`
+	ExternalID string     `json:"external_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (q *Queries) GetScimUsers(ctx context.Context) ([]GetScimUsersRow, error) {
+	rows, err := q.db.QueryContext(ctx, getScimUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetScimUsersRow
+	for rows.Next() {
+		var i GetScimUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.Role,
+			&i.Active,
+			&i.ExternalID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserActive = `-- name: GetUserActive :one
+SELECT active FROM users WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetUserActive(ctx context.Context, id uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getUserActive, id)
+	var active int64
+	err := row.Scan(&active)
+	return active, err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, password, role FROM users WHERE email = ? LIMIT 1
+SELECT id, email, password, role, verified, totp_enabled, failed_logins, locked_until, active FROM users WHERE email = ? LIMIT 1
 `
 
 type GetUserByEmailRow struct {
-	ID       uuid.UUID  `json:"id"`
-	Email    string     `json:"email"`
-	Password string     `json:"password"`
-	Role     types.Role `json:"role"`
+	ID           uuid.UUID    `json:"id"`
+	Email        string       `json:"email"`
+	Password     string       `json:"password"`
+	Role         types.Role   `json:"role"`
+	Verified     int64        `json:"verified"`
+	TotpEnabled  int64        `json:"totp_enabled"`
+	FailedLogins int64        `json:"failed_logins"`
+	LockedUntil  sql.NullTime `json:"locked_until"`
+	Active       int64        `json:"active"`
 }
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (GetUserByEmailRow, error) {
@@ -71,6 +206,11 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (GetUserByEm
 		&i.Email,
 		&i.Password,
 		&i.Role,
+		&i.Verified,
+		&i.TotpEnabled,
+		&i.FailedLogins,
+		&i.LockedUntil,
+		&i.Active,
 	)
 	return i, err
 }
@@ -78,19 +218,100 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (GetUserByEm
 const getUserById = `-- name: GetUserById :one
 ;
 
-SELECT id, email, role FROM users WHERE id = ? LIMIT 1
+SELECT id, email, role, verified, login_notices FROM users WHERE id = ? LIMIT 1
 `
 
 type GetUserByIdRow struct {
-	ID    uuid.UUID  `json:"id"`
-	Email string     `json:"email"`
-	Role  types.Role `json:"role"`
+	ID           uuid.UUID  `json:"id"`
+	Email        string     `json:"email"`
+	Role         types.Role `json:"role"`
+	Verified     int64      `json:"verified"`
+	LoginNotices int64      `json:"login_notices"`
 }
 
 func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (GetUserByIdRow, error) {
 	row := q.db.QueryRowContext(ctx, getUserById, id)
 	var i GetUserByIdRow
-	err := row.Scan(&i.ID, &i.Email, &i.Role)
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Role,
+		&i.Verified,
+		&i.LoginNotices,
+	)
+	return i, err
+}
+
+const getUserPendingEmail = `-- name: GetUserPendingEmail :one
+SELECT id, email, role, pending_email FROM users WHERE id = ? LIMIT 1
+`
+
+type GetUserPendingEmailRow struct {
+	ID           uuid.UUID  `json:"id"`
+	Email        string     `json:"email"`
+	Role         types.Role `json:"role"`
+	PendingEmail string     `json:"pending_email"`
+}
+
+func (q *Queries) GetUserPendingEmail(ctx context.Context, id uuid.UUID) (GetUserPendingEmailRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserPendingEmail, id)
+	var i GetUserPendingEmailRow
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Role,
+		&i.PendingEmail,
+	)
+	return i, err
+}
+
+const getUserTotp = `-- name: GetUserTotp :one
+SELECT id, email, role, totp_secret, totp_enabled, active FROM users WHERE id = ? LIMIT 1
+`
+
+type GetUserTotpRow struct {
+	ID          uuid.UUID  `json:"id"`
+	Email       string     `json:"email"`
+	Role        types.Role `json:"role"`
+	TotpSecret  string     `json:"totp_secret"`
+	TotpEnabled int64      `json:"totp_enabled"`
+	Active      int64      `json:"active"`
+}
+
+func (q *Queries) GetUserTotp(ctx context.Context, id uuid.UUID) (GetUserTotpRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserTotp, id)
+	var i GetUserTotpRow
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.Active,
+	)
+	return i, err
+}
+
+const getUserWithPasswordById = `-- name: GetUserWithPasswordById :one
+SELECT id, email, password, role FROM users WHERE id = ? LIMIT 1
+`
+
+type GetUserWithPasswordByIdRow struct {
+	ID       uuid.UUID  `json:"id"`
+	Email    string     `json:"email"`
+	Password string     `json:"password"`
+	Role     types.Role `json:"role"`
+}
+
+func (q *Queries) GetUserWithPasswordById(ctx context.Context, id uuid.UUID) (GetUserWithPasswordByIdRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserWithPasswordById, id)
+	var i GetUserWithPasswordByIdRow
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Password,
+		&i.Role,
+	)
 	return i, err
 }
 
@@ -133,6 +354,226 @@ func (q *Queries) GetUsers(ctx context.Context) ([]GetUsersRow, error) {
 	return items, nil
 }
 
+const getUsersByOrg = `-- name: GetUsersByOrg :many
+SELECT users.id, users.email, users.role, users.created_at
+FROM users
+JOIN org_members ON org_members.user_id = users.id
+WHERE org_members.org_id = ?
+`
+
+type GetUsersByOrgRow struct {
+	ID        uuid.UUID  `json:"id"`
+	Email     string     `json:"email"`
+	Role      types.Role `json:"role"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (q *Queries) GetUsersByOrg(ctx context.Context, orgID uuid.UUID) ([]GetUsersByOrgRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByOrg, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersByOrgRow
+	for rows.Next() {
+		var i GetUsersByOrgRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.Role,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUsersByRole = `-- name: GetUsersByRole :many
+SELECT id, email FROM users WHERE role = ? ORDER BY email
+`
+
+type GetUsersByRoleRow struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+}
+
+func (q *Queries) GetUsersByRole(ctx context.Context, role types.Role) ([]GetUsersByRoleRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByRole, role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersByRoleRow
+	for rows.Next() {
+		var i GetUsersByRoleRow
+		if err := rows.Scan(&i.ID, &i.Email); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const incrementFailedLogins = `-- name: IncrementFailedLogins :one
+UPDATE users SET failed_logins = failed_logins + 1 WHERE id = ? RETURNING failed_logins
+`
+
+func (q *Queries) IncrementFailedLogins(ctx context.Context, id uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, incrementFailedLogins, id)
+	var failed_logins int64
+	err := row.Scan(&failed_logins)
+	return failed_logins, err
+}
+
+const resetFailedLogins = `-- name: ResetFailedLogins :exec
+UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = ?
+`
+
+func (q *Queries) ResetFailedLogins(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, resetFailedLogins, id)
+	return err
+}
+
+const setUserActive = `-- name: SetUserActive :exec
+UPDATE users SET active = ? WHERE id = ?
+`
+
+type SetUserActiveParams struct {
+	Active int64     `json:"active"`
+	ID     uuid.UUID `json:"id"`
+}
+
+func (q *Queries) SetUserActive(ctx context.Context, arg SetUserActiveParams) error {
+	_, err := q.db.ExecContext(ctx, setUserActive, arg.Active, arg.ID)
+	return err
+}
+
+const setUserExternalID = `-- name: SetUserExternalID :exec
+UPDATE users SET external_id = ? WHERE id = ?
+`
+
+type SetUserExternalIDParams struct {
+	ExternalID string    `json:"external_id"`
+	ID         uuid.UUID `json:"id"`
+}
+
+func (q *Queries) SetUserExternalID(ctx context.Context, arg SetUserExternalIDParams) error {
+	_, err := q.db.ExecContext(ctx, setUserExternalID, arg.ExternalID, arg.ID)
+	return err
+}
+
+const setUserLockedUntil = `-- name: SetUserLockedUntil :exec
+UPDATE users SET locked_until = ? WHERE id = ?
+`
+
+type SetUserLockedUntilParams struct {
+	LockedUntil sql.NullTime `json:"locked_until"`
+	ID          uuid.UUID    `json:"id"`
+}
+
+func (q *Queries) SetUserLockedUntil(ctx context.Context, arg SetUserLockedUntilParams) error {
+	_, err := q.db.ExecContext(ctx, setUserLockedUntil, arg.LockedUntil, arg.ID)
+	return err
+}
+
+const setUserLoginNotices = `-- name: SetUserLoginNotices :exec
+UPDATE users SET login_notices = ? WHERE id = ?
+`
+
+type SetUserLoginNoticesParams struct {
+	LoginNotices int64     `json:"login_notices"`
+	ID           uuid.UUID `json:"id"`
+}
+
+func (q *Queries) SetUserLoginNotices(ctx context.Context, arg SetUserLoginNoticesParams) error {
+	_, err := q.db.ExecContext(ctx, setUserLoginNotices, arg.LoginNotices, arg.ID)
+	return err
+}
+
+const setUserPendingEmail = `-- name: SetUserPendingEmail :exec
+UPDATE users SET pending_email = ? WHERE id = ?
+`
+
+type SetUserPendingEmailParams struct {
+	PendingEmail string    `json:"pending_email"`
+	ID           uuid.UUID `json:"id"`
+}
+
+func (q *Queries) SetUserPendingEmail(ctx context.Context, arg SetUserPendingEmailParams) error {
+	_, err := q.db.ExecContext(ctx, setUserPendingEmail, arg.PendingEmail, arg.ID)
+	return err
+}
+
+const setUserRole = `-- name: SetUserRole :exec
+UPDATE users SET role = ? WHERE id = ?
+`
+
+type SetUserRoleParams struct {
+	Role types.Role `json:"role"`
+	ID   uuid.UUID  `json:"id"`
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) error {
+	_, err := q.db.ExecContext(ctx, setUserRole, arg.Role, arg.ID)
+	return err
+}
+
+const setUserTotpSecret = `-- name: SetUserTotpSecret :exec
+UPDATE users SET totp_secret = ?, totp_enabled = 0 WHERE id = ?
+`
+
+type SetUserTotpSecretParams struct {
+	TotpSecret string    `json:"totp_secret"`
+	ID         uuid.UUID `json:"id"`
+}
+
+func (q *Queries) SetUserTotpSecret(ctx context.Context, arg SetUserTotpSecretParams) error {
+	_, err := q.db.ExecContext(ctx, setUserTotpSecret, arg.TotpSecret, arg.ID)
+	return err
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :exec
+UPDATE users SET email = ?, pending_email = '' WHERE id = ?
+`
+
+type UpdateUserEmailParams struct {
+	Email string    `json:"email"`
+	ID    uuid.UUID `json:"id"`
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserEmail, arg.Email, arg.ID)
+	return err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users SET password = ? WHERE id = ?
+`
+
+type UpdateUserPasswordParams struct {
+	Password string    `json:"password"`
+	ID       uuid.UUID `json:"id"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.Password, arg.ID)
+	return err
+}
+
 const verifyUser = `-- name: VerifyUser :exec
 UPDATE users SET verified = 1 WHERE id = ?
 `
@@ -0,0 +1,11 @@
+-- SUBJ
+Подтверждение нового адреса в {{.AppName}}
+-- TEXT
+Этот адрес указан как новый email аккаунта в {{.AppName}}.
+Чтобы подтвердить смену адреса, перейдите по ссылке:
+{{.Link}}
+Если вы не меняли адрес, просто проигнорируйте это письмо.
+-- HTML
+<p>Этот адрес указан как новый email аккаунта в {{.AppName}}.</p>
+<a href="{{.Link}}">Подтвердить смену адреса</a>
+<p>Если вы не меняли адрес, просто проигнорируйте это письмо.</p>
@@ -0,0 +1,12 @@
+-- SUBJ
+Смена адреса в {{.AppName}}
+-- TEXT
+Для вашего аккаунта в {{.AppName}} запрошена смена адреса на {{.NewEmail}}.
+Адрес изменится только после подтверждения с нового адреса.
+Если это были не вы, отмените смену по ссылке и смените пароль:
+{{.Link}}
+-- HTML
+<p>Для вашего аккаунта в {{.AppName}} запрошена смена адреса на {{.NewEmail}}.</p>
+<p>Адрес изменится только после подтверждения с нового адреса.</p>
+<p>Если это были не вы, отмените смену и смените пароль:</p>
+<a href="{{.Link}}">Отменить смену адреса</a>
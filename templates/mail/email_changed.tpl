@@ -0,0 +1,12 @@
+-- SUBJ
+Адрес в {{.AppName}} изменён
+-- TEXT
+Адрес вашего аккаунта в {{.AppName}} изменён на {{.NewEmail}} {{.When}}.
+Адрес: {{.Ip}}, устройство: {{.Device}}.
+Если это были не вы, завершите все сеансы по ссылке и обратитесь в поддержку:
+{{.Link}}
+-- HTML
+<p>Адрес вашего аккаунта в {{.AppName}} изменён на {{.NewEmail}} {{.When}}.</p>
+<p>Адрес: {{.Ip}}, устройство: {{.Device}}.</p>
+<p>Если это были не вы, завершите все сеансы и обратитесь в поддержку:</p>
+<a href="{{.Link}}">Это был не я</a>
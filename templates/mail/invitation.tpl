@@ -0,0 +1,14 @@
+-- SUBJ
+Приглашение в {{.AppName}}
+-- TEXT
+Вас пригласили в {{.AppName}}
+Чтобы создать учетную запись, перейдите по ссылке и задайте пароль:
+{{.Link}}
+Приглашение действует до {{.Until}}.
+Если вы не ждали этого письма, просто проигнорируйте его.
+-- HTML
+<p>Вас пригласили в {{.AppName}}</p>
+<p>Чтобы создать учетную запись, перейдите по ссылке и задайте пароль.</p>
+<a href="{{.Link}}">Принять приглашение</a>
+<p>Приглашение действует до {{.Until}}.</p>
+<p>Если вы не ждали этого письма, просто проигнорируйте его.</p>
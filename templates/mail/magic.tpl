@@ -0,0 +1,12 @@
+-- SUBJ
+Вход в {{.AppName}}
+-- TEXT
+Ссылка для входа в {{.AppName}}
+{{.Link}}
+Ссылка действует 15 минут и только один раз.
+Если вы не запрашивали вход, просто проигнорируйте это письмо.
+-- HTML
+<p>Вход в {{.AppName}}</p>
+<a href="{{.Link}}">Войти</a>
+<p>Ссылка действует 15 минут и только один раз.</p>
+<p>Если вы не запрашивали вход, просто проигнорируйте это письмо.</p>
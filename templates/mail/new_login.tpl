@@ -0,0 +1,14 @@
+-- SUBJ
+Вход в {{.AppName}} с нового устройства
+-- TEXT
+В ваш аккаунт в {{.AppName}} выполнен вход {{.When}}.
+Адрес: {{.Ip}}, устройство: {{.Device}}.
+Если это были не вы, завершите все сеансы по ссылке и смените пароль:
+{{.Link}}
+Такие уведомления можно отключить в настройках аккаунта.
+-- HTML
+<p>В ваш аккаунт в {{.AppName}} выполнен вход {{.When}}.</p>
+<p>Адрес: {{.Ip}}, устройство: {{.Device}}.</p>
+<p>Если это были не вы, завершите все сеансы и смените пароль:</p>
+<a href="{{.Link}}">Это был не я</a>
+<p>Такие уведомления можно отключить в настройках аккаунта.</p>
@@ -0,0 +1,10 @@
+-- SUBJ
+Восстановление пароля в {{.AppName}}
+-- TEXT
+Ссылка для смены пароля в {{.AppName}}
+{{.Link}}
+Если вы не запрашивали восстановление пароля, просто проигнорируйте это письмо.
+-- HTML
+<p>Восстановление пароля в {{.AppName}}</p>
+<a href="{{.Link}}">Нажмите здесь</a>
+<p>Если вы не запрашивали восстановление пароля, просто проигнорируйте это письмо.</p>
\ No newline at end of file
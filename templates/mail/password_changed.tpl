@@ -0,0 +1,12 @@
+-- SUBJ
+Пароль в {{.AppName}} изменён
+-- TEXT
+Пароль вашего аккаунта в {{.AppName}} изменён {{.When}}.
+Адрес: {{.Ip}}, устройство: {{.Device}}.
+Если это были не вы, завершите все сеансы по ссылке и восстановите пароль:
+{{.Link}}
+-- HTML
+<p>Пароль вашего аккаунта в {{.AppName}} изменён {{.When}}.</p>
+<p>Адрес: {{.Ip}}, устройство: {{.Device}}.</p>
+<p>Если это были не вы, завершите все сеансы и восстановите пароль:</p>
+<a href="{{.Link}}">Это был не я</a>
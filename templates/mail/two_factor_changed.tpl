@@ -0,0 +1,12 @@
+-- SUBJ
+Двухфакторная аутентификация в {{.AppName}} {{if .Enabled}}включена{{else}}отключена{{end}}
+-- TEXT
+Для вашего аккаунта в {{.AppName}} {{if .Enabled}}включена{{else}}отключена{{end}} двухфакторная аутентификация {{.When}}.
+Адрес: {{.Ip}}, устройство: {{.Device}}.
+Если это были не вы, завершите все сеансы по ссылке и смените пароль:
+{{.Link}}
+-- HTML
+<p>Для вашего аккаунта в {{.AppName}} {{if .Enabled}}включена{{else}}отключена{{end}} двухфакторная аутентификация {{.When}}.</p>
+<p>Адрес: {{.Ip}}, устройство: {{.Device}}.</p>
+<p>Если это были не вы, завершите все сеансы и смените пароль:</p>
+<a href="{{.Link}}">Это был не я</a>
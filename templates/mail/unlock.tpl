@@ -0,0 +1,11 @@
+-- SUBJ
+Ваш аккаунт в {{.AppName}} временно заблокирован
+-- TEXT
+Из-за нескольких неудачных попыток входа ваш аккаунт в {{.AppName}} заблокирован до {{.Until}}.
+Чтобы разблокировать его сейчас, перейдите по ссылке:
+{{.Link}}
+Если это были не вы, рекомендуем сменить пароль.
+-- HTML
+<p>Из-за нескольких неудачных попыток входа ваш аккаунт в {{.AppName}} заблокирован до {{.Until}}.</p>
+<a href="{{.Link}}">Разблокировать аккаунт</a>
+<p>Если это были не вы, рекомендуем сменить пароль.</p>
\ No newline at end of file